@@ -0,0 +1,121 @@
+package abi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ABI word size in bytes
+const WordSize = 32
+
+var errShortData = errors.New("abi: data too short")
+
+// Selector of Error(string), used by require() and revert("...")
+var ErrorSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+
+// Decode the message of an Error(string) revert
+func DecodeRevertReason(data []byte) (string, bool) {
+	if len(data) < 4 || !bytes.Equal(data[:4], ErrorSelector) {
+		return "", false
+	}
+	reason, err := DecodeString(data[4:], 0)
+	if err != nil {
+		return "", false
+	}
+	return reason, true
+}
+
+// Word at the given byte offset as an unsigned integer
+func DecodeUint(data []byte, offset int) (*big.Int, error) {
+	if offset < 0 || len(data) < offset+WordSize {
+		return nil, errShortData
+	}
+	return new(big.Int).SetBytes(data[offset : offset+WordSize]), nil
+}
+
+// Dynamic bytes whose head word sits at the given byte offset
+func DecodeBytes(data []byte, offset int) ([]byte, error) {
+	start, err := DecodeUint(data, offset)
+	if err != nil {
+		return nil, err
+	}
+	if !start.IsInt64() || start.Int64() > int64(len(data)) {
+		return nil, errShortData
+	}
+	length, err := DecodeUint(data, int(start.Int64()))
+	if err != nil {
+		return nil, err
+	}
+	begin := int(start.Int64()) + WordSize
+	if !length.IsInt64() || length.Int64() > int64(len(data)-begin) {
+		return nil, errShortData
+	}
+	return data[begin : begin+int(length.Int64())], nil
+}
+
+// Dynamic string whose head word sits at the given byte offset
+func DecodeString(data []byte, offset int) (string, error) {
+	value, err := DecodeBytes(data, offset)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// Decode values laid out as a tuple of the given types, formatted as strings.
+// Arrays and tuples are returned as the raw hex head word.
+func DecodeValues(data []byte, types []string) ([]string, error) {
+	values := make([]string, len(types))
+	for i, typ := range types {
+		value, err := DecodeValue(data, i*WordSize, typ)
+		if err != nil {
+			return nil, fmt.Errorf("abi: decoding %s at position %d: %v", typ, i, err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// Decode a single value whose head word sits at the given byte offset
+func DecodeValue(data []byte, offset int, typ string) (string, error) {
+	switch {
+	case typ == "string":
+		return DecodeString(data, offset)
+	case typ == "bytes":
+		value, err := DecodeBytes(data, offset)
+		return "0x" + hex.EncodeToString(value), err
+	}
+
+	word, err := DecodeUint(data, offset)
+	if err != nil {
+		return "", err
+	}
+	raw := data[offset : offset+WordSize]
+
+	switch {
+	case typ == "address":
+		return "0x" + hex.EncodeToString(raw[12:]), nil
+	case typ == "bool":
+		return strconv.FormatBool(word.Sign() != 0), nil
+	case strings.HasPrefix(typ, "uint"):
+		return word.String(), nil
+	case strings.HasPrefix(typ, "int"):
+		// Two's complement over the full word
+		if raw[0]&0x80 != 0 {
+			word.Sub(word, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		return word.String(), nil
+	case strings.HasPrefix(typ, "bytes"):
+		size, err := strconv.Atoi(strings.TrimPrefix(typ, "bytes"))
+		if err != nil || size < 1 || size > WordSize {
+			return "", fmt.Errorf("invalid type %s", typ)
+		}
+		return "0x" + hex.EncodeToString(raw[:size]), nil
+	}
+	return "0x" + hex.EncodeToString(raw), nil
+}
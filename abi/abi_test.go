@@ -0,0 +1,90 @@
+package abi
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestDecodeRevertReason(t *testing.T) {
+	// revert("Not enough Ether provided.")
+	data, _ := hex.DecodeString("08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"000000000000000000000000000000000000000000000000000000000000001a" +
+		"4e6f7420656e6f7567682045746865722070726f76696465642e000000000000")
+
+	reason, ok := DecodeRevertReason(data)
+	if !ok || reason != "Not enough Ether provided." {
+		t.Errorf("Unexpected revert reason: %q (%v)", reason, ok)
+	}
+
+	if _, ok := DecodeRevertReason(data[:40]); ok {
+		t.Error("Expected truncated revert data to be rejected")
+	}
+}
+
+func TestKeccak256(t *testing.T) {
+	tests := map[string]string{
+		"":                          "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470",
+		"transfer(address,uint256)": "a9059cbb2ab09eb219583f4a59a5d0623ade346d962bcd4e46b11da047c9049b",
+	}
+	for input, expected := range tests {
+		if hash := hex.EncodeToString(Keccak256([]byte(input))); hash != expected {
+			t.Errorf("Keccak256(%q) = %s, want %s", input, hash, expected)
+		}
+	}
+
+	if selector := hex.EncodeToString(Selector("Error(string)")); selector != "08c379a0" {
+		t.Errorf("Unexpected Error(string) selector: %s", selector)
+	}
+}
+
+func TestDecodeRevert(t *testing.T) {
+	t.Run("Test with a panic", func(t *testing.T) {
+		data, _ := hex.DecodeString("4e487b71" + "0000000000000000000000000000000000000000000000000000000000000011")
+		revert := DecodeRevert(data)
+		if revert.Kind != RevertPanic || *revert.PanicCode != 0x11 || revert.Message != "arithmetic overflow or underflow" {
+			t.Errorf("Unexpected revert: %+v", revert)
+		}
+	})
+
+	t.Run("Test with a registered custom error", func(t *testing.T) {
+		data := Selector("ERC20InsufficientBalance(address,uint256,uint256)")
+		args, _ := hex.DecodeString(
+			"00000000000000000000000000000000000000000000000000000000000000ab" +
+				"0000000000000000000000000000000000000000000000000000000000000005" +
+				"000000000000000000000000000000000000000000000000000000000000000a")
+		revert := DecodeRevert(append(data, args...))
+		if revert.String() != "ERC20InsufficientBalance(0x00000000000000000000000000000000000000ab, 5, 10)" {
+			t.Errorf("Unexpected revert: %s", revert)
+		}
+	})
+
+	t.Run("Test with an unknown selector", func(t *testing.T) {
+		revert := DecodeRevert([]byte{0xde, 0xad, 0xbe, 0xef})
+		if revert.Kind != RevertUnknown || revert.Selector != "0xdeadbeef" {
+			t.Errorf("Unexpected revert: %+v", revert)
+		}
+	})
+}
+
+func TestEncode(t *testing.T) {
+	word, err := EncodeAddress("0x00000000000000000000000000000000000000ab")
+	if err != nil {
+		t.Fatalf("EncodeAddress() returned an error: %v", err)
+	}
+	if value, _ := DecodeValue(word, 0, "address"); value != "0x00000000000000000000000000000000000000ab" {
+		t.Errorf("Unexpected address round trip: %s", value)
+	}
+	if _, err := EncodeAddress("0xab"); err == nil {
+		t.Errorf("Expected an error for a short address")
+	}
+
+	data := append(EncodeUint(big.NewInt(WordSize)), EncodeDynamicBytes([]byte("hello"))...)
+	if len(data) != 3*WordSize {
+		t.Errorf("Expected dynamic bytes padded to whole words, got %d bytes", len(data))
+	}
+	if value, _ := DecodeString(data, 0); value != "hello" {
+		t.Errorf("Unexpected bytes round trip: %q", value)
+	}
+}
@@ -0,0 +1,42 @@
+package abi
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Word holding an unsigned integer
+func EncodeUint(value *big.Int) []byte {
+	word := make([]byte, WordSize)
+	return value.FillBytes(word)
+}
+
+// Word holding a 0x-prefixed hex address
+func EncodeAddress(address string) ([]byte, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(address, "0x"), "0X"))
+	if err != nil || len(raw) != 20 {
+		return nil, fmt.Errorf("abi: invalid address %q", address)
+	}
+	word := make([]byte, WordSize)
+	copy(word[12:], raw)
+	return word, nil
+}
+
+func EncodeBool(value bool) []byte {
+	word := make([]byte, WordSize)
+	if value {
+		word[WordSize-1] = 1
+	}
+	return word
+}
+
+// Tail of dynamic bytes: the length word followed by the data padded to whole words
+func EncodeDynamicBytes(data []byte) []byte {
+	padded := (len(data) + WordSize - 1) / WordSize * WordSize
+	encoded := make([]byte, WordSize+padded)
+	copy(encoded, EncodeUint(big.NewInt(int64(len(data)))))
+	copy(encoded[WordSize:], data)
+	return encoded
+}
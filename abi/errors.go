@@ -0,0 +1,199 @@
+package abi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// Kinds of revert data
+const (
+	RevertError   = "error"
+	RevertPanic   = "panic"
+	RevertCustom  = "custom"
+	RevertUnknown = "unknown"
+)
+
+// Selector of Panic(uint256), raised by failed asserts and runtime checks
+var PanicSelector = []byte{0x4e, 0x48, 0x7b, 0x71}
+
+// Meaning of the Solidity panic codes
+var panicReasons = map[uint64]string{
+	0x00: "generic compiler panic",
+	0x01: "assertion failed",
+	0x11: "arithmetic overflow or underflow",
+	0x12: "division or modulo by zero",
+	0x21: "invalid enum value",
+	0x22: "corrupted storage byte array",
+	0x31: "pop on empty array",
+	0x32: "array index out of bounds",
+	0x41: "out of memory",
+	0x51: "call to zero-initialized function",
+}
+
+// Decoded revert data
+type Revert struct {
+	Kind      string   `json:"kind"`
+	Message   string   `json:"message,omitempty"`
+	PanicCode *uint64  `json:"panicCode,omitempty"`
+	Selector  string   `json:"selector,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Args      []string `json:"args,omitempty"`
+}
+
+func (r Revert) String() string {
+	switch r.Kind {
+	case RevertError:
+		return r.Message
+	case RevertPanic:
+		return fmt.Sprintf("panic 0x%02x: %s", *r.PanicCode, r.Message)
+	case RevertCustom:
+		return fmt.Sprintf("%s(%s)", r.Name, strings.Join(r.Args, ", "))
+	}
+	if r.Selector != "" {
+		return "unknown error " + r.Selector
+	}
+	return "reverted without data"
+}
+
+/******************
+Custom Errors
+******************/
+
+// Custom error definition from a contract ABI
+type ErrorDef struct {
+	Name   string
+	Inputs []string
+}
+
+func (d ErrorDef) Signature() string {
+	return fmt.Sprintf("%s(%s)", d.Name, strings.Join(d.Inputs, ","))
+}
+
+// Custom errors known by selector
+type ErrorRegistry struct {
+	mu     sync.RWMutex
+	errors map[string]ErrorDef
+}
+
+// Registry used by DecodeRevert, seeded with widely used OpenZeppelin errors
+var DefaultErrors = NewErrorRegistry(
+	"ERC20InsufficientBalance(address,uint256,uint256)",
+	"ERC20InsufficientAllowance(address,uint256,uint256)",
+	"ERC20InvalidSender(address)",
+	"ERC20InvalidReceiver(address)",
+	"ERC721NonexistentToken(uint256)",
+	"ERC721IncorrectOwner(address,uint256,address)",
+	"OwnableUnauthorizedAccount(address)",
+	"AccessControlUnauthorizedAccount(address,bytes32)",
+	"ReentrancyGuardReentrantCall()",
+	"EnforcedPause()",
+	"SafeERC20FailedOperation(address)",
+)
+
+func NewErrorRegistry(signatures ...string) *ErrorRegistry {
+	r := &ErrorRegistry{errors: make(map[string]ErrorDef)}
+	for _, signature := range signatures {
+		if err := r.Register(signature); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Register an error by its signature, e.g. "InsufficientBalance(uint256,uint256)"
+func (r *ErrorRegistry) Register(signature string) error {
+	open := strings.Index(signature, "(")
+	if open <= 0 || !strings.HasSuffix(signature, ")") {
+		return fmt.Errorf("abi: invalid error signature %q", signature)
+	}
+	def := ErrorDef{Name: signature[:open]}
+	if params := signature[open+1 : len(signature)-1]; params != "" {
+		def.Inputs = strings.Split(params, ",")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors[hex.EncodeToString(Selector(def.Signature()))] = def
+	return nil
+}
+
+// Register every error of a JSON contract ABI file
+func (r *ErrorRegistry) LoadABIFile(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	var entries []struct {
+		Type   string `json:"type"`
+		Name   string `json:"name"`
+		Inputs []struct {
+			Type string `json:"type"`
+		} `json:"inputs"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Type != "error" {
+			continue
+		}
+		inputs := make([]string, len(entry.Inputs))
+		for i, input := range entry.Inputs {
+			inputs[i] = input.Type
+		}
+		if err := r.Register(ErrorDef{Name: entry.Name, Inputs: inputs}.Signature()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ErrorRegistry) lookup(selector []byte) (ErrorDef, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	def, ok := r.errors[hex.EncodeToString(selector)]
+	return def, ok
+}
+
+// Decode revert data as Error(string), Panic(uint256) or a registered custom error
+func DecodeRevert(data []byte) Revert {
+	if len(data) < 4 {
+		return Revert{Kind: RevertUnknown}
+	}
+	selector := data[:4]
+	revert := Revert{Kind: RevertUnknown, Selector: "0x" + hex.EncodeToString(selector)}
+
+	switch {
+	case bytes.Equal(selector, ErrorSelector):
+		if reason, ok := DecodeRevertReason(data); ok {
+			return Revert{Kind: RevertError, Message: reason, Selector: revert.Selector}
+		}
+
+	case bytes.Equal(selector, PanicSelector):
+		code, err := DecodeUint(data[4:], 0)
+		if err == nil && code.IsUint64() {
+			value := code.Uint64()
+			reason, ok := panicReasons[value]
+			if !ok {
+				reason = "unknown panic"
+			}
+			return Revert{Kind: RevertPanic, Message: reason, PanicCode: &value, Selector: revert.Selector}
+		}
+
+	default:
+		if def, ok := DefaultErrors.lookup(selector); ok {
+			args, err := DecodeValues(data[4:], def.Inputs)
+			if err == nil {
+				return Revert{Kind: RevertCustom, Selector: revert.Selector, Name: def.Name, Args: args}
+			}
+		}
+	}
+	return revert
+}
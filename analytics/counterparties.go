@@ -0,0 +1,252 @@
+package analytics
+
+import (
+	"encoding/json"
+	"ethereye/labels"
+	"ethereye/node"
+	. "ethereye/transactions"
+	. "ethereye/utils"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/******************
+Counterparties
+******************/
+
+// Kinds of counterparty accounts. The kind is unknown without the node backend or when the lookup fails.
+const (
+	AccountEOA      = "eoa"
+	AccountContract = "contract"
+	AccountUnknown  = "unknown"
+)
+
+// Counterparty rankings
+const (
+	RankByInteractions = "interactions"
+	RankByValue        = "value"
+)
+
+// Counterparties listed unless a limit is given
+const defaultCounterpartyLimit = 50
+
+// Labels the user saved for addresses, such as favorites
+type LabelSource interface {
+	Label(address string) string
+}
+
+// Interactions of a wallet with one address. Interactions counts the transactions involving both,
+// TokenTransfers the ERC-20 transfers among them. Values are the ETH moved, including internal
+// transfers; Label, Category and Risk come from the known-address registry.
+type Counterparty struct {
+	Address          string    `json:"address"`
+	Kind             string    `json:"kind"`
+	FavoriteLabel    string    `json:"favoriteLabel,omitempty"`
+	Label            string    `json:"label,omitempty"`
+	Category         string    `json:"category,omitempty"`
+	Risk             []string  `json:"risk,omitempty"`
+	Interactions     int       `json:"interactions"`
+	TokenTransfers   int       `json:"tokenTransfers"`
+	ValueIn          float64   `json:"valueIn"`
+	ValueOut         float64   `json:"valueOut"`
+	FirstInteraction time.Time `json:"firstInteraction"`
+	LastInteraction  time.Time `json:"lastInteraction"`
+
+	inWei  *big.Int
+	outWei *big.Int
+	hashes map[string]bool
+}
+
+// Counterparties of a wallet or a group of wallets, ranked by interactions or by total value moved.
+// Total is the number of counterparties before the limit.
+type CounterpartyReport struct {
+	Address        string         `json:"address,omitempty"`
+	Addresses      []string       `json:"addresses,omitempty"`
+	RankBy         string         `json:"rankBy"`
+	Total          int            `json:"total"`
+	Counterparties []Counterparty `json:"counterparties"`
+}
+
+// Rank the addresses the wallets exchanged transactions, internal ETH transfers and token transfers
+// with. The sender or recipient of a token transfer is the counterparty, not the token contract.
+// Failed transactions count as interactions but move no value. Only the listed counterparties are
+// looked up on the node, and those the node cannot tell stay unknown.
+func AnalyzeCounterparties(apiKey string, client *node.Client, favorites LabelSource, registry *labels.Registry, addresses []string, rankBy string, limit int) (CounterpartyReport, error) {
+	report := CounterpartyReport{RankBy: rankBy, Counterparties: []Counterparty{}}
+	if len(addresses) == 1 {
+		report.Address = strings.ToLower(addresses[0])
+	} else {
+		report.Addresses = addresses
+	}
+
+	transactions, err := FetchGroupTransactions(apiKey, addresses)
+	if err != nil {
+		return report, err
+	}
+	internals, err := FetchGroupInternalTransactions(apiKey, addresses)
+	if err != nil {
+		return report, err
+	}
+	transfers, err := FetchGroupTokenTransfers(apiKey, addresses)
+	if err != nil {
+		return report, err
+	}
+
+	counterparties := make(map[string]*Counterparty)
+	interact := func(from, to, hash string, at time.Time) (*Counterparty, bool) {
+		outgoing := IsGroupMember(from, addresses)
+		other := from
+		if outgoing {
+			other = to
+		}
+		// Contract creations have no recipient, and transfers within the wallets no counterparty
+		if other == "" || IsGroupMember(other, addresses) {
+			return nil, false
+		}
+		key := strings.ToLower(other)
+		c, ok := counterparties[key]
+		if !ok {
+			c = &Counterparty{Address: key, Kind: AccountUnknown, FirstInteraction: at, LastInteraction: at, inWei: new(big.Int), outWei: new(big.Int), hashes: make(map[string]bool)}
+			counterparties[key] = c
+		}
+		if !c.hashes[hash] {
+			c.hashes[hash] = true
+			c.Interactions++
+		}
+		if at.Before(c.FirstInteraction) {
+			c.FirstInteraction = at
+		}
+		if at.After(c.LastInteraction) {
+			c.LastInteraction = at
+		}
+		return c, outgoing
+	}
+	addValue := func(c *Counterparty, outgoing bool, value string) {
+		if outgoing {
+			c.outWei.Add(c.outWei, ParseBigInt(value))
+		} else {
+			c.inWei.Add(c.inWei, ParseBigInt(value))
+		}
+	}
+
+	// Calls to a token contract that only moved its tokens count for the other side of the transfer
+	tokenCalls := make(map[string]bool)
+	for _, transfer := range transfers {
+		tokenCalls[strings.ToLower(transfer.Hash+"/"+transfer.ContractAddr)] = true
+	}
+
+	for _, tx := range transactions {
+		if ParseBigInt(tx.Value).Sign() == 0 && tokenCalls[strings.ToLower(tx.ID+"/"+tx.ToAddress)] {
+			continue
+		}
+		c, outgoing := interact(tx.FromAddress, tx.ToAddress, tx.ID, tx.Timestamp)
+		if c != nil && tx.Status != "0" {
+			addValue(c, outgoing, tx.Value)
+		}
+	}
+	for _, internal := range internals {
+		c, outgoing := interact(internal.From, internal.To, internal.Hash, time.Unix(internal.Timestamp, 0))
+		if c != nil && !internal.IsError {
+			addValue(c, outgoing, internal.Value)
+		}
+	}
+	for _, transfer := range transfers {
+		if c, _ := interact(transfer.From, transfer.To, transfer.Hash, time.Unix(transfer.Timestamp, 0)); c != nil {
+			c.TokenTransfers++
+		}
+	}
+
+	ranked := make([]*Counterparty, 0, len(counterparties))
+	for _, c := range counterparties {
+		ranked = append(ranked, c)
+	}
+	rankCounterparties(ranked, rankBy)
+	report.Total = len(ranked)
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	for _, c := range ranked {
+		if client != nil {
+			if code, err := client.Code(c.Address, "latest"); err == nil {
+				c.Kind = AccountEOA
+				if len(code) > 0 {
+					c.Kind = AccountContract
+				}
+			}
+		}
+		if favorites != nil {
+			c.FavoriteLabel = favorites.Label(c.Address)
+		}
+		if known, ok := registry.Known(c.Address); ok {
+			c.Label, c.Category, c.Risk = known.Name, known.Category, known.Risk
+		}
+		c.ValueIn = WeiToEther(c.inWei)
+		c.ValueOut = WeiToEther(c.outWei)
+		report.Counterparties = append(report.Counterparties, *c)
+	}
+	return report, nil
+}
+
+// Sort by the ranking, breaking ties with the other ranking and then the address
+func rankCounterparties(counterparties []*Counterparty, rankBy string) {
+	sort.Slice(counterparties, func(i, j int) bool {
+		a, b := counterparties[i], counterparties[j]
+		byCount := a.Interactions - b.Interactions
+		byValue := new(big.Int).Add(a.inWei, a.outWei).Cmp(new(big.Int).Add(b.inWei, b.outWei))
+		first, second := byCount, byValue
+		if rankBy == RankByValue {
+			first, second = byValue, byCount
+		}
+		if first != 0 {
+			return first > 0
+		}
+		if second != 0 {
+			return second > 0
+		}
+		return a.Address < b.Address
+	})
+}
+
+// GET /api/v1/counterparties?address={address}&rank={interactions|value}&limit={count}
+// GET /api/v1/counterparties?group={id}&rank={interactions|value}&limit={count}
+func CounterpartiesHandler(apiKey string, client *node.Client, favorites LabelSource, registry *labels.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		addresses, ok := RequireAddresses(w, query)
+		if !ok {
+			return
+		}
+		rankBy := query.Get("rank")
+		if rankBy == "" {
+			rankBy = RankByInteractions
+		}
+		if rankBy != RankByInteractions && rankBy != RankByValue {
+			http.Error(w, "Invalid 'rank' query parameter, expected interactions or value", http.StatusBadRequest)
+			return
+		}
+		limit := defaultCounterpartyLimit
+		if value := query.Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "Invalid 'limit' query parameter", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		report, err := AnalyzeCounterparties(apiKey, client, favorites, registry, addresses, rankBy, limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error analyzing counterparties: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
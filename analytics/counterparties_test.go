@@ -0,0 +1,172 @@
+package analytics
+
+import (
+	"encoding/json"
+	"ethereye/internal/testutil"
+	"ethereye/labels"
+	"ethereye/node"
+	. "ethereye/transactions"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+/************
+common
+************/
+
+// Fake node answering eth_getCode with the given bytecode per address
+func newFakeCodeNode(t *testing.T, codes map[string]string) *node.Client {
+	return testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+		"eth_getCode": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+			var address string
+			json.Unmarshal(params[0], &address)
+			if code, ok := codes[strings.ToLower(address)]; ok {
+				return code, nil
+			}
+			return "0x", nil
+		},
+	})
+}
+
+type fakeFavorites map[string]string
+
+func (f fakeFavorites) Label(address string) string {
+	return f[strings.ToLower(address)]
+}
+
+func transfer(hash, from, to, value string, timestamp time.Time, status string) map[string]string {
+	transaction := tx(hash, from, to, 1, timestamp, "21000", "10000000000", "")
+	transaction["value"] = value
+	transaction["txreceipt_status"] = status
+	return transaction
+}
+
+/************
+test body
+************/
+
+func TestAnalyzeCounterparties(t *testing.T) {
+	friend := "0x2222222222222222222222222222222222222222"
+	exchange := "0x28c6c06298d514db089934071355e5743bf21d60"
+	jan := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	usdc := "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"
+	useFakeEtherscan(t, map[string][]map[string]string{
+		"txlist": {
+			transfer("0xa", friend, wallet, "1000000000000000000", jan, "1"),
+			transfer("0xb", wallet, friend, "250000000000000000", jan.AddDate(0, 1, 0), "1"),
+			// Failed: counts as an interaction without value
+			transfer("0xc", wallet, friend, "9000000000000000000", jan.AddDate(0, 2, 0), "0"),
+			transfer("0xd", exchange, wallet, "5000000000000000000", jan.AddDate(0, 0, 5), "1"),
+			// Self transfer
+			transfer("0xe", wallet, wallet, "1000000000000000000", jan, "1"),
+			// USDC sent to the friend: the token contract is no counterparty
+			transfer("0xf", wallet, usdc, "0", jan.AddDate(0, 1, 0), "1"),
+		},
+		"tokentx": {
+			{"blockNumber": "1", "timeStamp": fmt.Sprint(jan.AddDate(0, 1, 0).Unix()), "hash": "0xf", "from": wallet, "to": friend, "value": "5000000", "contractAddress": usdc, "tokenName": "USD Coin", "tokenSymbol": "USDC", "tokenDecimal": "6"},
+		},
+		"txlistinternal": {
+			// Withdrawal paid out by the exchange's contract
+			{"blockNumber": "1", "timeStamp": fmt.Sprint(jan.AddDate(0, 0, 6).Unix()), "hash": "0x10", "from": exchange, "to": wallet, "value": "1000000000000000000", "isError": "0"},
+		},
+	})
+	client := newFakeCodeNode(t, map[string]string{exchange: "0x6080"})
+	favorites := fakeFavorites{friend: "Alice"}
+
+	t.Run("Test with interactions", func(t *testing.T) {
+		report, err := AnalyzeCounterparties("", client, favorites, labels.NewRegistry(labels.DefaultLabels), []string{wallet}, RankByInteractions, 10)
+		if err != nil {
+			t.Fatalf("AnalyzeCounterparties returned error: %v", err)
+		}
+		if report.Total != 2 || len(report.Counterparties) != 2 {
+			t.Fatalf("Expected 2 counterparties, got %+v", report)
+		}
+		first := report.Counterparties[0]
+		if first.Address != friend || first.Interactions != 4 || first.TokenTransfers != 1 || first.Kind != AccountEOA || first.FavoriteLabel != "Alice" {
+			t.Errorf("Unexpected counterparty %+v", first)
+		}
+		if !almostEqual(first.ValueIn, 1) || !almostEqual(first.ValueOut, 0.25) {
+			t.Errorf("Unexpected values in %f, out %f", first.ValueIn, first.ValueOut)
+		}
+		if !first.FirstInteraction.Equal(jan) || !first.LastInteraction.Equal(jan.AddDate(0, 2, 0)) {
+			t.Errorf("Unexpected interaction times %v, %v", first.FirstInteraction, first.LastInteraction)
+		}
+		second := report.Counterparties[1]
+		if second.Address != exchange || second.Interactions != 2 || second.Kind != AccountContract || second.Label != "Binance 14" || second.Category != labels.CategoryExchange {
+			t.Errorf("Unexpected counterparty %+v", second)
+		}
+		if !almostEqual(second.ValueIn, 6) {
+			t.Errorf("Expected the internal transfer to count, got %f in", second.ValueIn)
+		}
+	})
+
+	t.Run("Test with a failing node", func(t *testing.T) {
+		unreachable := node.NewClient("http://127.0.0.1:1")
+		report, err := AnalyzeCounterparties("", unreachable, nil, nil, []string{wallet}, RankByInteractions, 10)
+		if err != nil {
+			t.Fatalf("AnalyzeCounterparties returned error: %v", err)
+		}
+		for _, c := range report.Counterparties {
+			if c.Kind != AccountUnknown {
+				t.Errorf("Expected an unknown kind, got %+v", c)
+			}
+		}
+	})
+
+	t.Run("Test with value and limit", func(t *testing.T) {
+		report, err := AnalyzeCounterparties("", nil, nil, nil, []string{wallet}, RankByValue, 1)
+		if err != nil {
+			t.Fatalf("AnalyzeCounterparties returned error: %v", err)
+		}
+		if report.Total != 2 || len(report.Counterparties) != 1 {
+			t.Fatalf("Expected 1 of 2 counterparties, got %+v", report)
+		}
+		if c := report.Counterparties[0]; c.Address != exchange || c.Kind != AccountUnknown || c.Label != "" {
+			t.Errorf("Unexpected counterparty %+v", c)
+		}
+	})
+
+	t.Run("Test with group", func(t *testing.T) {
+		report, err := AnalyzeCounterparties("", nil, nil, nil, []string{wallet, friend}, RankByInteractions, 10)
+		if err != nil {
+			t.Fatalf("AnalyzeCounterparties returned error: %v", err)
+		}
+		// Transfers between the members have no counterparty
+		if report.Total != 1 || report.Counterparties[0].Address != exchange || len(report.Addresses) != 2 {
+			t.Errorf("Unexpected group report %+v", report)
+		}
+	})
+}
+
+func TestCounterpartiesHandler(t *testing.T) {
+	useFakeEtherscan(t, nil)
+	UseGroups(fakeGroups{"treasury": {wallet}})
+	defer UseGroups(nil)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"Test with missing address", "", http.StatusBadRequest},
+		{"Test with invalid rank", "?address=" + wallet + "&rank=fees", http.StatusBadRequest},
+		{"Test with invalid limit", "?address=" + wallet + "&limit=0", http.StatusBadRequest},
+		{"Test with valid request", "?address=" + wallet + "&rank=value&limit=5", http.StatusOK},
+		{"Test with unknown group", "?group=missing", http.StatusNotFound},
+		{"Test with group", "?group=treasury", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/api/v1/counterparties"+test.query, nil)
+			recorder := httptest.NewRecorder()
+			CounterpartiesHandler("", nil, nil, labels.NewRegistry(labels.DefaultLabels)).ServeHTTP(recorder, request)
+			if recorder.Code != test.expected {
+				t.Errorf("Expected status code %d, got %d", test.expected, recorder.Code)
+			}
+		})
+	}
+}
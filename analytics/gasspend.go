@@ -0,0 +1,290 @@
+package analytics
+
+import (
+	"encoding/json"
+	"errors"
+	"ethereye/gas"
+	"ethereye/node"
+	"ethereye/prices"
+	. "ethereye/transactions"
+	. "ethereye/utils"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+/******************
+Gas Spend
+******************/
+
+// Transactions listed in MostExpensive
+const mostExpensiveCount = 10
+
+// Fee paid by a single transaction. Fees are in ETH, gas prices in gwei. FeeFiat is valued at the
+// ETH price of the transaction's time and left out when that price is unknown.
+type TransactionFee struct {
+	Hash        string    `json:"hash"`
+	Timestamp   time.Time `json:"timeStamp"`
+	To          string    `json:"to"`
+	Method      string    `json:"method"`
+	GasUsed     uint64    `json:"gasUsed"`
+	GasPrice    float64   `json:"gasPrice"`
+	BaseFee     *float64  `json:"baseFee,omitempty"`
+	Fee         float64   `json:"fee"`
+	FeeFiat     *float64  `json:"feeFiat,omitempty"`
+	Overpaid    *float64  `json:"overpaid,omitempty"`
+	BlockHeight uint64    `json:"blockHeight"`
+
+	feeWei      *big.Int
+	gasPriceWei *big.Int
+	overpaidWei *big.Int
+	price       *float64
+}
+
+// Fees of the transactions sharing a month, contract or method
+type SpendGroup struct {
+	Key          string   `json:"key"`
+	Transactions int      `json:"transactions"`
+	Fees         float64  `json:"fees"`
+	FeesFiat     float64  `json:"feesFiat"`
+	Overpaid     *float64 `json:"overpaid,omitempty"`
+}
+
+// Gas spent by a wallet or a group of wallets over a period. Amounts are in ETH unless suffixed with
+// Fiat; fiat amounts value each fee at the ETH price of its transaction's time and leave out the
+// MissingPrices fees without a known price. Overpaid is what was paid above the block's base fee;
+// it needs the node backend.
+type GasSpendReport struct {
+	Address       string           `json:"address,omitempty"`
+	Addresses     []string         `json:"addresses,omitempty"`
+	From          time.Time        `json:"from"`
+	To            time.Time        `json:"to"`
+	Transactions  int              `json:"transactions"`
+	TotalFees     float64          `json:"totalFees"`
+	TotalFeesFiat float64          `json:"totalFeesFiat"`
+	Overpaid      *float64         `json:"overpaid,omitempty"`
+	OverpaidFiat  *float64         `json:"overpaidFiat,omitempty"`
+	FiatCurrency  string           `json:"fiatCurrency"`
+	MissingPrices int              `json:"missingPrices"`
+	ByMonth       []SpendGroup     `json:"byMonth"`
+	ByContract    []SpendGroup     `json:"byContract"`
+	ByMethod      []SpendGroup     `json:"byMethod"`
+	MostExpensive []TransactionFee `json:"mostExpensive"`
+}
+
+// Short method name of a transaction: the function name, the selector, or "transfer" for plain ETH transfers
+func MethodName(tx Transaction) string {
+	if tx.Method != "" {
+		if open := strings.Index(tx.Method, "("); open > 0 {
+			return tx.Method[:open]
+		}
+		return tx.Method
+	}
+	if tx.MethodID != "" && tx.MethodID != "0x" {
+		return tx.MethodID
+	}
+	return "transfer"
+}
+
+// Aggregate gasUsed x effective gas price over the transactions the addresses sent in [from, to]
+func AnalyzeGasSpend(apiKey string, client *node.Client, provider prices.PriceProvider, addresses []string, from, to time.Time, currency string) (GasSpendReport, error) {
+	currency = strings.ToLower(currency)
+	report := GasSpendReport{From: from, To: to, FiatCurrency: currency}
+	if len(addresses) == 1 {
+		report.Address = strings.ToLower(addresses[0])
+	} else {
+		report.Addresses = addresses
+	}
+
+	transactions, err := FetchGroupTransactions(apiKey, addresses)
+	if err != nil {
+		return report, err
+	}
+
+	total := new(big.Int)
+	totalFiat := 0.0
+	var fees []TransactionFee
+	var blocks []uint64
+	seenBlocks := make(map[uint64]bool)
+	for _, tx := range transactions {
+		if !IsGroupMember(tx.FromAddress, addresses) || tx.Timestamp.Before(from) || tx.Timestamp.After(to) {
+			continue
+		}
+		gasUsed := ParseBigInt(tx.GasUsed)
+		gasPrice := ParseBigInt(tx.GasPrice)
+		feeWei := new(big.Int).Mul(gasUsed, gasPrice)
+		fee := TransactionFee{
+			Hash:        tx.ID,
+			Timestamp:   tx.Timestamp,
+			To:          tx.ToAddress,
+			Method:      MethodName(tx),
+			GasUsed:     gasUsed.Uint64(),
+			GasPrice:    gas.WeiToGwei(gasPrice),
+			Fee:         WeiToEther(feeWei),
+			BlockHeight: tx.BlockHeight,
+			feeWei:      feeWei,
+			gasPriceWei: gasPrice,
+		}
+		total.Add(total, feeWei)
+
+		price, err := provider.HistoricalPrice(prices.ETH, currency, tx.Timestamp)
+		if err == nil {
+			feeFiat := fee.Fee * price
+			fee.price, fee.FeeFiat = &price, &feeFiat
+			totalFiat += feeFiat
+		} else if errors.Is(err, prices.ErrPriceNotFound) {
+			report.MissingPrices++
+		} else {
+			return report, err
+		}
+
+		if !seenBlocks[tx.BlockHeight] {
+			seenBlocks[tx.BlockHeight] = true
+			blocks = append(blocks, tx.BlockHeight)
+		}
+		fees = append(fees, fee)
+	}
+
+	report.Transactions = len(fees)
+	report.TotalFees = WeiToEther(total)
+	report.TotalFeesFiat = totalFiat
+	if client != nil {
+		overpaid, overpaidFiat, err := estimateOverpaid(client, fees, blocks)
+		if err != nil {
+			return report, err
+		}
+		report.Overpaid = &overpaid
+		report.OverpaidFiat = &overpaidFiat
+	}
+
+	report.ByMonth = groupFees(fees, func(fee TransactionFee) string { return fee.Timestamp.UTC().Format("2006-01") })
+	report.ByContract = groupFees(fees, func(fee TransactionFee) string { return strings.ToLower(fee.To) })
+	report.ByMethod = groupFees(fees, func(fee TransactionFee) string { return fee.Method })
+	sort.Slice(report.ByMonth, func(i, j int) bool { return report.ByMonth[i].Key < report.ByMonth[j].Key })
+
+	sort.Slice(fees, func(i, j int) bool { return fees[i].feeWei.Cmp(fees[j].feeWei) > 0 })
+	if len(fees) > mostExpensiveCount {
+		fees = fees[:mostExpensiveCount]
+	}
+	report.MostExpensive = fees
+	if report.MostExpensive == nil {
+		report.MostExpensive = []TransactionFee{}
+	}
+	return report, nil
+}
+
+// Set what each fee paid above its block's base fee, looking the distinct blocks up in batches.
+// Returns the total in ETH and in fiat, the latter without the fees of unknown price.
+func estimateOverpaid(client *node.Client, fees []TransactionFee, blocks []uint64) (float64, float64, error) {
+	headers, err := client.BlocksByNumber(blocks)
+	if err != nil {
+		return 0, 0, err
+	}
+	baseFees := make(map[uint64]*big.Int, len(blocks))
+	for i, number := range blocks {
+		baseFees[number] = new(big.Int)
+		if headers[i] != nil {
+			baseFees[number] = node.ParseBig(headers[i].BaseFeePerGas)
+		}
+	}
+
+	overpaid := new(big.Int)
+	overpaidFiat := 0.0
+	for i := range fees {
+		fee := &fees[i]
+		baseFee := baseFees[fee.BlockHeight]
+		// Only the part of the price above the base fee was up to the sender
+		above := new(big.Int).Sub(fee.gasPriceWei, baseFee)
+		if above.Sign() < 0 {
+			above.SetInt64(0)
+		}
+		fee.overpaidWei = above.Mul(above, new(big.Int).SetUint64(fee.GasUsed))
+		baseFeeGwei := gas.WeiToGwei(baseFee)
+		overpaidEther := WeiToEther(fee.overpaidWei)
+		fee.BaseFee = &baseFeeGwei
+		fee.Overpaid = &overpaidEther
+		overpaid.Add(overpaid, fee.overpaidWei)
+		if fee.price != nil {
+			overpaidFiat += overpaidEther * *fee.price
+		}
+	}
+	return WeiToEther(overpaid), overpaidFiat, nil
+}
+
+// Sum fees per key, most expensive group first
+func groupFees(fees []TransactionFee, key func(TransactionFee) string) []SpendGroup {
+	totals := make(map[string]*big.Int)
+	fiat := make(map[string]float64)
+	overpaid := make(map[string]*big.Int)
+	counts := make(map[string]int)
+	for _, fee := range fees {
+		k := key(fee)
+		if totals[k] == nil {
+			totals[k] = new(big.Int)
+		}
+		totals[k].Add(totals[k], fee.feeWei)
+		if fee.FeeFiat != nil {
+			fiat[k] += *fee.FeeFiat
+		}
+		counts[k]++
+		if fee.overpaidWei != nil {
+			if overpaid[k] == nil {
+				overpaid[k] = new(big.Int)
+			}
+			overpaid[k].Add(overpaid[k], fee.overpaidWei)
+		}
+	}
+
+	groups := make([]SpendGroup, 0, len(totals))
+	for k, total := range totals {
+		group := SpendGroup{Key: k, Transactions: counts[k], Fees: WeiToEther(total), FeesFiat: fiat[k]}
+		if overpaid[k] != nil {
+			value := WeiToEther(overpaid[k])
+			group.Overpaid = &value
+		}
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Fees != groups[j].Fees {
+			return groups[i].Fees > groups[j].Fees
+		}
+		return groups[i].Key < groups[j].Key
+	})
+	return groups
+}
+
+// GET /api/v1/gas/spend?address={address}&from={date}&to={date}&currency={currency}
+// GET /api/v1/gas/spend?group={id}&from={date}&to={date}&currency={currency}
+func GasSpendHandler(apiKey string, client *node.Client, provider prices.PriceProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if provider == nil {
+			http.Error(w, "price provider not configured", http.StatusServiceUnavailable)
+			return
+		}
+		addresses, ok := RequireAddresses(w, r.URL.Query())
+		if !ok {
+			return
+		}
+		from, to, err := ParsePeriod(r.URL.Query(), 365*24*time.Hour)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		currency := r.URL.Query().Get("currency")
+		if currency == "" {
+			currency = prices.DefaultCurrency
+		}
+
+		report, err := AnalyzeGasSpend(apiKey, client, provider, addresses, from, to, currency)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error analyzing gas spend: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
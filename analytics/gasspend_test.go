@@ -0,0 +1,203 @@
+package analytics
+
+import (
+	"encoding/json"
+	"ethereye/internal/testutil"
+	"ethereye/node"
+	"ethereye/prices"
+	. "ethereye/transactions"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+/************
+common
+************/
+
+const wallet = "0x1111111111111111111111111111111111111111"
+
+type fakeGroups map[string][]string
+
+func (g fakeGroups) GroupAddresses(id string) ([]string, bool) {
+	members, ok := g[id]
+	return members, ok
+}
+
+// Fake Etherscan answering each account list action with the given records. Other actions find no transactions.
+func useFakeEtherscan(t *testing.T, records map[string][]map[string]string) {
+	testutil.UseFakeEtherscan(t, func(query url.Values) interface{} {
+		return testutil.ListResponse(records[query.Get("action")])
+	})
+}
+
+// Price provider with an ETH price per month, e.g. "2024-01", and no other prices
+type monthlyPrices map[string]float64
+
+func (p monthlyPrices) SpotPrices(tokens []string, currency string) (map[string]float64, error) {
+	return map[string]float64{}, nil
+}
+
+func (p monthlyPrices) HistoricalPrice(token, currency string, at time.Time) (float64, error) {
+	price, ok := p[at.UTC().Format("2006-01")]
+	if !ok || token != prices.ETH {
+		return 0, prices.ErrPriceNotFound
+	}
+	return price, nil
+}
+
+// Fake node returning blocks with the given base fees in wei
+func newBaseFeeNode(t *testing.T, baseFees map[uint64]int64) *node.Client {
+	return testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+		"eth_getBlockByNumber": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+			var tag string
+			json.Unmarshal(params[0], &tag)
+			number := node.ParseUint(tag)
+			return map[string]string{"number": node.EncodeUint(number), "baseFeePerGas": fmt.Sprintf("0x%x", baseFees[number])}, nil
+		},
+	})
+}
+
+func tx(hash, from, to string, block uint64, timestamp time.Time, gasUsed, gasPrice, functionName string) map[string]string {
+	return map[string]string{
+		"hash":             hash,
+		"from":             from,
+		"to":               to,
+		"value":            "0",
+		"gasPrice":         gasPrice,
+		"gasUsed":          gasUsed,
+		"nonce":            "0",
+		"blockNumber":      fmt.Sprint(block),
+		"blockHash":        "0x",
+		"timeStamp":        fmt.Sprint(timestamp.Unix()),
+		"txreceipt_status": "1",
+		"methodId":         "0x",
+		"functionName":     functionName,
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+/************
+test body
+************/
+
+func TestAnalyzeGasSpend(t *testing.T) {
+	router := "0x2222222222222222222222222222222222222222"
+	jan := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)
+	useFakeEtherscan(t, map[string][]map[string]string{"txlist": {
+		// 21000 gas at 20 gwei: 0.00042 ETH
+		tx("0xa", wallet, "0x3333333333333333333333333333333333333333", 1, jan, "21000", "20000000000", ""),
+		// 100000 gas at 30 gwei: 0.003 ETH
+		tx("0xb", wallet, router, 2, feb, "100000", "30000000000", "swap(uint256 amountIn)"),
+		// Incoming, not paid by the wallet
+		tx("0xc", router, wallet, 3, feb, "50000", "30000000000", ""),
+		// Outside the period
+		tx("0xd", wallet, router, 4, feb.AddDate(1, 0, 0), "100000", "30000000000", "swap(uint256 amountIn)"),
+	}})
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)
+	provider := monthlyPrices{"2024-01": 2000, "2024-02": 3000}
+
+	t.Run("Test without node backend", func(t *testing.T) {
+		report, err := AnalyzeGasSpend("", nil, provider, []string{wallet}, from, to, "usd")
+		if err != nil {
+			t.Fatalf("AnalyzeGasSpend returned error: %v", err)
+		}
+		if report.Transactions != 2 {
+			t.Errorf("Expected 2 transactions, got %d", report.Transactions)
+		}
+		// Valued at 2000 in January and 3000 in February
+		if !almostEqual(report.TotalFees, 0.00342) || !almostEqual(report.TotalFeesFiat, 9.84) || report.MissingPrices != 0 {
+			t.Errorf("Unexpected totals %f ETH, %f USD", report.TotalFees, report.TotalFeesFiat)
+		}
+		if report.Overpaid != nil {
+			t.Errorf("Expected no overpaid estimate without a node, got %f", *report.Overpaid)
+		}
+		if len(report.ByMonth) != 2 || report.ByMonth[0].Key != "2024-01" || report.ByMonth[1].Key != "2024-02" {
+			t.Errorf("Unexpected monthly breakdown %+v", report.ByMonth)
+		}
+		if len(report.ByMethod) != 2 || report.ByMethod[0].Key != "swap" || report.ByMethod[1].Key != "transfer" {
+			t.Errorf("Unexpected method breakdown %+v", report.ByMethod)
+		}
+		if len(report.ByContract) != 2 || report.ByContract[0].Key != router {
+			t.Errorf("Unexpected contract breakdown %+v", report.ByContract)
+		}
+		if len(report.MostExpensive) != 2 || report.MostExpensive[0].Hash != "0xb" {
+			t.Errorf("Unexpected most expensive transactions %+v", report.MostExpensive)
+		}
+	})
+
+	t.Run("Test with node backend", func(t *testing.T) {
+		client := newBaseFeeNode(t, map[uint64]int64{1: 15000000000, 2: 25000000000})
+		report, err := AnalyzeGasSpend("", client, provider, []string{wallet}, from, to, "usd")
+		if err != nil {
+			t.Fatalf("AnalyzeGasSpend returned error: %v", err)
+		}
+		// 21000 x 5 gwei + 100000 x 5 gwei
+		if report.Overpaid == nil || !almostEqual(*report.Overpaid, 0.000605) || !almostEqual(*report.OverpaidFiat, 1.71) {
+			t.Errorf("Unexpected overpaid estimate %v, %v", report.Overpaid, report.OverpaidFiat)
+		}
+		if fee := report.MostExpensive[0]; fee.BaseFee == nil || !almostEqual(*fee.BaseFee, 25) {
+			t.Errorf("Unexpected base fee %v", fee.BaseFee)
+		}
+	})
+
+	t.Run("Test with a missing price", func(t *testing.T) {
+		report, err := AnalyzeGasSpend("", nil, monthlyPrices{"2024-01": 2000}, []string{wallet}, from, to, "usd")
+		if err != nil {
+			t.Fatalf("AnalyzeGasSpend returned error: %v", err)
+		}
+		if report.MissingPrices != 1 || !almostEqual(report.TotalFeesFiat, 0.84) || report.MostExpensive[0].FeeFiat != nil {
+			t.Errorf("Expected the February fee without a fiat value, got %+v", report)
+		}
+	})
+
+	t.Run("Test with group", func(t *testing.T) {
+		report, err := AnalyzeGasSpend("", nil, provider, []string{wallet, router}, from, to, "usd")
+		if err != nil {
+			t.Fatalf("AnalyzeGasSpend returned error: %v", err)
+		}
+		// The incoming transaction is paid by the router, another member
+		if report.Transactions != 3 || !almostEqual(report.TotalFees, 0.00492) || len(report.Addresses) != 2 || report.Address != "" {
+			t.Errorf("Unexpected group report %+v", report)
+		}
+	})
+}
+
+func TestGasSpendHandler(t *testing.T) {
+	useFakeEtherscan(t, nil)
+	UseGroups(fakeGroups{"treasury": {wallet}})
+	defer UseGroups(nil)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"Test with missing address", "", http.StatusBadRequest},
+		{"Test with invalid date", "?address=" + wallet + "&from=yesterday", http.StatusBadRequest},
+		{"Test with reversed period", "?address=" + wallet + "&from=2024-02-01&to=2024-01-01", http.StatusBadRequest},
+		{"Test with valid period", "?address=" + wallet + "&from=2024-01-01&to=2024-01-31", http.StatusOK},
+		{"Test with unknown group", "?group=missing", http.StatusNotFound},
+		{"Test with group", "?group=treasury", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/api/v1/gas/spend"+test.query, nil)
+			recorder := httptest.NewRecorder()
+			GasSpendHandler("", nil, monthlyPrices{}).ServeHTTP(recorder, request)
+			if recorder.Code != test.expected {
+				t.Errorf("Expected status code %d, got %d", test.expected, recorder.Code)
+			}
+		})
+	}
+}
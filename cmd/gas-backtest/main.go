@@ -0,0 +1,35 @@
+// Reports the forecast error of the gas fee model on a stored gas history
+package main
+
+import (
+	"encoding/json"
+	"ethereye/gas"
+	"flag"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+	filename := flag.String("file", "gas_history.json", "gas history store written by the API")
+	days := flag.Int("days", 7, "number of most recent days to forecast")
+	horizon := flag.Int("horizon", 1, "forecast horizon in hours")
+	training := flag.Int("training", 48, "minimum hours of history before a forecast is scored")
+	flag.Parse()
+
+	store := gas.NewHistoryStore(*filename)
+	if err := store.Load(); err != nil {
+		log.Fatalf("Failed to load gas history: %v", err)
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-time.Duration(*days) * 24 * time.Hour)
+	report, err := gas.Backtest(store, from, to, *horizon, *training)
+	if err != nil {
+		log.Fatalf("Backtest failed: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+}
@@ -6,18 +6,31 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 )
 
 type AddressStorage struct {
 	filename  string
+	mu        sync.RWMutex
 	addresses map[string][]string
+	labels    map[string]string
+}
+
+// Stored favorites. Labels are keyed by lowercased address.
+type addressFile struct {
+	Addresses map[string][]string `json:"addresses"`
+	Labels    map[string]string   `json:"labels,omitempty"`
 }
 
 func NewAddressStorage(filename string) *AddressStorage {
-	return &AddressStorage{filename: filename, addresses: make(map[string][]string)}
+	return &AddressStorage{filename: filename, addresses: make(map[string][]string), labels: make(map[string]string)}
 }
 
 func (s *AddressStorage) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	data, err := ioutil.ReadFile(s.filename)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -26,11 +39,22 @@ func (s *AddressStorage) Load() error {
 		return err
 	}
 
+	var file addressFile
+	if err := json.Unmarshal(data, &file); err == nil && file.Addresses != nil {
+		s.addresses = file.Addresses
+		if file.Labels != nil {
+			s.labels = file.Labels
+		}
+		return nil
+	}
+	// Files written before labels were added only hold the address lists
 	return json.Unmarshal(data, &s.addresses)
 }
 
 func (s *AddressStorage) Save() error {
-	data, err := json.Marshal(s.addresses)
+	s.mu.RLock()
+	data, err := json.Marshal(addressFile{Addresses: s.addresses, Labels: s.labels})
+	s.mu.RUnlock()
 	if err != nil {
 		return err
 	}
@@ -38,12 +62,43 @@ func (s *AddressStorage) Save() error {
 	return ioutil.WriteFile(s.filename, data, 0644)
 }
 
-func (s *AddressStorage) AddFavoriteAddress(addressType, address string) {
+// Add the address to the favorites of the type. The label, if given, replaces any previous one.
+func (s *AddressStorage) AddFavoriteAddress(addressType, address, label string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if label != "" {
+		s.labels[strings.ToLower(address)] = label
+	}
+	for _, favorite := range s.addresses[addressType] {
+		if strings.EqualFold(favorite, address) {
+			return
+		}
+	}
 	s.addresses[addressType] = append(s.addresses[addressType], address)
 }
 
+// Label saved with a favorite address, or "" if it has none
+func (s *AddressStorage) Label(address string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.labels[strings.ToLower(address)]
+}
+
 func (s *AddressStorage) GetFavoriteAddresses(addressType string) []string {
-	return s.addresses[addressType]
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.addresses[addressType]...)
+}
+
+// Labels of the favorite addresses, keyed by lowercased address
+func (s *AddressStorage) Labels() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	labels := make(map[string]string, len(s.labels))
+	for address, label := range s.labels {
+		labels[address] = label
+	}
+	return labels
 }
 
 func FavoriteAddressHandler(s *AddressStorage) http.HandlerFunc {
@@ -71,13 +126,14 @@ func FavoriteAddressHandler(s *AddressStorage) http.HandlerFunc {
 		case http.MethodPost:
 			var requestBody struct {
 				Address string `json:"address"`
+				Label   string `json:"label"`
 			}
 			err := json.NewDecoder(r.Body).Decode(&requestBody)
 			if err != nil {
 				http.Error(w, "Invalid request body", http.StatusBadRequest)
 				return
 			}
-			s.AddFavoriteAddress(addressType, requestBody.Address)
+			s.AddFavoriteAddress(addressType, requestBody.Address, requestBody.Label)
 			if err := s.Save(); err != nil {
 				http.Error(w, "Failed to save favorite address", http.StatusInternalServerError)
 				return
@@ -53,3 +53,47 @@ func TestFavoriteAddressHandler(t *testing.T) {
 		t.Errorf("Unexpected favorite wallet addresses: %v", addresses)
 	}
 }
+
+func TestFavoriteAddressLabels(t *testing.T) {
+	address := "0x1111111111111111111111111111111111111111"
+	storage := NewAddressStorage("test_labels.json")
+	defer os.Remove("test_labels.json")
+	handler := FavoriteAddressHandler(storage)
+
+	for _, label := range []string{"Cold storage", "Savings"} {
+		requestBody, _ := json.Marshal(map[string]string{"address": address, "label": label})
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/favorites?type=wallet", bytes.NewReader(requestBody)))
+		if status := rr.Code; status != http.StatusCreated {
+			t.Errorf("Expected status code %d, got %d", http.StatusCreated, status)
+		}
+	}
+	if addresses := storage.GetFavoriteAddresses("wallet"); len(addresses) != 1 {
+		t.Errorf("Expected the address to be saved once, got %v", addresses)
+	}
+
+	reloaded := NewAddressStorage("test_labels.json")
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Failed to load favorites: %v", err)
+	}
+	if label := reloaded.Label("0x1111111111111111111111111111111111111111"); label != "Savings" {
+		t.Errorf("Expected label Savings, got %q", label)
+	}
+}
+
+func TestLoadLegacyFavorites(t *testing.T) {
+	address := "0x1111111111111111111111111111111111111111"
+	ioutil.WriteFile("test_legacy.json", []byte(`{"wallet": ["`+address+`"]}`), 0644)
+	defer os.Remove("test_legacy.json")
+
+	storage := NewAddressStorage("test_legacy.json")
+	if err := storage.Load(); err != nil {
+		t.Fatalf("Failed to load favorites: %v", err)
+	}
+	if addresses := storage.GetFavoriteAddresses("wallet"); len(addresses) != 1 || addresses[0] != address {
+		t.Errorf("Unexpected favorite wallet addresses: %v", addresses)
+	}
+	if label := storage.Label(address); label != "" {
+		t.Errorf("Expected no label, got %q", label)
+	}
+}
@@ -0,0 +1,264 @@
+package favorites
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	. "ethereye/utils"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/******************
+Wallet Groups
+******************/
+
+// Chain of a group member unless given. Only Ethereum members are aggregated by the API.
+const DefaultChain = "ethereum"
+
+type GroupMember struct {
+	Address string `json:"address"`
+	Chain   string `json:"chain"`
+}
+
+// Named set of wallets managed together, e.g. "Treasury" or "Personal"
+type WalletGroup struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Members []GroupMember `json:"members"`
+}
+
+var ErrGroupNotFound = errors.New("group not found")
+
+type GroupStorage struct {
+	filename string
+	mu       sync.RWMutex
+	groups   map[string]WalletGroup
+}
+
+func NewGroupStorage(filename string) *GroupStorage {
+	return &GroupStorage{filename: filename, groups: make(map[string]WalletGroup)}
+}
+
+func (s *GroupStorage) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := ioutil.ReadFile(s.filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, &s.groups)
+}
+
+func (s *GroupStorage) Save() error {
+	s.mu.RLock()
+	data, err := json.Marshal(s.groups)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.filename, data, 0644)
+}
+
+// All groups ordered by name
+func (s *GroupStorage) List() []WalletGroup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	groups := make([]WalletGroup, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, copyGroup(group))
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+func (s *GroupStorage) Get(id string) (WalletGroup, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	group, ok := s.groups[id]
+	return copyGroup(group), ok
+}
+
+func (s *GroupStorage) Create(name string, members []GroupMember) (WalletGroup, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return WalletGroup{}, err
+	}
+	group := WalletGroup{ID: hex.EncodeToString(id), Name: name, Members: normalizeMembers(members)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups[group.ID] = group
+	return copyGroup(group), nil
+}
+
+func (s *GroupStorage) Update(id, name string, members []GroupMember) (WalletGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.groups[id]; !ok {
+		return WalletGroup{}, ErrGroupNotFound
+	}
+	group := WalletGroup{ID: id, Name: name, Members: normalizeMembers(members)}
+	s.groups[id] = group
+	return copyGroup(group), nil
+}
+
+func (s *GroupStorage) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.groups[id]; !ok {
+		return ErrGroupNotFound
+	}
+	delete(s.groups, id)
+	return nil
+}
+
+// Ethereum addresses of the group's members
+func (s *GroupStorage) GroupAddresses(id string) ([]string, bool) {
+	group, ok := s.Get(id)
+	if !ok {
+		return nil, false
+	}
+	addresses := []string{}
+	for _, member := range group.Members {
+		if member.Chain == DefaultChain {
+			addresses = append(addresses, member.Address)
+		}
+	}
+	return addresses, true
+}
+
+func copyGroup(group WalletGroup) WalletGroup {
+	group.Members = append([]GroupMember(nil), group.Members...)
+	return group
+}
+
+// Lowercase addresses, default chains and drop duplicates
+func normalizeMembers(members []GroupMember) []GroupMember {
+	normalized := []GroupMember{}
+	seen := make(map[GroupMember]bool)
+	for _, member := range members {
+		member.Address = strings.ToLower(strings.TrimSpace(member.Address))
+		member.Chain = strings.ToLower(strings.TrimSpace(member.Chain))
+		if member.Chain == "" {
+			member.Chain = DefaultChain
+		}
+		if !seen[member] {
+			seen[member] = true
+			normalized = append(normalized, member)
+		}
+	}
+	return normalized
+}
+
+type groupRequest struct {
+	Name    string        `json:"name"`
+	Members []GroupMember `json:"members"`
+}
+
+func (request groupRequest) validate() error {
+	if strings.TrimSpace(request.Name) == "" {
+		return fmt.Errorf("missing group name")
+	}
+	for _, member := range request.Members {
+		address := strings.TrimSpace(member.Address)
+		chain := strings.ToLower(strings.TrimSpace(member.Chain))
+		// Addresses on other chains are kept as given
+		if (chain == "" || chain == DefaultChain) && !IsAddress(address) || address == "" {
+			return fmt.Errorf("invalid member address %q", member.Address)
+		}
+	}
+	return nil
+}
+
+// GET    /api/v1/groups           list groups
+// GET    /api/v1/groups?id={id}   get a group
+// POST   /api/v1/groups           create a group
+// PUT    /api/v1/groups?id={id}   replace a group's name and members
+// DELETE /api/v1/groups?id={id}   delete a group
+func GroupsHandler(s *GroupStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+
+		switch r.Method {
+		case http.MethodGet:
+			var response interface{} = s.List()
+			if id != "" {
+				group, ok := s.Get(id)
+				if !ok {
+					http.Error(w, ErrGroupNotFound.Error(), http.StatusNotFound)
+					return
+				}
+				response = group
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+
+		case http.MethodPost, http.MethodPut:
+			var request groupRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if err := request.validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			var group WalletGroup
+			var err error
+			status := http.StatusCreated
+			if r.Method == http.MethodPost {
+				group, err = s.Create(strings.TrimSpace(request.Name), request.Members)
+			} else {
+				if id == "" {
+					http.Error(w, "Missing 'id' query parameter", http.StatusBadRequest)
+					return
+				}
+				group, err = s.Update(id, strings.TrimSpace(request.Name), request.Members)
+				status = http.StatusOK
+			}
+			if errors.Is(err, ErrGroupNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to save group", http.StatusInternalServerError)
+				return
+			}
+			if err := s.Save(); err != nil {
+				http.Error(w, "Failed to save group", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(group)
+
+		case http.MethodDelete:
+			if err := s.Delete(id); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err := s.Save(); err != nil {
+				http.Error(w, "Failed to delete group", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package favorites
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupsHandler(t *testing.T) {
+	storage := NewGroupStorage(filepath.Join(t.TempDir(), "groups.json"))
+	handler := GroupsHandler(storage)
+	serve := func(method, query string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, "/api/v1/groups"+query, bytes.NewReader(data)))
+		return rr
+	}
+	members := []GroupMember{
+		{Address: "0x1111111111111111111111111111111111111111"},
+		{Address: "0x2222222222222222222222222222222222222222", Chain: "Ethereum"},
+		{Address: "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq", Chain: "bitcoin"},
+	}
+
+	// Test creating a group
+	rr := serve(http.MethodPost, "", map[string]interface{}{"name": "Treasury", "members": members})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, rr.Code)
+	}
+	var group WalletGroup
+	json.NewDecoder(rr.Body).Decode(&group)
+	if group.ID == "" || group.Name != "Treasury" || len(group.Members) != 3 || group.Members[1].Chain != DefaultChain {
+		t.Errorf("Unexpected group %+v", group)
+	}
+	addresses, ok := storage.GroupAddresses(group.ID)
+	if !ok || len(addresses) != 2 {
+		t.Errorf("Expected the two Ethereum members, got %v", addresses)
+	}
+
+	// Test validation
+	tests := []struct {
+		name     string
+		method   string
+		query    string
+		body     interface{}
+		expected int
+	}{
+		{"Test with missing name", http.MethodPost, "", map[string]interface{}{"members": members}, http.StatusBadRequest},
+		{"Test with invalid member", http.MethodPost, "", map[string]interface{}{"name": "Bad", "members": []GroupMember{{Address: "0x123"}}}, http.StatusBadRequest},
+		{"Test with unknown group", http.MethodPut, "?id=missing", map[string]interface{}{"name": "Other"}, http.StatusNotFound},
+		{"Test with renamed group", http.MethodPut, "?id=" + group.ID, map[string]interface{}{"name": "Personal", "members": members[:1]}, http.StatusOK},
+		{"Test with listing", http.MethodGet, "", nil, http.StatusOK},
+		{"Test with deleted group", http.MethodDelete, "?id=" + group.ID, nil, http.StatusNoContent},
+		{"Test with deleted group lookup", http.MethodGet, "?id=" + group.ID, nil, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := serve(test.method, test.query, test.body)
+			if rr.Code != test.expected {
+				t.Errorf("Expected status code %d, got %d", test.expected, rr.Code)
+			}
+		})
+	}
+
+	// Test the groups are persisted
+	reloaded := NewGroupStorage(storage.filename)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(reloaded.List()) != 0 {
+		t.Errorf("Expected no groups after deletion, got %+v", reloaded.List())
+	}
+}
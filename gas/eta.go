@@ -0,0 +1,171 @@
+package gas
+
+import (
+	"encoding/json"
+	"ethereye/node"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/******************
+Confirmation Time
+******************/
+
+// Percentile of included priority fees a transaction must match to count as includable in a block
+const inclusionPercentile = 5
+
+// Blocks of history the inclusion model looks at
+const DefaultInclusionWindow = 100
+
+// Distribution of the wait before a transaction is included
+type WaitEstimate struct {
+	MaxFeePerGas         float64 `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas float64 `json:"maxPriorityFeePerGas"`
+	// Share of recent blocks that would have included the transaction
+	InclusionProbability float64 `json:"inclusionProbability"`
+	P50Blocks            *int    `json:"p50Blocks"`
+	P90Blocks            *int    `json:"p90Blocks"`
+	P50Seconds           *int    `json:"p50Seconds"`
+	P90Seconds           *int    `json:"p90Seconds"`
+	BlocksSampled        int     `json:"blocksSampled"`
+}
+
+// Base fee and cheapest included priority fee of a block, in gwei
+type blockInclusion struct {
+	baseFee float64
+	minTip  float64
+}
+
+// Rolling model of which priority fees were included in recent blocks
+type InclusionModel struct {
+	client *node.Client
+	window uint64
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	blocks    []blockInclusion
+	fetchedAt time.Time
+}
+
+func NewInclusionModel(client *node.Client, window uint64) *InclusionModel {
+	return &InclusionModel{client: client, window: window, ttl: SecondsPerBlock * time.Second}
+}
+
+// Reload the window of recent blocks from the node
+func (m *InclusionModel) Refresh() error {
+	history, err := m.client.FeeHistory(m.window, "latest", []float64{inclusionPercentile})
+	if err != nil {
+		return err
+	}
+
+	blocks := make([]blockInclusion, 0, len(history.Reward))
+	for i, rewards := range history.Reward {
+		// Empty blocks report zero rewards and say nothing about competition
+		if i >= len(history.BaseFeePerGas) || len(rewards) == 0 || (i < len(history.GasUsedRatio) && history.GasUsedRatio[i] == 0) {
+			continue
+		}
+		blocks = append(blocks, blockInclusion{
+			baseFee: WeiToGwei(node.ParseBig(history.BaseFeePerGas[i])),
+			minTip:  WeiToGwei(node.ParseBig(rewards[0])),
+		})
+	}
+
+	m.mu.Lock()
+	m.blocks = blocks
+	m.fetchedAt = time.Now()
+	m.mu.Unlock()
+	return nil
+}
+
+// Estimate the wait for a transaction with the given fee cap and priority fee, in gwei
+func (m *InclusionModel) Estimate(maxFee, priorityFee float64) (WaitEstimate, error) {
+	m.mu.Lock()
+	stale := m.blocks == nil || time.Since(m.fetchedAt) >= m.ttl
+	m.mu.Unlock()
+	if stale {
+		if err := m.Refresh(); err != nil {
+			return WaitEstimate{}, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return estimateWait(m.blocks, maxFee, priorityFee), nil
+}
+
+func estimateWait(blocks []blockInclusion, maxFee, priorityFee float64) WaitEstimate {
+	estimate := WaitEstimate{MaxFeePerGas: maxFee, MaxPriorityFeePerGas: priorityFee, BlocksSampled: len(blocks)}
+	if len(blocks) == 0 {
+		return estimate
+	}
+
+	included := 0
+	for _, block := range blocks {
+		if maxFee < block.baseFee {
+			continue
+		}
+		// The tip actually paid is capped by what the fee cap leaves above the base fee
+		tip := math.Min(priorityFee, maxFee-block.baseFee)
+		if tip >= block.minTip {
+			included++
+		}
+	}
+	probability := float64(included) / float64(len(blocks))
+	estimate.InclusionProbability = probability
+	if probability == 0 {
+		return estimate
+	}
+
+	// Each block is treated as an independent chance of inclusion, giving a geometric wait
+	quantile := func(q float64) *int {
+		blocks := 1
+		if probability < 1 {
+			blocks = int(math.Ceil(math.Log(1-q) / math.Log(1-probability)))
+			if blocks < 1 {
+				blocks = 1
+			}
+		}
+		return &blocks
+	}
+	estimate.P50Blocks = quantile(0.5)
+	estimate.P90Blocks = quantile(0.9)
+	p50Seconds := *estimate.P50Blocks * SecondsPerBlock
+	p90Seconds := *estimate.P90Blocks * SecondsPerBlock
+	estimate.P50Seconds = &p50Seconds
+	estimate.P90Seconds = &p90Seconds
+	return estimate
+}
+
+// GET /api/v1/gas/eta?maxFee={gwei}&priorityFee={gwei}
+func ETAHandler(model *InclusionModel) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if model == nil {
+			http.Error(w, "node backend not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		maxFee, err := strconv.ParseFloat(r.URL.Query().Get("maxFee"), 64)
+		if err != nil || maxFee <= 0 {
+			http.Error(w, "Missing or invalid 'maxFee' query parameter", http.StatusBadRequest)
+			return
+		}
+		priorityFee, err := strconv.ParseFloat(r.URL.Query().Get("priorityFee"), 64)
+		if err != nil || priorityFee < 0 {
+			http.Error(w, "Missing or invalid 'priorityFee' query parameter", http.StatusBadRequest)
+			return
+		}
+
+		estimate, err := model.Estimate(maxFee, priorityFee)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error estimating confirmation time: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(estimate)
+	}
+}
@@ -0,0 +1,59 @@
+package gas
+
+import (
+	"ethereye/internal/testutil"
+	"testing"
+)
+
+func TestEstimateWait(t *testing.T) {
+	// Base fee of 10 gwei, half of the blocks only include tips of 2 gwei and more
+	blocks := []blockInclusion{{10, 1}, {10, 2}, {10, 1}, {10, 2}}
+
+	t.Run("Test with a competitive fee", func(t *testing.T) {
+		estimate := estimateWait(blocks, 20, 2)
+		if estimate.InclusionProbability != 1 || *estimate.P50Blocks != 1 || *estimate.P90Blocks != 1 || *estimate.P90Seconds != SecondsPerBlock {
+			t.Errorf("Unexpected estimate: %+v", estimate)
+		}
+	})
+
+	t.Run("Test with a fee matching half of the blocks", func(t *testing.T) {
+		estimate := estimateWait(blocks, 20, 1)
+		if estimate.InclusionProbability != 0.5 || *estimate.P50Blocks != 1 || *estimate.P90Blocks != 4 {
+			t.Errorf("Unexpected estimate: %+v", estimate)
+		}
+	})
+
+	t.Run("Test with a fee cap below the base fee", func(t *testing.T) {
+		estimate := estimateWait(blocks, 9, 5)
+		if estimate.InclusionProbability != 0 || estimate.P50Blocks != nil {
+			t.Errorf("Unexpected estimate: %+v", estimate)
+		}
+	})
+
+	t.Run("Test with a fee cap limiting the tip", func(t *testing.T) {
+		estimate := estimateWait(blocks, 11.5, 5)
+		if estimate.InclusionProbability != 0.5 {
+			t.Errorf("Unexpected estimate: %+v", estimate)
+		}
+	})
+}
+
+func TestInclusionModel(t *testing.T) {
+	client := testutil.NewFakeNode(t, testutil.Results(map[string]interface{}{
+		"eth_feeHistory": map[string]interface{}{
+			"oldestBlock":   "0x1",
+			"baseFeePerGas": []string{"0x2540be400", "0x2540be400", "0x2540be400"},
+			"gasUsedRatio":  []float64{0.5, 0},
+			"reward":        [][]string{{"0x3b9aca00"}, {"0x0"}},
+		},
+	}))
+
+	estimate, err := NewInclusionModel(client, 2).Estimate(20, 1)
+	if err != nil {
+		t.Fatalf("Estimate() returned an error: %v", err)
+	}
+	// The empty block is ignored
+	if estimate.BlocksSampled != 1 || estimate.InclusionProbability != 1 {
+		t.Errorf("Unexpected estimate: %+v", estimate)
+	}
+}
@@ -0,0 +1,288 @@
+package gas
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/******************
+Forecasting
+******************/
+
+// Smoothing factor of the deseasonalized hourly level
+const smoothingAlpha = 0.3
+
+// Two-sided 80% band under normal errors
+const bandZ = 1.2816
+
+const hoursPerWeek = 7 * 24
+
+// Blocks forecast with the deterministic EIP-1559 rule
+const forecastBlocks = 5
+
+var errNoHistory = errors.New("not enough gas history to forecast")
+
+type BlockForecast struct {
+	Block   uint64  `json:"block"`
+	BaseFee float64 `json:"baseFee"`
+	Lower   float64 `json:"lower"`
+	Upper   float64 `json:"upper"`
+}
+
+type HourForecast struct {
+	Time    time.Time `json:"time"`
+	BaseFee float64   `json:"baseFee"`
+	Lower   float64   `json:"lower"`
+	Upper   float64   `json:"upper"`
+}
+
+// Cheapest forecast hour and how much it saves compared to the next block
+type BestTime struct {
+	Time           time.Time `json:"time"`
+	BaseFee        float64   `json:"baseFee"`
+	SavingsPercent float64   `json:"savingsPercent"`
+}
+
+// Base fee predictions in gwei. Hourly bands cover 80% of the expected outcomes.
+type Forecast struct {
+	GeneratedAt time.Time       `json:"generatedAt"`
+	Confidence  float64         `json:"confidence"`
+	NextBlocks  []BlockForecast `json:"nextBlocks"`
+	Hourly      []HourForecast  `json:"hourly"`
+	BestTime    *BestTime       `json:"bestTime,omitempty"`
+}
+
+func hourOfWeek(t time.Time) int {
+	t = t.UTC()
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+// Hour-of-week seasonality with exponential smoothing of the deseasonalized level
+type seasonalModel struct {
+	seasonal [hoursPerWeek]float64
+	level    float64
+	sigma    float64
+}
+
+// Fit the model to hourly buckets, oldest first
+func fitSeasonal(buckets []Bucket) (seasonalModel, bool) {
+	var model seasonalModel
+	if len(buckets) < 2 {
+		return model, false
+	}
+
+	var sums [hoursPerWeek]float64
+	var counts [hoursPerWeek]int
+	total := 0.0
+	for _, bucket := range buckets {
+		how := hourOfWeek(bucket.Start)
+		sums[how] += bucket.BaseFeeAvg
+		counts[how]++
+		total += bucket.BaseFeeAvg
+	}
+	mean := total / float64(len(buckets))
+	if mean <= 0 {
+		return model, false
+	}
+	// Hours never observed get no seasonal adjustment
+	for how := range model.seasonal {
+		model.seasonal[how] = 1
+		if counts[how] > 0 {
+			model.seasonal[how] = sums[how] / float64(counts[how]) / mean
+		}
+	}
+
+	squared := 0.0
+	for i, bucket := range buckets {
+		index := model.seasonal[hourOfWeek(bucket.Start)]
+		deseasonalized := bucket.BaseFeeAvg / index
+		if i == 0 {
+			model.level = deseasonalized
+			continue
+		}
+		residual := bucket.BaseFeeAvg - model.level*index
+		squared += residual * residual
+		model.level = smoothingAlpha*deseasonalized + (1-smoothingAlpha)*model.level
+	}
+	model.sigma = math.Sqrt(squared / float64(len(buckets)-1))
+	return model, true
+}
+
+// Prediction and 80% band for the hour, h hours past the last observation
+func (m seasonalModel) predict(at time.Time, h int) (float64, float64, float64) {
+	value := m.level * m.seasonal[hourOfWeek(at)]
+	// Uncertainty of a smoothed level grows with the horizon
+	spread := bandZ * m.sigma * math.Sqrt(1+float64(h-1)*smoothingAlpha*smoothingAlpha)
+	return value, math.Max(0, value-spread), value + spread
+}
+
+// Forecast the base fee from the history store
+type Forecaster struct {
+	store *HistoryStore
+}
+
+func NewForecaster(store *HistoryStore) *Forecaster {
+	return &Forecaster{store: store}
+}
+
+// Forecast the next blocks and the given number of hours after now
+func (f *Forecaster) Forecast(now time.Time, hours int) (Forecast, error) {
+	forecast := Forecast{GeneratedAt: now, Confidence: 0.8}
+
+	// Short horizon: the next base fee follows from the latest block, later ones move at most 12.5% per block
+	latest, ok := f.store.latestSample()
+	if !ok {
+		return forecast, errNoHistory
+	}
+	next := nextBaseFeeFromRatio(latest.BaseFee, latest.GasUsedRatio)
+	for i := 0; i < forecastBlocks; i++ {
+		forecast.NextBlocks = append(forecast.NextBlocks, BlockForecast{
+			Block:   latest.Block + uint64(i) + 1,
+			BaseFee: next,
+			Lower:   next * math.Pow(0.875, float64(i)),
+			Upper:   next * math.Pow(1.125, float64(i)),
+		})
+	}
+
+	// Longer horizons: hourly seasonality over the retained hourly buckets
+	buckets, err := f.store.Query(now.Add(-Retention[Resolution1h]), now, Resolution1h)
+	if err != nil {
+		return forecast, err
+	}
+	model, ok := fitSeasonal(buckets)
+	if !ok {
+		return forecast, nil
+	}
+
+	start := now.Truncate(time.Hour).Add(time.Hour)
+	for h := 0; h < hours; h++ {
+		at := start.Add(time.Duration(h) * time.Hour)
+		value, lower, upper := model.predict(at, h+1)
+		forecast.Hourly = append(forecast.Hourly, HourForecast{Time: at, BaseFee: value, Lower: lower, Upper: upper})
+	}
+
+	// Best time within the next 24 hours
+	for _, hour := range forecast.Hourly {
+		if hour.Time.Sub(now) > 24*time.Hour {
+			break
+		}
+		if forecast.BestTime == nil || hour.BaseFee < forecast.BestTime.BaseFee {
+			forecast.BestTime = &BestTime{Time: hour.Time, BaseFee: hour.BaseFee}
+		}
+	}
+	if forecast.BestTime != nil && next > 0 {
+		forecast.BestTime.SavingsPercent = math.Max(0, (next-forecast.BestTime.BaseFee)/next*100)
+	}
+	return forecast, nil
+}
+
+func (s *HistoryStore) latestSample() (Sample, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.data.Raw) == 0 {
+		return Sample{}, false
+	}
+	return s.data.Raw[len(s.data.Raw)-1], true
+}
+
+/******************
+Backtesting
+******************/
+
+// Forecast error over stored history
+type BacktestReport struct {
+	HorizonHours int     `json:"horizonHours"`
+	Samples      int     `json:"samples"`
+	MAE          float64 `json:"mae"`
+	RMSE         float64 `json:"rmse"`
+	MAPE         float64 `json:"mape"`
+	// Share of actual values inside the 80% band
+	Coverage float64 `json:"coverage"`
+}
+
+// Forecast every hourly bucket in [from, to] from the buckets before it and compare with the actual value
+func Backtest(store *HistoryStore, from, to time.Time, horizonHours int, minTrainingHours int) (BacktestReport, error) {
+	report := BacktestReport{HorizonHours: horizonHours}
+	buckets, err := store.Query(time.Time{}, to, Resolution1h)
+	if err != nil {
+		return report, err
+	}
+
+	var absolute, squared, percentage float64
+	covered := 0
+	for i, actual := range buckets {
+		if actual.Start.Before(from) {
+			continue
+		}
+		// Train on buckets observed horizonHours before the target
+		cutoff := actual.Start.Add(-time.Duration(horizonHours-1) * time.Hour)
+		training := make([]Bucket, 0, i)
+		for _, bucket := range buckets[:i] {
+			if bucket.Start.Before(cutoff) {
+				training = append(training, bucket)
+			}
+		}
+		if len(training) < minTrainingHours {
+			continue
+		}
+		model, ok := fitSeasonal(training)
+		if !ok {
+			continue
+		}
+
+		predicted, lower, upper := model.predict(actual.Start, horizonHours)
+		diff := predicted - actual.BaseFeeAvg
+		absolute += math.Abs(diff)
+		squared += diff * diff
+		if actual.BaseFeeAvg > 0 {
+			percentage += math.Abs(diff) / actual.BaseFeeAvg
+		}
+		if actual.BaseFeeAvg >= lower && actual.BaseFeeAvg <= upper {
+			covered++
+		}
+		report.Samples++
+	}
+
+	if report.Samples == 0 {
+		return report, errNoHistory
+	}
+	n := float64(report.Samples)
+	report.MAE = absolute / n
+	report.RMSE = math.Sqrt(squared / n)
+	report.MAPE = percentage / n * 100
+	report.Coverage = float64(covered) / n
+	return report, nil
+}
+
+// GET /api/v1/gas/forecast?hours={1-168}
+func ForecastHandler(forecaster *Forecaster) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hours := 24
+		if value := r.URL.Query().Get("hours"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > hoursPerWeek {
+				http.Error(w, "Invalid hours, expected 1 to 168", http.StatusBadRequest)
+				return
+			}
+			hours = parsed
+		}
+
+		forecast, err := forecaster.Forecast(time.Now().UTC(), hours)
+		if errors.Is(err, errNoHistory) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error forecasting gas fees: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(forecast)
+	}
+}
@@ -0,0 +1,71 @@
+package gas
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// Two weeks of hourly samples with a daily cycle: cheapest at 04:00 UTC, most expensive at 16:00
+func seasonalStore(now time.Time) *HistoryStore {
+	store := NewHistoryStore("unused.json")
+	start := now.Truncate(time.Hour).Add(-14 * 24 * time.Hour)
+	var samples []Sample
+	for h := 0; h <= 14*24; h++ {
+		at := start.Add(time.Duration(h) * time.Hour)
+		baseFee := 20 - 10*math.Cos(2*math.Pi*float64(at.Hour()-4)/24)
+		samples = append(samples, Sample{Block: uint64(h + 1), Time: at, BaseFee: baseFee, GasUsedRatio: 1})
+	}
+	store.Add(samples)
+	return store
+}
+
+func TestForecast(t *testing.T) {
+	now := time.Now().UTC()
+	store := seasonalStore(now)
+
+	forecast, err := NewForecaster(store).Forecast(now, 24)
+	if err != nil {
+		t.Fatalf("Forecast() returned an error: %v", err)
+	}
+
+	// Full blocks raise the base fee by 12.5%
+	latest, _ := store.latestSample()
+	if first := forecast.NextBlocks[0]; math.Abs(first.BaseFee-latest.BaseFee*1.125) > 1e-9 || first.Block != latest.Block+1 {
+		t.Errorf("Unexpected next block forecast: %+v", first)
+	}
+	if len(forecast.NextBlocks) != forecastBlocks || forecast.NextBlocks[2].Upper <= forecast.NextBlocks[2].BaseFee {
+		t.Errorf("Unexpected block forecasts: %+v", forecast.NextBlocks)
+	}
+
+	if len(forecast.Hourly) != 24 {
+		t.Fatalf("Expected 24 hourly forecasts, got %d", len(forecast.Hourly))
+	}
+	for _, hour := range forecast.Hourly {
+		if hour.Lower > hour.BaseFee || hour.Upper < hour.BaseFee {
+			t.Errorf("Forecast outside its band: %+v", hour)
+		}
+	}
+	if forecast.BestTime == nil || forecast.BestTime.Time.Hour() != 4 {
+		t.Errorf("Expected the best time at 04:00 UTC, got %+v", forecast.BestTime)
+	}
+}
+
+func TestForecastWithoutHistory(t *testing.T) {
+	if _, err := NewForecaster(NewHistoryStore("unused.json")).Forecast(time.Now(), 24); err != errNoHistory {
+		t.Errorf("Expected errNoHistory, got %v", err)
+	}
+}
+
+func TestBacktest(t *testing.T) {
+	now := time.Now().UTC()
+	store := seasonalStore(now)
+
+	report, err := Backtest(store, now.Add(-3*24*time.Hour), now, 1, 7*24)
+	if err != nil {
+		t.Fatalf("Backtest() returned an error: %v", err)
+	}
+	if report.Samples < 70 || report.MAPE > 5 {
+		t.Errorf("Expected a small error on a purely seasonal series, got %+v", report)
+	}
+}
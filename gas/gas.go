@@ -0,0 +1,274 @@
+package gas
+
+import (
+	"encoding/json"
+	"ethereye/node"
+	. "ethereye/utils"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Percentiles of priority fees used for the low, average and high tiers
+var tierPercentiles = []float64{10, 50, 90}
+
+// Current gas fees. All fees are in gwei.
+type Snapshot struct {
+	BaseFee     float64   `json:"baseFee"`
+	NextBaseFee float64   `json:"nextBaseFee"`
+	Low         float64   `json:"low"`
+	Average     float64   `json:"average"`
+	High        float64   `json:"high"`
+	LastBlock   uint64    `json:"lastBlock"`
+	Source      string    `json:"source"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Upstream providing gas fee snapshots
+type Source interface {
+	Fetch() (Snapshot, error)
+}
+
+/******************
+Units
+******************/
+
+func WeiToGwei(wei *big.Int) float64 {
+	gwei, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e9)).Float64()
+	return gwei
+}
+
+func GweiToWei(gwei float64) *big.Int {
+	wei, _ := new(big.Float).Mul(big.NewFloat(gwei), big.NewFloat(1e9)).Int(nil)
+	return wei
+}
+
+// Base fee of the next block under EIP-1559: it moves by up to 1/8 towards keeping blocks half full
+func NextBaseFee(baseFee *big.Int, gasUsed, gasLimit uint64) *big.Int {
+	target := gasLimit / 2
+	if target == 0 || gasUsed == target {
+		return new(big.Int).Set(baseFee)
+	}
+
+	var diff uint64
+	if gasUsed > target {
+		diff = gasUsed - target
+	} else {
+		diff = target - gasUsed
+	}
+	delta := new(big.Int).Mul(baseFee, new(big.Int).SetUint64(diff))
+	delta.Div(delta, new(big.Int).SetUint64(target))
+	delta.Div(delta, big.NewInt(8))
+
+	if gasUsed > target {
+		if delta.Sign() == 0 {
+			delta.SetInt64(1)
+		}
+		return delta.Add(baseFee, delta)
+	}
+	return delta.Sub(baseFee, delta)
+}
+
+// NextBaseFee for a block whose gas usage is given as a ratio of its limit
+func nextBaseFeeFromRatio(baseFee float64, gasUsedRatio float64) float64 {
+	return baseFee * (1 + (gasUsedRatio-0.5)/4)
+}
+
+/******************
+Sources
+******************/
+
+// Etherscan's gastracker/gasoracle
+type EtherscanSource struct {
+	APIKey string
+}
+
+func (s EtherscanSource) Fetch() (Snapshot, error) {
+	data, err := FetchEtherscan(map[string]string{"module": "gastracker", "action": "gasoracle"}, s.APIKey)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if data["status"] != "1" {
+		return Snapshot{}, fmt.Errorf("error fetching gas oracle: %v", data["result"])
+	}
+	result, ok := data["result"].(map[string]interface{})
+	if !ok {
+		return Snapshot{}, fmt.Errorf("unexpected gas oracle result: %v", data["result"])
+	}
+
+	number := func(key string) float64 {
+		value, _ := strconv.ParseFloat(fmt.Sprint(result[key]), 64)
+		return value
+	}
+	// The suggested base fee is already the pending block's, and the oracle's prices include it
+	nextBaseFee := number("suggestBaseFee")
+	tip := func(key string) float64 {
+		if value := number(key) - nextBaseFee; value > 0 {
+			return value
+		}
+		return 0
+	}
+
+	// The last block's base fee is the one its gas usage moved to the suggested base fee
+	baseFee := nextBaseFee
+	if ratios := strings.Split(fmt.Sprint(result["gasUsedRatio"]), ","); len(ratios) > 0 {
+		if ratio, err := strconv.ParseFloat(ratios[len(ratios)-1], 64); err == nil {
+			baseFee = nextBaseFee / nextBaseFeeFromRatio(1, ratio)
+		}
+	}
+	lastBlock, _ := strconv.ParseUint(fmt.Sprint(result["LastBlock"]), 10, 64)
+
+	return Snapshot{
+		BaseFee:     baseFee,
+		NextBaseFee: nextBaseFee,
+		Low:         tip("SafeGasPrice"),
+		Average:     tip("ProposeGasPrice"),
+		High:        tip("FastGasPrice"),
+		LastBlock:   lastBlock,
+		Source:      "etherscan",
+		UpdatedAt:   time.Now(),
+	}, nil
+}
+
+// eth_feeHistory of a node over the last Blocks blocks
+type FeeHistorySource struct {
+	Client *node.Client
+	Blocks uint64
+}
+
+func (s FeeHistorySource) Fetch() (Snapshot, error) {
+	blocks := s.Blocks
+	if blocks == 0 {
+		blocks = 20
+	}
+	history, err := s.Client.FeeHistory(blocks, "latest", tierPercentiles)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if len(history.BaseFeePerGas) < 2 || len(history.Reward) == 0 {
+		return Snapshot{}, fmt.Errorf("empty fee history")
+	}
+
+	// Average each percentile over the blocks
+	tiers := make([]float64, len(tierPercentiles))
+	for _, rewards := range history.Reward {
+		for i := range tiers {
+			if i < len(rewards) {
+				tiers[i] += WeiToGwei(node.ParseBig(rewards[i]))
+			}
+		}
+	}
+	for i := range tiers {
+		tiers[i] /= float64(len(history.Reward))
+	}
+
+	count := len(history.BaseFeePerGas)
+	return Snapshot{
+		BaseFee:     WeiToGwei(node.ParseBig(history.BaseFeePerGas[count-2])),
+		NextBaseFee: WeiToGwei(node.ParseBig(history.BaseFeePerGas[count-1])),
+		Low:         tiers[0],
+		Average:     tiers[1],
+		High:        tiers[2],
+		LastBlock:   node.ParseUint(history.OldestBlock) + uint64(len(history.GasUsedRatio)) - 1,
+		Source:      "node",
+		UpdatedAt:   time.Now(),
+	}, nil
+}
+
+/******************
+Tracker
+******************/
+
+// Keeps a recent snapshot in memory, refreshed in the background
+type Tracker struct {
+	source   Source
+	interval time.Duration
+
+	mu       sync.RWMutex
+	snapshot Snapshot
+	ready    bool
+	stop     chan struct{}
+}
+
+func NewTracker(source Source, interval time.Duration) *Tracker {
+	return &Tracker{source: source, interval: interval}
+}
+
+// Fetch a new snapshot from the source
+func (t *Tracker) Refresh() error {
+	snapshot, err := t.source.Fetch()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.snapshot = snapshot
+	t.ready = true
+	t.mu.Unlock()
+	return nil
+}
+
+// Latest snapshot, false until the first refresh succeeded
+func (t *Tracker) Snapshot() (Snapshot, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.snapshot, t.ready
+}
+
+// Refresh in the background until Stop is called
+func (t *Tracker) Start() {
+	t.mu.Lock()
+	if t.stop != nil {
+		t.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	t.stop = stop
+	t.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			if err := t.Refresh(); err != nil {
+				log.Printf("gas: failed to refresh snapshot: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (t *Tracker) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+}
+
+// GET /api/v1/gas
+func GasHandler(tracker *Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snapshot, ok := tracker.Snapshot()
+		if !ok {
+			// Nothing fetched yet, e.g. right after startup
+			if err := tracker.Refresh(); err != nil {
+				http.Error(w, fmt.Sprintf("Error fetching gas fees: %s", err.Error()), http.StatusServiceUnavailable)
+				return
+			}
+			snapshot, _ = tracker.Snapshot()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshot)
+	}
+}
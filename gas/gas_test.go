@@ -0,0 +1,103 @@
+package gas
+
+import (
+	"encoding/json"
+	"ethereye/internal/testutil"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+/************
+common
+************/
+
+// Fake gas oracle answering with the result
+func useGasOracle(t *testing.T, result map[string]string) {
+	testutil.UseFakeEtherscan(t, func(query url.Values) interface{} {
+		return testutil.Response(result)
+	})
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+/************
+test body
+************/
+
+func TestNextBaseFee(t *testing.T) {
+	base := big.NewInt(1000000000)
+	tests := []struct {
+		gasUsed  uint64
+		expected int64
+	}{
+		{30000000, 1125000000},
+		{15000000, 1000000000},
+		{0, 875000000},
+	}
+	for _, test := range tests {
+		if next := NextBaseFee(base, test.gasUsed, 30000000); next.Int64() != test.expected {
+			t.Errorf("NextBaseFee with %d gas used = %s, want %d", test.gasUsed, next, test.expected)
+		}
+	}
+}
+
+func TestEtherscanSource(t *testing.T) {
+	useGasOracle(t, map[string]string{
+		"LastBlock":       "100",
+		"SafeGasPrice":    "12.25",
+		"ProposeGasPrice": "13.25",
+		"FastGasPrice":    "15.25",
+		"suggestBaseFee":  "11.25",
+		"gasUsedRatio":    "0.5,1",
+	})
+
+	snapshot, err := EtherscanSource{APIKey: "key"}.Fetch()
+	if err != nil {
+		t.Fatalf("Fetch() returned an error: %v", err)
+	}
+	// The suggested base fee is the next block's, after a full block at 10 gwei
+	if !almostEqual(snapshot.BaseFee, 10) || snapshot.NextBaseFee != 11.25 || snapshot.Low != 1 || snapshot.Average != 2 || snapshot.High != 4 || snapshot.LastBlock != 100 {
+		t.Errorf("Unexpected snapshot: %+v", snapshot)
+	}
+}
+
+func TestFeeHistorySource(t *testing.T) {
+	client := testutil.NewFakeNode(t, testutil.Results(map[string]interface{}{
+		"eth_feeHistory": map[string]interface{}{
+			"oldestBlock":   "0x63",
+			"baseFeePerGas": []string{"0x3b9aca00", "0x77359400", "0x861c4680"},
+			"gasUsedRatio":  []float64{1, 1},
+			"reward":        [][]string{{"0x3b9aca00", "0x77359400", "0xb2d05e00"}, {"0x3b9aca00", "0x77359400", "0xb2d05e00"}},
+		},
+	}))
+
+	snapshot, err := FeeHistorySource{Client: client, Blocks: 2}.Fetch()
+	if err != nil {
+		t.Fatalf("Fetch() returned an error: %v", err)
+	}
+	if snapshot.BaseFee != 2 || snapshot.NextBaseFee != 2.25 || snapshot.Low != 1 || snapshot.Average != 2 || snapshot.High != 3 || snapshot.LastBlock != 100 {
+		t.Errorf("Unexpected snapshot: %+v", snapshot)
+	}
+}
+
+func TestGasHandler(t *testing.T) {
+	useGasOracle(t, map[string]string{"suggestBaseFee": "10", "SafeGasPrice": "11", "ProposeGasPrice": "12", "FastGasPrice": "14"})
+	tracker := NewTracker(EtherscanSource{APIKey: "key"}, 0)
+
+	rr := httptest.NewRecorder()
+	GasHandler(tracker).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/gas", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var snapshot Snapshot
+	if err := json.NewDecoder(rr.Body).Decode(&snapshot); err != nil || snapshot.Average != 2 {
+		t.Errorf("Unexpected response: %+v (%v)", snapshot, err)
+	}
+}
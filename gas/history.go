@@ -0,0 +1,485 @@
+package gas
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"ethereye/node"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/******************
+History Store
+******************/
+
+// Bucket sizes of the downsampled series
+const (
+	Resolution1m = "1m"
+	Resolution1h = "1h"
+	Resolution1d = "1d"
+)
+
+var resolutionSizes = map[string]time.Duration{
+	Resolution1m: time.Minute,
+	Resolution1h: time.Hour,
+	Resolution1d: 24 * time.Hour,
+}
+
+// How long each series is kept. Zero keeps it forever.
+var Retention = map[string]time.Duration{
+	"raw":        24 * time.Hour,
+	Resolution1m: 7 * 24 * time.Hour,
+	Resolution1h: 180 * 24 * time.Hour,
+	Resolution1d: 0,
+}
+
+// Fees of a single block, in gwei
+type Sample struct {
+	Block        uint64    `json:"block"`
+	Time         time.Time `json:"time"`
+	BaseFee      float64   `json:"baseFee"`
+	GasUsedRatio float64   `json:"gasUsedRatio"`
+	PriorityP10  float64   `json:"priorityFeeP10"`
+	PriorityP50  float64   `json:"priorityFeeP50"`
+	PriorityP90  float64   `json:"priorityFeeP90"`
+}
+
+// Aggregate of the samples within a time bucket, in gwei
+type Bucket struct {
+	Start        time.Time `json:"time"`
+	Count        int       `json:"count"`
+	BaseFeeAvg   float64   `json:"baseFeeAvg"`
+	BaseFeeMin   float64   `json:"baseFeeMin"`
+	BaseFeeMax   float64   `json:"baseFeeMax"`
+	GasUsedRatio float64   `json:"gasUsedRatio"`
+	PriorityP10  float64   `json:"priorityFeeP10"`
+	PriorityP50  float64   `json:"priorityFeeP50"`
+	PriorityP90  float64   `json:"priorityFeeP90"`
+}
+
+func (b *Bucket) add(sample Sample) {
+	if b.Count == 0 || sample.BaseFee < b.BaseFeeMin {
+		b.BaseFeeMin = sample.BaseFee
+	}
+	if sample.BaseFee > b.BaseFeeMax {
+		b.BaseFeeMax = sample.BaseFee
+	}
+	// Running averages
+	n := float64(b.Count)
+	b.BaseFeeAvg = (b.BaseFeeAvg*n + sample.BaseFee) / (n + 1)
+	b.GasUsedRatio = (b.GasUsedRatio*n + sample.GasUsedRatio) / (n + 1)
+	b.PriorityP10 = (b.PriorityP10*n + sample.PriorityP10) / (n + 1)
+	b.PriorityP50 = (b.PriorityP50*n + sample.PriorityP50) / (n + 1)
+	b.PriorityP90 = (b.PriorityP90*n + sample.PriorityP90) / (n + 1)
+	b.Count++
+}
+
+type historyData struct {
+	MinBlock uint64                       `json:"minBlock"`
+	MaxBlock uint64                       `json:"maxBlock"`
+	Raw      []Sample                     `json:"raw"`
+	Buckets  map[string]map[int64]*Bucket `json:"buckets"`
+}
+
+// Local time-series store of gas fees, persisted as a JSON file.
+// It covers a contiguous block range, extended forwards by new blocks and backwards by backfills.
+type HistoryStore struct {
+	filename string
+	mu       sync.RWMutex
+	data     historyData
+}
+
+func NewHistoryStore(filename string) *HistoryStore {
+	s := &HistoryStore{filename: filename}
+	s.data.Buckets = make(map[string]map[int64]*Bucket)
+	for resolution := range resolutionSizes {
+		s.data.Buckets[resolution] = make(map[int64]*Bucket)
+	}
+	return s
+}
+
+func (s *HistoryStore) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := ioutil.ReadFile(s.filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err := json.Unmarshal(data, &s.data); err != nil {
+		return err
+	}
+	for resolution := range resolutionSizes {
+		if s.data.Buckets[resolution] == nil {
+			s.data.Buckets[resolution] = make(map[int64]*Bucket)
+		}
+	}
+	return nil
+}
+
+func (s *HistoryStore) Save() error {
+	s.mu.RLock()
+	data, err := json.Marshal(s.data)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := s.filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.filename)
+}
+
+// Block range covered by the store. Both are zero while empty.
+func (s *HistoryStore) Range() (uint64, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.MinBlock, s.data.MaxBlock
+}
+
+// Add samples adjacent to the covered range. Samples already covered are skipped so nothing is counted twice.
+func (s *HistoryStore) Add(samples []Sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Compare against the range covered before this call
+	empty := s.data.MaxBlock == 0
+	minBlock, maxBlock := s.data.MinBlock, s.data.MaxBlock
+	for _, sample := range samples {
+		if !empty && sample.Block >= minBlock && sample.Block <= maxBlock {
+			continue
+		}
+		if s.data.MaxBlock == 0 || sample.Block < s.data.MinBlock {
+			s.data.MinBlock = sample.Block
+		}
+		if sample.Block > s.data.MaxBlock {
+			s.data.MaxBlock = sample.Block
+		}
+
+		s.data.Raw = append(s.data.Raw, sample)
+		for resolution, size := range resolutionSizes {
+			start := sample.Time.Truncate(size).Unix()
+			bucket, ok := s.data.Buckets[resolution][start]
+			if !ok {
+				bucket = &Bucket{Start: time.Unix(start, 0).UTC()}
+				s.data.Buckets[resolution][start] = bucket
+			}
+			bucket.add(sample)
+		}
+	}
+	sort.Slice(s.data.Raw, func(i, j int) bool { return s.data.Raw[i].Block < s.data.Raw[j].Block })
+	s.prune(time.Now())
+}
+
+// Drop data past its retention
+func (s *HistoryStore) prune(now time.Time) {
+	if retention := Retention["raw"]; retention > 0 {
+		kept := s.data.Raw[:0]
+		for _, sample := range s.data.Raw {
+			if now.Sub(sample.Time) <= retention {
+				kept = append(kept, sample)
+			}
+		}
+		s.data.Raw = kept
+	}
+	for resolution, buckets := range s.data.Buckets {
+		retention := Retention[resolution]
+		if retention == 0 {
+			continue
+		}
+		for start, bucket := range buckets {
+			if now.Sub(bucket.Start) > retention {
+				delete(buckets, start)
+			}
+		}
+	}
+}
+
+// Buckets of the resolution starting within [from, to], oldest first
+func (s *HistoryStore) Query(from, to time.Time, resolution string) ([]Bucket, error) {
+	if _, ok := resolutionSizes[resolution]; !ok {
+		return nil, fmt.Errorf("unknown resolution %q", resolution)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Bucket, 0)
+	for _, bucket := range s.data.Buckets[resolution] {
+		if !bucket.Start.Before(from) && !bucket.Start.After(to) {
+			result = append(result, *bucket)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Start.Before(result[j].Start) })
+	return result, nil
+}
+
+/******************
+Collector
+******************/
+
+// eth_feeHistory accepts at most this many blocks per call
+const maxFeeHistoryBlocks = 1024
+
+// Blocks backfilled when the store is empty, about a day
+const DefaultBackfillBlocks = 7200
+
+// Samples every new block into a HistoryStore
+type Collector struct {
+	client   *node.Client
+	store    *HistoryStore
+	interval time.Duration
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+func NewCollector(client *node.Client, store *HistoryStore, interval time.Duration) *Collector {
+	return &Collector{client: client, store: store, interval: interval}
+}
+
+// Sample blocks between the store's last block and the chain head. An empty store starts at the head.
+func (c *Collector) Collect() error {
+	head, err := c.client.BlockByNumber("latest")
+	if err != nil {
+		return err
+	}
+	if head == nil {
+		return fmt.Errorf("no latest block")
+	}
+	headNumber := node.ParseUint(head.Number)
+
+	_, maxBlock := c.store.Range()
+	from := maxBlock + 1
+	if maxBlock == 0 {
+		from = headNumber
+	}
+	if from > headNumber {
+		return nil
+	}
+	return c.collectRange(from, headNumber)
+}
+
+// Sample up to the given number of blocks before the oldest stored block
+func (c *Collector) Backfill(blocks uint64) error {
+	head, err := c.client.BlockByNumber("latest")
+	if err != nil {
+		return err
+	}
+	if head == nil {
+		return fmt.Errorf("no latest block")
+	}
+
+	minBlock, maxBlock := c.store.Range()
+	end := node.ParseUint(head.Number)
+	if maxBlock != 0 {
+		end = minBlock - 1
+	}
+	for blocks > 0 && end > 0 {
+		count := blocks
+		if count > maxFeeHistoryBlocks {
+			count = maxFeeHistoryBlocks
+		}
+		if count > end {
+			count = end
+		}
+		if err := c.collectRange(end-count+1, end); err != nil {
+			return err
+		}
+		blocks -= count
+		end -= count
+	}
+	return nil
+}
+
+// Fetch the fee history of [from, to] in chunks, oldest first, with the time of each block
+// taken from its header since slots can be missed.
+func (c *Collector) collectRange(from, to uint64) error {
+	for start := from; start <= to; {
+		end := start + maxFeeHistoryBlocks - 1
+		if end > to {
+			end = to
+		}
+		history, err := c.client.FeeHistory(end-start+1, node.EncodeUint(end), tierPercentiles)
+		if err != nil {
+			return err
+		}
+
+		oldest := node.ParseUint(history.OldestBlock)
+		numbers := make([]uint64, len(history.GasUsedRatio))
+		for i := range numbers {
+			numbers[i] = oldest + uint64(i)
+		}
+		headers, err := c.client.BlocksByNumber(numbers)
+		if err != nil {
+			return err
+		}
+
+		samples := make([]Sample, 0, len(history.GasUsedRatio))
+		for i, ratio := range history.GasUsedRatio {
+			if headers[i] == nil {
+				return fmt.Errorf("block %d not found", numbers[i])
+			}
+			sample := Sample{
+				Block:        numbers[i],
+				Time:         time.Unix(int64(node.ParseUint(headers[i].Timestamp)), 0).UTC(),
+				BaseFee:      WeiToGwei(node.ParseBig(history.BaseFeePerGas[i])),
+				GasUsedRatio: ratio,
+			}
+			if i < len(history.Reward) && len(history.Reward[i]) == len(tierPercentiles) {
+				sample.PriorityP10 = WeiToGwei(node.ParseBig(history.Reward[i][0]))
+				sample.PriorityP50 = WeiToGwei(node.ParseBig(history.Reward[i][1]))
+				sample.PriorityP90 = WeiToGwei(node.ParseBig(history.Reward[i][2]))
+			}
+			samples = append(samples, sample)
+		}
+		c.store.Add(samples)
+		start = end + 1
+	}
+	return nil
+}
+
+// Backfill an empty store, then collect in the background until Stop is called
+func (c *Collector) Start() {
+	c.mu.Lock()
+	if c.stop != nil {
+		c.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	c.stop = stop
+	c.mu.Unlock()
+
+	go func() {
+		if _, maxBlock := c.store.Range(); maxBlock == 0 {
+			if err := c.Backfill(DefaultBackfillBlocks); err != nil {
+				log.Printf("gas: failed to backfill history: %v", err)
+			}
+		}
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			if err := c.Collect(); err != nil {
+				log.Printf("gas: failed to collect history: %v", err)
+			} else if err := c.store.Save(); err != nil {
+				log.Printf("gas: failed to save history: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (c *Collector) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+/******************
+History API
+******************/
+
+// Parse RFC3339 or unix seconds
+func parseTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// GET /api/v1/gas/history?from={time}&to={time}&resolution={1m|1h|1d}&format={json|csv}
+// Times are RFC3339 or unix seconds. Defaults to the last 24 hours at 1h.
+func HistoryHandler(store *HistoryStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		to := time.Now().UTC()
+		if value := query.Get("to"); value != "" {
+			parsed, err := parseTime(value)
+			if err != nil {
+				http.Error(w, "Invalid 'to' time", http.StatusBadRequest)
+				return
+			}
+			to = parsed
+		}
+		from := to.Add(-24 * time.Hour)
+		if value := query.Get("from"); value != "" {
+			parsed, err := parseTime(value)
+			if err != nil {
+				http.Error(w, "Invalid 'from' time", http.StatusBadRequest)
+				return
+			}
+			from = parsed
+		}
+		if from.After(to) {
+			http.Error(w, "'from' must be before 'to'", http.StatusBadRequest)
+			return
+		}
+
+		resolution := query.Get("resolution")
+		if resolution == "" {
+			resolution = Resolution1h
+		}
+		buckets, err := store.Query(from, to, resolution)
+		if err != nil {
+			http.Error(w, "Invalid resolution, expected 1m, 1h or 1d", http.StatusBadRequest)
+			return
+		}
+
+		format := query.Get("format")
+		if format == "" && strings.Contains(r.Header.Get("Accept"), "text/csv") {
+			format = "csv"
+		}
+		if format == "csv" {
+			writeBucketsCSV(w, buckets)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(buckets)
+	}
+}
+
+func writeBucketsCSV(w http.ResponseWriter, buckets []Bucket) {
+	w.Header().Set("Content-Type", "text/csv")
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"time", "count", "baseFeeAvg", "baseFeeMin", "baseFeeMax", "gasUsedRatio", "priorityFeeP10", "priorityFeeP50", "priorityFeeP90"})
+	format := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	for _, bucket := range buckets {
+		writer.Write([]string{
+			bucket.Start.Format(time.RFC3339),
+			strconv.Itoa(bucket.Count),
+			format(bucket.BaseFeeAvg),
+			format(bucket.BaseFeeMin),
+			format(bucket.BaseFeeMax),
+			format(bucket.GasUsedRatio),
+			format(bucket.PriorityP10),
+			format(bucket.PriorityP50),
+			format(bucket.PriorityP90),
+		})
+	}
+	writer.Flush()
+}
@@ -0,0 +1,153 @@
+package gas
+
+import (
+	"encoding/json"
+	"ethereye/internal/testutil"
+	"ethereye/node"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+/************
+common
+************/
+
+// Fake chain whose block N has a base fee of N gwei and a block time 12 seconds after N-1,
+// except for 60 missed slots before block 300
+func newFakeChain(t *testing.T, head *uint64, genesis time.Time) *node.Client {
+	blockTime := func(number uint64) uint64 {
+		if number >= 300 {
+			number += 60
+		}
+		return uint64(genesis.Unix()) + number*SecondsPerBlock
+	}
+
+	return testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+		"eth_getBlockByNumber": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+			var tag string
+			json.Unmarshal(params[0], &tag)
+			number := *head
+			if tag != "latest" {
+				number = node.ParseUint(tag)
+			}
+			return map[string]string{"number": node.EncodeUint(number), "timestamp": node.EncodeUint(blockTime(number))}, nil
+		},
+		"eth_feeHistory": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+			var countHex, newestHex string
+			json.Unmarshal(params[0], &countHex)
+			json.Unmarshal(params[1], &newestHex)
+			count, newest := node.ParseUint(countHex), node.ParseUint(newestHex)
+			history := map[string]interface{}{"oldestBlock": node.EncodeUint(newest - count + 1)}
+			var baseFees []string
+			var ratios []float64
+			var rewards [][]string
+			for block := newest - count + 1; block <= newest+1; block++ {
+				baseFees = append(baseFees, fmt.Sprintf("0x%x", block*1e9))
+				if block <= newest {
+					ratios = append(ratios, 0.5)
+					rewards = append(rewards, []string{"0x3b9aca00", "0x77359400", "0xb2d05e00"})
+				}
+			}
+			history["baseFeePerGas"], history["gasUsedRatio"], history["reward"] = baseFees, ratios, rewards
+			return history, nil
+		},
+	})
+}
+
+/************
+test body
+************/
+
+func TestCollectorBackfillAndCollect(t *testing.T) {
+	// Block 0 at the start of an hour, so blocks 0-299 fall in the first hour
+	genesis := time.Now().UTC().Truncate(time.Hour).Add(-3 * time.Hour)
+	head := uint64(400)
+	client := newFakeChain(t, &head, genesis)
+
+	store := NewHistoryStore("test_gas_history.json")
+	defer os.Remove("test_gas_history.json")
+	collector := NewCollector(client, store, time.Minute)
+
+	if err := collector.Backfill(100); err != nil {
+		t.Fatalf("Backfill() returned an error: %v", err)
+	}
+	if min, max := store.Range(); min != 301 || max != 400 {
+		t.Fatalf("Unexpected range after backfill: %d-%d", min, max)
+	}
+	// Backfilling again extends the range backwards without counting blocks twice
+	if err := collector.Backfill(1100); err != nil {
+		t.Fatalf("Backfill() returned an error: %v", err)
+	}
+	head = 420
+	if err := collector.Collect(); err != nil {
+		t.Fatalf("Collect() returned an error: %v", err)
+	}
+	if min, max := store.Range(); min != 1 || max != 420 {
+		t.Fatalf("Unexpected range after collect: %d-%d", min, max)
+	}
+
+	buckets, err := store.Query(genesis, genesis.Add(2*time.Hour), Resolution1h)
+	if err != nil {
+		t.Fatalf("Query() returned an error: %v", err)
+	}
+	// Blocks 1-299 in the first hour, 300-420 in the second: dating them back from the head would
+	// move the last blocks before the missed slots into the second hour
+	if len(buckets) != 2 || buckets[0].Count != 299 || buckets[0].BaseFeeMin != 1 || buckets[0].BaseFeeMax != 299 || buckets[0].BaseFeeAvg != 150 {
+		t.Fatalf("Unexpected buckets: %+v", buckets)
+	}
+	if buckets[1].Count != 121 || buckets[1].PriorityP50 != 2 {
+		t.Errorf("Unexpected second bucket: %+v", buckets[1])
+	}
+
+	// Persisted and reloaded
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	reloaded := NewHistoryStore("test_gas_history.json")
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	if reloadedBuckets, _ := reloaded.Query(genesis, genesis.Add(2*time.Hour), Resolution1h); len(reloadedBuckets) != 2 {
+		t.Errorf("Unexpected buckets after reload: %+v", reloadedBuckets)
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	store := NewHistoryStore("unused.json")
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	store.Add([]Sample{{Block: 1, Time: old, BaseFee: 1}, {Block: 2, Time: time.Now(), BaseFee: 2}})
+
+	minute, _ := store.Query(old.Add(-time.Hour), time.Now(), Resolution1m)
+	daily, _ := store.Query(old.Add(-24*time.Hour), time.Now(), Resolution1d)
+	if len(minute) != 1 || len(daily) != 2 {
+		t.Errorf("Expected the old sample to be dropped from 1m but kept in 1d, got %d and %d buckets", len(minute), len(daily))
+	}
+}
+
+func TestHistoryHandler(t *testing.T) {
+	store := NewHistoryStore("unused.json")
+	now := time.Now().UTC().Truncate(time.Hour)
+	store.Add([]Sample{{Block: 1, Time: now, BaseFee: 10, PriorityP50: 1}})
+
+	t.Run("Test with CSV output", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		HistoryHandler(store).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/gas/history?format=csv&resolution=1h", nil))
+		lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+		if rr.Code != http.StatusOK || len(lines) != 2 || !strings.HasPrefix(lines[1], now.Format(time.RFC3339)+",1,10,") {
+			t.Errorf("Unexpected CSV response: %s", rr.Body.String())
+		}
+	})
+
+	t.Run("Test with an invalid resolution", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		HistoryHandler(store).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/gas/history?resolution=5m", nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
@@ -0,0 +1,243 @@
+package gas
+
+import (
+	"encoding/json"
+	"ethereye/node"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/******************
+Recommendations
+******************/
+
+// Seconds between blocks after the merge
+const SecondsPerBlock = 12
+
+// Gas limit of a plain ETH transfer, used when the request does not give one
+const DefaultGasLimit = 21000
+
+// How soon a transaction should be confirmed
+type Urgency struct {
+	Name         string
+	TargetBlocks int
+	// Percentile of recent priority fees to pay
+	Percentile float64
+	// Consecutive full blocks the fee cap survives
+	HeadroomBlocks int
+}
+
+var Urgencies = []Urgency{
+	{Name: "1block", TargetBlocks: 1, Percentile: 90, HeadroomBlocks: 1},
+	{Name: "5min", TargetBlocks: 25, Percentile: 50, HeadroomBlocks: 3},
+	{Name: "1hour", TargetBlocks: 300, Percentile: 10, HeadroomBlocks: 6},
+}
+
+func FindUrgency(name string) (Urgency, bool) {
+	for _, urgency := range Urgencies {
+		if urgency.Name == name {
+			return urgency, true
+		}
+	}
+	return Urgency{}, false
+}
+
+func rewardPercentiles() []float64 {
+	percentiles := make([]float64, len(Urgencies))
+	for i, urgency := range Urgencies {
+		percentiles[i] = urgency.Percentile
+	}
+	return percentiles
+}
+
+// EIP-1559 fee values for an urgency. Fees are in gwei, costs in ETH.
+type Recommendation struct {
+	Urgency                 string  `json:"urgency"`
+	TargetBlocks            int     `json:"targetBlocks"`
+	TargetSeconds           int     `json:"targetSeconds"`
+	MaxFeePerGas            float64 `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas    float64 `json:"maxPriorityFeePerGas"`
+	MaxFeePerGasWei         string  `json:"maxFeePerGasWei"`
+	MaxPriorityFeePerGasWei string  `json:"maxPriorityFeePerGasWei"`
+	ExpectedBaseFee         float64 `json:"expectedBaseFee"`
+	BaseFeeTrend            float64 `json:"baseFeeTrend"`
+	GasLimit                uint64  `json:"gasLimit"`
+	ExpectedCost            float64 `json:"expectedCost"`
+	MaxCost                 float64 `json:"maxCost"`
+}
+
+// Computes recommendations from the node's recent fee history
+type Recommender struct {
+	client *node.Client
+	blocks uint64
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	history   *node.FeeHistory
+	fetchedAt time.Time
+}
+
+func NewRecommender(client *node.Client) *Recommender {
+	return &Recommender{client: client, blocks: 50, ttl: SecondsPerBlock * time.Second}
+}
+
+// Fee history of recent blocks, fetched at most once per block
+func (r *Recommender) feeHistory() (*node.FeeHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.history != nil && time.Since(r.fetchedAt) < r.ttl {
+		return r.history, nil
+	}
+	history, err := r.client.FeeHistory(r.blocks, "latest", rewardPercentiles())
+	if err != nil {
+		return nil, err
+	}
+	if len(history.BaseFeePerGas) == 0 || len(history.Reward) == 0 {
+		return nil, fmt.Errorf("empty fee history")
+	}
+	r.history = history
+	r.fetchedAt = time.Now()
+	return history, nil
+}
+
+func (r *Recommender) Recommend(urgencyName string, gasLimit uint64) (Recommendation, error) {
+	urgency, ok := FindUrgency(urgencyName)
+	if !ok {
+		return Recommendation{}, fmt.Errorf("unknown urgency %q", urgencyName)
+	}
+	history, err := r.feeHistory()
+	if err != nil {
+		return Recommendation{}, err
+	}
+	return recommend(history, urgency, gasLimit), nil
+}
+
+func (r *Recommender) RecommendAll(gasLimit uint64) ([]Recommendation, error) {
+	history, err := r.feeHistory()
+	if err != nil {
+		return nil, err
+	}
+	recommendations := make([]Recommendation, len(Urgencies))
+	for i, urgency := range Urgencies {
+		recommendations[i] = recommend(history, urgency, gasLimit)
+	}
+	return recommendations, nil
+}
+
+func recommend(history *node.FeeHistory, urgency Urgency, gasLimit uint64) Recommendation {
+	// Median over recent blocks of the priority fee percentile for this urgency
+	index := 0
+	for i, candidate := range Urgencies {
+		if candidate.Name == urgency.Name {
+			index = i
+		}
+	}
+	tips := make([]float64, 0, len(history.Reward))
+	for _, rewards := range history.Reward {
+		if index < len(rewards) {
+			tips = append(tips, WeiToGwei(node.ParseBig(rewards[index])))
+		}
+	}
+	tip := median(tips)
+
+	// Average per-block base fee change implied by recent gas usage
+	trend := 0.0
+	for _, ratio := range history.GasUsedRatio {
+		trend += (ratio - 0.5) / 4
+	}
+	if len(history.GasUsedRatio) > 0 {
+		trend /= float64(len(history.GasUsedRatio))
+	}
+
+	nextBaseFee := WeiToGwei(node.ParseBig(history.BaseFeePerGas[len(history.BaseFeePerGas)-1]))
+
+	// Trends rarely hold for long, so they are projected over ten blocks at most
+	horizon := urgency.TargetBlocks
+	if horizon > 10 {
+		horizon = 10
+	}
+	expectedBaseFee := nextBaseFee * math.Pow(1+trend, float64(horizon-1))
+	maxBaseFee := nextBaseFee * math.Pow(1.125, float64(urgency.HeadroomBlocks))
+	if maxBaseFee < expectedBaseFee {
+		maxBaseFee = expectedBaseFee
+	}
+	maxFee := maxBaseFee + tip
+
+	return Recommendation{
+		Urgency:                 urgency.Name,
+		TargetBlocks:            urgency.TargetBlocks,
+		TargetSeconds:           urgency.TargetBlocks * SecondsPerBlock,
+		MaxFeePerGas:            maxFee,
+		MaxPriorityFeePerGas:    tip,
+		MaxFeePerGasWei:         GweiToWei(maxFee).String(),
+		MaxPriorityFeePerGasWei: GweiToWei(tip).String(),
+		ExpectedBaseFee:         expectedBaseFee,
+		BaseFeeTrend:            trend,
+		GasLimit:                gasLimit,
+		ExpectedCost:            float64(gasLimit) * (expectedBaseFee + tip) / 1e9,
+		MaxCost:                 float64(gasLimit) * maxFee / 1e9,
+	}
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// GET /api/v1/gas/recommendation?urgency={1block|5min|1hour}&gasLimit={gas}
+// Without an urgency, recommendations for every urgency are returned
+func RecommendationHandler(recommender *Recommender) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if recommender == nil {
+			http.Error(w, "node backend not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		gasLimit := uint64(DefaultGasLimit)
+		if value := r.URL.Query().Get("gasLimit"); value != "" {
+			parsed, err := strconv.ParseUint(value, 10, 64)
+			if err != nil || parsed == 0 {
+				http.Error(w, "Invalid gasLimit", http.StatusBadRequest)
+				return
+			}
+			gasLimit = parsed
+		}
+
+		var response interface{}
+		if urgency := r.URL.Query().Get("urgency"); urgency != "" {
+			if _, ok := FindUrgency(urgency); !ok {
+				http.Error(w, "Invalid urgency, expected 1block, 5min or 1hour", http.StatusBadRequest)
+				return
+			}
+			recommendation, err := recommender.Recommend(urgency, gasLimit)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error computing recommendation: %s", err.Error()), http.StatusInternalServerError)
+				return
+			}
+			response = recommendation
+		} else {
+			recommendations, err := recommender.RecommendAll(gasLimit)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error computing recommendation: %s", err.Error()), http.StatusInternalServerError)
+				return
+			}
+			response = recommendations
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -0,0 +1,53 @@
+package gas
+
+import (
+	"encoding/json"
+	"ethereye/internal/testutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecommend(t *testing.T) {
+	// Half-full blocks at a steady 10 gwei base fee, tips of 1/2/3 gwei for the 90th/50th/10th percentiles
+	rewards := make([][]string, 5)
+	for i := range rewards {
+		rewards[i] = []string{"0xb2d05e00", "0x77359400", "0x3b9aca00"}
+	}
+	client := testutil.NewFakeNode(t, testutil.Results(map[string]interface{}{
+		"eth_feeHistory": map[string]interface{}{
+			"oldestBlock":   "0x1",
+			"baseFeePerGas": []string{"0x2540be400", "0x2540be400", "0x2540be400", "0x2540be400", "0x2540be400", "0x2540be400"},
+			"gasUsedRatio":  []float64{0.5, 0.5, 0.5, 0.5, 0.5},
+			"reward":        rewards,
+		},
+	}))
+	recommender := NewRecommender(client)
+
+	recommendation, err := recommender.Recommend("1block", 21000)
+	if err != nil {
+		t.Fatalf("Recommend() returned an error: %v", err)
+	}
+	if recommendation.MaxPriorityFeePerGas != 3 || !almostEqual(recommendation.MaxFeePerGas, 10*1.125+3) || recommendation.MaxFeePerGasWei != "14250000000" {
+		t.Errorf("Unexpected fees: %+v", recommendation)
+	}
+	if !almostEqual(recommendation.ExpectedCost, 21000*13/1e9) {
+		t.Errorf("Unexpected expected cost: %v", recommendation.ExpectedCost)
+	}
+
+	rr := httptest.NewRecorder()
+	RecommendationHandler(recommender).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/gas/recommendation?gasLimit=50000", nil))
+	var recommendations []Recommendation
+	if err := json.NewDecoder(rr.Body).Decode(&recommendations); err != nil || len(recommendations) != len(Urgencies) {
+		t.Fatalf("Unexpected response: %v (%v)", recommendations, err)
+	}
+	if slow := recommendations[2]; slow.Urgency != "1hour" || slow.MaxPriorityFeePerGas != 1 || slow.GasLimit != 50000 {
+		t.Errorf("Unexpected slow recommendation: %+v", slow)
+	}
+
+	rr = httptest.NewRecorder()
+	RecommendationHandler(recommender).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/gas/recommendation?urgency=soon", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an unknown urgency, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
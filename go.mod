@@ -2,4 +2,4 @@ module ethereye
 
 go 1.18
 
-require github.com/joho/godotenv v1.5.1 // indirect
+require github.com/joho/godotenv v1.5.1
@@ -0,0 +1,116 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"ethereye/node"
+	. "ethereye/utils"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+/******************
+Node
+******************/
+
+// Answer to a JSON-RPC call: a result, or an error returned by the node
+type RPCHandler func(params []json.RawMessage) (interface{}, *node.RPCError)
+
+// Handler answering every call with the value
+func Result(value interface{}) RPCHandler {
+	return func(params []json.RawMessage) (interface{}, *node.RPCError) {
+		return value, nil
+	}
+}
+
+// Handlers answering each method with a fixed value
+func Results(values map[string]interface{}) map[string]RPCHandler {
+	handlers := make(map[string]RPCHandler, len(values))
+	for method, value := range values {
+		handlers[method] = Result(value)
+	}
+	return handlers
+}
+
+type rpcRequest struct {
+	ID     int64             `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// Fake JSON-RPC node answering the methods it has handlers for, in single requests and batches.
+// Other methods are not found.
+func NewFakeNode(t *testing.T, handlers map[string]RPCHandler) *node.Client {
+	respond := func(request rpcRequest) map[string]interface{} {
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+		handler, ok := handlers[request.Method]
+		if !ok {
+			response["error"] = node.RPCError{Code: -32601, Message: "method not found"}
+		} else if result, rpcErr := handler(request.Params); rpcErr != nil {
+			response["error"] = rpcErr
+		} else {
+			response["result"] = result
+		}
+		return response
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+			var batch []rpcRequest
+			json.Unmarshal(body, &batch)
+			responses := make([]map[string]interface{}, len(batch))
+			for i, request := range batch {
+				responses[i] = respond(request)
+			}
+			json.NewEncoder(w).Encode(responses)
+			return
+		}
+		var request rpcRequest
+		json.Unmarshal(body, &request)
+		json.NewEncoder(w).Encode(respond(request))
+	}))
+	t.Cleanup(server.Close)
+	return node.NewClient(server.URL)
+}
+
+/******************
+Etherscan
+******************/
+
+// Point the Etherscan API at a fake answering each query with the response of respond, until the
+// test ends. Returns the queries received.
+func UseFakeEtherscan(t *testing.T, respond func(query url.Values) interface{}) *[]url.Values {
+	var mu sync.Mutex
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+		json.NewEncoder(w).Encode(respond(r.URL.Query()))
+	}))
+	previous := EtherscanAPIURL
+	EtherscanAPIURL = server.URL
+	t.Cleanup(func() {
+		EtherscanAPIURL = previous
+		server.Close()
+	})
+	return &queries
+}
+
+// Successful Etherscan response
+func Response(result interface{}) map[string]interface{} {
+	return map[string]interface{}{"status": "1", "message": "OK", "result": result}
+}
+
+// Etherscan response to an account list query, which reports no transactions when there are no records
+func ListResponse(records []map[string]string) map[string]interface{} {
+	if len(records) == 0 {
+		return map[string]interface{}{"status": "0", "message": "No transactions found", "result": []interface{}{}}
+	}
+	return Response(records)
+}
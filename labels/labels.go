@@ -0,0 +1,318 @@
+package labels
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/******************
+Address Labels
+******************/
+
+const (
+	CategoryExchange = "exchange"
+	CategoryBridge   = "bridge"
+	CategoryDEX      = "dex"
+	CategoryToken    = "token"
+	CategoryStaking  = "staking"
+	CategoryNFT      = "nft"
+	CategoryMixer    = "mixer"
+	CategoryScam     = "scam"
+	CategoryFavorite = "favorite"
+)
+
+// Risk flags of labeled addresses
+const (
+	RiskScam       = "scam"
+	RiskPhishing   = "phishing"
+	RiskSanctioned = "sanctioned"
+)
+
+// Known entity behind an address
+type Label struct {
+	Address  string   `json:"address"`
+	Name     string   `json:"name"`
+	Category string   `json:"category,omitempty"`
+	Risk     []string `json:"risk,omitempty"`
+}
+
+func (l Label) HasRisk(flag string) bool {
+	for _, risk := range l.Risk {
+		if risk == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Labels the user saved for addresses, keyed by lowercased address
+type FavoriteSource interface {
+	Label(address string) string
+	Labels() map[string]string
+}
+
+// Labels of known addresses, completed with the user's favorites
+type Registry struct {
+	labels map[string]Label
+	// Known tokens keyed by lowercased symbol
+	tokens    map[string]Label
+	favorites FavoriteSource
+}
+
+// Build a registry from labels; later labels replace earlier ones for the same address.
+// Addresses categorized as scams are flagged as such. When tokens share a symbol, the first one listed is kept.
+func NewRegistry(entries []Label) *Registry {
+	r := &Registry{labels: make(map[string]Label), tokens: make(map[string]Label)}
+	addresses := make([]string, 0, len(entries))
+	for _, label := range entries {
+		label.Address = strings.ToLower(strings.TrimSpace(label.Address))
+		if label.Category == CategoryScam && !label.HasRisk(RiskScam) {
+			label.Risk = append(append([]string(nil), label.Risk...), RiskScam)
+		}
+		r.labels[label.Address] = label
+		addresses = append(addresses, label.Address)
+	}
+	for _, address := range addresses {
+		label := r.labels[address]
+		if _, ok := r.tokens[strings.ToLower(label.Name)]; label.Category == CategoryToken && !ok {
+			r.tokens[strings.ToLower(label.Name)] = label
+		}
+	}
+	return r
+}
+
+// Load labels from a CSV file with an address, name, category and risk column, the risk flags
+// separated by ';', or from a JSON file holding a list of labels or a map of addresses to names:
+//
+//	address,name,category,risk
+//	0x28c6c06298d514db089934071355e5743bf21d60,Binance 14,exchange,
+//
+//	[{"address": "0x28c6...", "name": "Binance 14", "category": "exchange"}]
+func LoadFile(filename string) ([]Label, error) {
+	if strings.EqualFold(filepath.Ext(filename), ".csv") {
+		return loadCSV(filename)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Label
+	if err := json.Unmarshal(data, &entries); err == nil {
+		return entries, nil
+	}
+	var names map[string]string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("%s: expected a list of labels or a map of addresses to names", filename)
+	}
+	for address, name := range names {
+		entries = append(entries, Label{Address: address, Name: name})
+	}
+	return entries, nil
+}
+
+func loadCSV(filename string) ([]Label, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["address"]; !ok {
+		return nil, fmt.Errorf("%s: missing address column", filename)
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("%s: missing name column", filename)
+	}
+	field := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var entries []Label
+	for _, record := range records[1:] {
+		label := Label{Address: field(record, "address"), Name: field(record, "name"), Category: field(record, "category")}
+		if label.Address == "" {
+			continue
+		}
+		for _, flag := range strings.Split(field(record, "risk"), ";") {
+			if flag = strings.TrimSpace(flag); flag != "" {
+				label.Risk = append(label.Risk, flag)
+			}
+		}
+		entries = append(entries, label)
+	}
+	return entries, nil
+}
+
+// Complete the registry with the labels of favorite addresses
+func (r *Registry) UseFavorites(favorites FavoriteSource) {
+	r.favorites = favorites
+}
+
+// Label of the address in the loaded files, ignoring favorites
+func (r *Registry) Known(address string) (Label, bool) {
+	if r == nil {
+		return Label{}, false
+	}
+	label, ok := r.labels[strings.ToLower(address)]
+	return label, ok
+}
+
+// Known token whose name is the symbol, ignoring case
+func (r *Registry) Token(symbol string) (Label, bool) {
+	if r == nil {
+		return Label{}, false
+	}
+	label, ok := r.tokens[strings.ToLower(symbol)]
+	return label, ok
+}
+
+// Label of the address. A favorite's label names the address, keeping the known category and risk flags.
+func (r *Registry) Lookup(address string) (Label, bool) {
+	if r == nil {
+		return Label{}, false
+	}
+	key := strings.ToLower(address)
+	label, ok := r.labels[key]
+	if r.favorites != nil {
+		if name := r.favorites.Label(key); name != "" {
+			return favoriteLabel(label, ok, key, name), true
+		}
+	}
+	return label, ok
+}
+
+func favoriteLabel(known Label, ok bool, address, name string) Label {
+	if !ok {
+		return Label{Address: address, Name: name, Category: CategoryFavorite}
+	}
+	known.Name = name
+	return known
+}
+
+// Labels whose known or favorite name contains the query or whose address starts with it, optionally
+// of a single category, ordered by name. An empty query matches every label.
+func (r *Registry) Search(query, category string, limit int) []Label {
+	all := make(map[string]Label, len(r.labels))
+	names := make(map[string][]string, len(r.labels))
+	for address, label := range r.labels {
+		all[address] = label
+		names[address] = []string{label.Name}
+	}
+	if r.favorites != nil {
+		for address, name := range r.favorites.Labels() {
+			known, ok := all[address]
+			all[address] = favoriteLabel(known, ok, address, name)
+			names[address] = append(names[address], name)
+		}
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	matches := func(address string) bool {
+		if query == "" || strings.HasPrefix(address, query) {
+			return true
+		}
+		for _, name := range names[address] {
+			if strings.Contains(strings.ToLower(name), query) {
+				return true
+			}
+		}
+		return false
+	}
+	results := []Label{}
+	for address, label := range all {
+		if (category == "" || label.Category == category) && matches(address) {
+			results = append(results, label)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Name != results[j].Name {
+			return strings.ToLower(results[i].Name) < strings.ToLower(results[j].Name)
+		}
+		return results[i].Address < results[j].Address
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// Labels listed unless a limit is given
+const defaultSearchLimit = 50
+
+// GET /api/v1/labels?q={query}&category={category}&limit={count}
+// GET /api/v1/labels?address={address}
+func LabelsHandler(r *Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		if address := query.Get("address"); address != "" {
+			label, ok := r.Lookup(address)
+			if !ok {
+				http.Error(w, "Unknown address", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(label)
+			return
+		}
+
+		limit := defaultSearchLimit
+		if value := query.Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "Invalid 'limit' query parameter", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Search(query.Get("q"), query.Get("category"), limit))
+	}
+}
+
+// Well-known mainnet addresses, extended by the configured label files
+var DefaultLabels = []Label{
+	{Address: "0x00000000219ab540356cbb839cbe05303d7705fa", Name: "Beacon Deposit Contract", Category: CategoryStaking},
+	{Address: "0xae7ab96520de3a18e5e111b5eaab095312d7fe84", Name: "Lido: stETH", Category: CategoryStaking},
+	{Address: "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2", Name: "WETH", Category: CategoryToken},
+	{Address: "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", Name: "USDC", Category: CategoryToken},
+	{Address: "0xdac17f958d2ee523a2206206994597c13d831ec7", Name: "USDT", Category: CategoryToken},
+	{Address: "0x6b175474e89094c44da98b954eedeac495271d0f", Name: "DAI", Category: CategoryToken},
+	{Address: "0x7a250d5630b4cf539739df2c5dacb4c659f2488d", Name: "Uniswap V2: Router 2", Category: CategoryDEX},
+	{Address: "0xe592427a0aece92de3edee1f18e0157c05861564", Name: "Uniswap V3: Router", Category: CategoryDEX},
+	{Address: "0x3fc91a3afd70395cd496c647d5a6cc9d4b2b7fad", Name: "Uniswap: Universal Router", Category: CategoryDEX},
+	{Address: "0x1111111254eeb25477b68fb85ed929f73a960582", Name: "1inch v5: Aggregation Router", Category: CategoryDEX},
+	{Address: "0x00000000000000adc04c56bf30ac9d3c0aaf14dc", Name: "OpenSea: Seaport 1.5", Category: CategoryNFT},
+	{Address: "0x99c9fc46f92e8a1c0dec1b1747d010903e884be1", Name: "Optimism: Gateway", Category: CategoryBridge},
+	{Address: "0x4dbd4fc535ac27206064b68ffcf827b0a60bab3f", Name: "Arbitrum: Delayed Inbox", Category: CategoryBridge},
+	{Address: "0x40ec5b33f54e0e8a33a975908c5ba1c14e5bbbdf", Name: "Polygon: ERC20 Bridge", Category: CategoryBridge},
+	{Address: "0x28c6c06298d514db089934071355e5743bf21d60", Name: "Binance 14", Category: CategoryExchange},
+	{Address: "0x21a31ee1afc51d94c2efccaa2092ad1028285549", Name: "Binance 15", Category: CategoryExchange},
+	{Address: "0xa9d1e08c7793af67e9d92fe308d5697fb81d3e43", Name: "Coinbase 10", Category: CategoryExchange},
+	{Address: "0xd90e2f925da726b50c4ed8d0fb90ad053324f31b", Name: "Tornado Cash: Router", Category: CategoryMixer, Risk: []string{RiskSanctioned}},
+}
@@ -0,0 +1,152 @@
+package labels
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+/************
+common
+************/
+
+const (
+	binance = "0x28c6c06298d514db089934071355e5743bf21d60"
+	drainer = "0x3333333333333333333333333333333333333333"
+	friend  = "0x2222222222222222222222222222222222222222"
+)
+
+type fakeFavorites map[string]string
+
+func (f fakeFavorites) Label(address string) string {
+	return f[address]
+}
+
+func (f fakeFavorites) Labels() map[string]string {
+	return f
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	filename := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+/************
+test body
+************/
+
+func TestLoadFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		expected int
+		err      bool
+	}{
+		{"Test with CSV", "labels.csv", "Address,Name,Category,Risk\n" + drainer + ",Fake Airdrop,scam,phishing;scam\n" + binance + ",Binance 14,exchange,\n", 2, false},
+		{"Test with CSV without name column", "labels.csv", "address,category\n" + drainer + ",scam\n", 0, true},
+		{"Test with JSON list", "labels.json", `[{"address": "` + drainer + `", "name": "Fake Airdrop", "category": "scam"}]`, 1, false},
+		{"Test with JSON map", "labels.json", `{"` + drainer + `": "Fake Airdrop"}`, 1, false},
+		{"Test with invalid JSON", "labels.json", `"labels"`, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := LoadFile(writeFile(t, test.file, test.content))
+			if (err != nil) != test.err {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if len(entries) != test.expected {
+				t.Errorf("Expected %d labels, got %+v", test.expected, entries)
+			}
+		})
+	}
+
+	entries, _ := LoadFile(writeFile(t, "labels.csv", "address,name,category,risk\n"+drainer+",Fake Airdrop,scam,phishing\n"))
+	label, ok := NewRegistry(entries).Known(drainer)
+	if !ok || !label.HasRisk(RiskPhishing) || !label.HasRisk(RiskScam) {
+		t.Errorf("Expected scam and phishing flags, got %+v", label)
+	}
+}
+
+func TestRegistryLookup(t *testing.T) {
+	registry := NewRegistry(DefaultLabels)
+	registry.UseFavorites(fakeFavorites{friend: "Alice", binance: "My exchange account"})
+
+	if label, ok := registry.Lookup(friend); !ok || label.Name != "Alice" || label.Category != CategoryFavorite {
+		t.Errorf("Unexpected favorite label %+v", label)
+	}
+	if label, ok := registry.Lookup("0x28C6C06298D514DB089934071355E5743BF21D60"); !ok || label.Name != "My exchange account" || label.Category != CategoryExchange {
+		t.Errorf("Unexpected label %+v", label)
+	}
+	if label, ok := registry.Known(binance); !ok || label.Name != "Binance 14" {
+		t.Errorf("Unexpected known label %+v", label)
+	}
+	if _, ok := registry.Lookup(drainer); ok {
+		t.Errorf("Expected no label for an unknown address")
+	}
+
+	results := registry.Search("binance", "", 0)
+	if len(results) != 2 || results[0].Name != "Binance 15" || results[1].Name != "My exchange account" {
+		t.Errorf("Unexpected search results %+v", results)
+	}
+	if results := registry.Search("", CategoryFavorite, 0); len(results) != 1 || results[0].Address != friend {
+		t.Errorf("Unexpected favorites %+v", results)
+	}
+	if results := registry.Search("0x2", "", 0); len(results) != 3 {
+		t.Errorf("Expected 3 addresses starting with 0x2, got %+v", results)
+	}
+}
+
+func TestRegistryToken(t *testing.T) {
+	entries := append(append([]Label(nil), DefaultLabels...),
+		Label{Address: drainer, Name: "USDC", Category: CategoryToken},
+		// Relabeled, no longer a token
+		Label{Address: "0xdac17f958d2ee523a2206206994597c13d831ec7", Name: "USDT", Category: CategoryExchange},
+	)
+	registry := NewRegistry(entries)
+
+	if label, ok := registry.Token("usdc"); !ok || label.Address != "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48" {
+		t.Errorf("Expected the first USDC listed, got %+v", label)
+	}
+	if label, ok := registry.Token("USDT"); ok {
+		t.Errorf("Expected no token for a relabeled address, got %+v", label)
+	}
+}
+
+func TestLabelsHandler(t *testing.T) {
+	registry := NewRegistry(DefaultLabels)
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"Test with search", "?q=uniswap&category=dex", http.StatusOK},
+		{"Test with known address", "?address=" + binance, http.StatusOK},
+		{"Test with unknown address", "?address=" + drainer, http.StatusNotFound},
+		{"Test with invalid limit", "?q=uniswap&limit=-1", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			LabelsHandler(registry).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/labels"+test.query, nil))
+			if rr.Code != test.expected {
+				t.Errorf("Expected status code %d, got %d", test.expected, rr.Code)
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	LabelsHandler(registry).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/labels?q=uniswap&limit=2", nil))
+	var results []Label
+	json.NewDecoder(rr.Body).Decode(&results)
+	if len(results) != 2 {
+		t.Errorf("Expected 2 labels, got %+v", results)
+	}
+}
+
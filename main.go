@@ -1,12 +1,22 @@
 package main
 
 import (
+	"ethereye/abi"
+	"ethereye/analytics"
 	. "ethereye/favorites"
+	"ethereye/gas"
+	"ethereye/labels"
+	"ethereye/node"
+	"ethereye/portfolio"
+	"ethereye/prices"
+	"ethereye/reports"
 	. "ethereye/transactions"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -18,16 +28,129 @@ func main() {
 		log.Fatalf("Failed to load addresses: %v", err)
 	}
 
+	groups := NewGroupStorage("groups.json")
+	if err := groups.Load(); err != nil {
+		log.Fatalf("Failed to load wallet groups: %v", err)
+	}
+	UseGroups(groups)
+
 	err := godotenv.Load(".env")
 	if err != nil {
 		fmt.Printf("Can't read .env: %v", err)
 	}
 	apiKey := os.Getenv("ETHERSCAN_APT_KEY")
 
+	// Optional JSON-RPC node used for pending transactions and on-chain calls
+	var nodeClient *node.Client
+	if nodeURL := os.Getenv("ETH_NODE_URL"); nodeURL != "" {
+		nodeClient = node.NewClient(nodeURL)
+	}
+
+	// Contract ABI whose custom errors are decoded in failure diagnoses
+	if abiFile := os.Getenv("ERRORS_ABI_FILE"); abiFile != "" {
+		if err := abi.DefaultErrors.LoadABIFile(abiFile); err != nil {
+			log.Fatalf("Failed to load custom errors: %v", err)
+		}
+	}
+
+	// Keep a local copy of favorite wallets' history in sync
+	transactionStore := NewTransactionStore("transaction_index")
+	if err := transactionStore.Load(); err != nil {
+		log.Fatalf("Failed to load transaction store: %v", err)
+	}
+	indexer := NewIndexer(apiKey, transactionStore, time.Minute)
+	indexer.TrackSource(func() []string { return storage.GetFavoriteAddresses("wallet") })
+	UseIndexer(indexer)
+	indexer.Start()
+
+	// Gas fees from Etherscan's gas oracle, or from the node's fee history when GAS_SOURCE=node
+	var gasSource gas.Source = gas.EtherscanSource{APIKey: apiKey}
+	if os.Getenv("GAS_SOURCE") == "node" && nodeClient != nil {
+		gasSource = gas.FeeHistorySource{Client: nodeClient}
+	}
+	gasTracker := gas.NewTracker(gasSource, 15*time.Second)
+	gasTracker.Start()
+	gasHistory := gas.NewHistoryStore("gas_history.json")
+	if err := gasHistory.Load(); err != nil {
+		log.Fatalf("Failed to load gas history: %v", err)
+	}
+	var gasRecommender *gas.Recommender
+	var inclusionModel *gas.InclusionModel
+	if nodeClient != nil {
+		gasRecommender = gas.NewRecommender(nodeClient)
+		inclusionModel = gas.NewInclusionModel(nodeClient, gas.DefaultInclusionWindow)
+		gas.NewCollector(nodeClient, gasHistory, time.Minute).Start()
+	}
+
+	// Token prices from a CoinGecko-compatible API, or from a local file when PRICE_FILE is set
+	var priceProvider prices.PriceProvider = prices.NewCoinGecko(os.Getenv("PRICE_API_URL"), os.Getenv("PRICE_API_KEY"))
+	if priceFile := os.Getenv("PRICE_FILE"); priceFile != "" {
+		staticPrices, err := prices.LoadStaticPrices(priceFile)
+		if err != nil {
+			log.Fatalf("Failed to load prices: %v", err)
+		}
+		priceProvider = staticPrices
+	}
+
+	// Token categories for allocation breakdowns
+	classification := portfolio.DefaultClassification
+	if categoriesFile := os.Getenv("TOKEN_CATEGORIES_FILE"); categoriesFile != "" {
+		if classification, err = portfolio.LoadClassification(categoriesFile); err != nil {
+			log.Fatalf("Failed to load token categories: %v", err)
+		}
+	}
+
+	// Known addresses labeled in responses, extended by the comma separated JSON or CSV files
+	// of ADDRESS_LABELS_FILE, and named by favorites
+	knownLabels := append([]labels.Label(nil), labels.DefaultLabels...)
+	if labelsFiles := os.Getenv("ADDRESS_LABELS_FILE"); labelsFiles != "" {
+		for _, labelsFile := range strings.Split(labelsFiles, ",") {
+			loaded, err := labels.LoadFile(strings.TrimSpace(labelsFile))
+			if err != nil {
+				log.Fatalf("Failed to load address labels: %v", err)
+			}
+			knownLabels = append(knownLabels, loaded...)
+		}
+	}
+	addressLabels := labels.NewRegistry(knownLabels)
+	addressLabels.UseFavorites(storage)
+	UseLabels(addressLabels)
+
+	portfolioHistory := portfolio.NewHistoryCache("portfolio_history.json")
+	if err := portfolioHistory.Load(); err != nil {
+		log.Fatalf("Failed to load portfolio history: %v", err)
+	}
+
+	// Tax report archives are written to tax_reports/ unless REPORTS_DIR is set
+	reportsDir := os.Getenv("REPORTS_DIR")
+	if reportsDir == "" {
+		reportsDir = "tax_reports"
+	}
+	reportJobs := reports.NewJobs(reportsDir, apiKey, priceProvider)
+
 	http.HandleFunc("/api/v1/favorites", FavoriteAddressHandler(storage))
+	http.HandleFunc("/api/v1/groups", GroupsHandler(groups))
 	http.HandleFunc("/api/v1/transactions", TransactionsHandler(apiKey))
-	http.HandleFunc("/api/v1/transaction-details", TransactionDetailsHandler(apiKey))
-	http.HandleFunc("/api/v1/transaction-status", TransactionStatusHandler(apiKey))
+	http.HandleFunc("/api/v1/token-transfers", TokenTransfersHandler(apiKey))
+	http.HandleFunc("/api/v1/transaction-details", TransactionDetailsHandler(apiKey, nodeClient))
+	http.HandleFunc("/api/v1/transaction-status", TransactionStatusHandler(apiKey, nodeClient, inclusionModel))
+	http.HandleFunc("/api/v1/transaction-status/events", TransactionStatusEventsHandler(StatusEvents))
+	http.HandleFunc("/api/v1/stuck-transactions", StuckTransactionsHandler(apiKey, nodeClient))
+	http.HandleFunc("/api/v1/simulate", SimulateHandler(nodeClient, gasRecommender))
+	http.HandleFunc("/api/v1/gas", gas.GasHandler(gasTracker))
+	http.HandleFunc("/api/v1/gas/recommendation", gas.RecommendationHandler(gasRecommender))
+	http.HandleFunc("/api/v1/gas/eta", gas.ETAHandler(inclusionModel))
+	http.HandleFunc("/api/v1/gas/history", gas.HistoryHandler(gasHistory))
+	http.HandleFunc("/api/v1/gas/forecast", gas.ForecastHandler(gas.NewForecaster(gasHistory)))
+	http.HandleFunc("/api/v1/gas/spend", analytics.GasSpendHandler(apiKey, nodeClient, priceProvider))
+	http.HandleFunc("/api/v1/labels", labels.LabelsHandler(addressLabels))
+	http.HandleFunc("/api/v1/counterparties", analytics.CounterpartiesHandler(apiKey, nodeClient, storage, addressLabels))
+	http.HandleFunc("/api/v1/portfolio/balances", portfolio.BalancesHandler(apiKey, nodeClient, priceProvider))
+	http.HandleFunc("/api/v1/portfolio/history", portfolio.ValueHistoryHandler(apiKey, priceProvider, portfolioHistory))
+	http.HandleFunc("/api/v1/portfolio/trades", portfolio.TradeHistoryHandler(apiKey, priceProvider))
+	http.HandleFunc("/api/v1/portfolio/allocation", portfolio.AllocationHandler(apiKey, nodeClient, priceProvider, classification))
+	http.HandleFunc("/api/v1/reports/tax", reports.TaxReportHandler(reportJobs, priceProvider))
+	http.HandleFunc("/api/v1/reports/tax/download", reports.TaxReportDownloadHandler(reportJobs))
 	http.HandleFunc("/filtered-transactions", FilteredTransactionsHandler(apiKey))
 
 	fmt.Println("Starting server on port 8080...")
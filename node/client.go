@@ -0,0 +1,182 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// JSON-RPC client for an Ethereum node backend
+type Client struct {
+	url        string
+	httpClient *http.Client
+	nextID     int64
+}
+
+func NewClient(url string) *Client {
+	return &Client{url: url, httpClient: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Error returned by the node
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// Errors of the EVM itself, as opposed to the node failing to run the call (e.g. missing state)
+var vmErrors = []string{"execution reverted", "out of gas", "invalid opcode", "invalid jump destination", "stack underflow", "stack overflow", "write protection"}
+
+// Whether the call was executed and failed: a revert (code 3 or revert data) or another EVM error
+func (e *RPCError) ExecutionFailed() bool {
+	if e.Code == 3 || len(e.RevertData()) > 0 {
+		return true
+	}
+	message := strings.ToLower(e.Message)
+	for _, vmErr := range vmErrors {
+		if strings.Contains(message, vmErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Revert data attached to an "execution reverted" error, if any
+func (e *RPCError) RevertData() []byte {
+	data, ok := e.Data.(string)
+	if !ok {
+		return nil
+	}
+	decoded, err := DecodeBytes(data)
+	if err != nil {
+		return nil
+	}
+	return decoded
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int64         `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// Call a JSON-RPC method and decode its result into result.
+// A null result leaves result untouched.
+func (c *Client) Call(result interface{}, method string, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	request := rpcRequest{JSONRPC: "2.0", ID: atomic.AddInt64(&c.nextID, 1), Method: method, Params: params}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("node returned status %d: %s", resp.StatusCode, data)
+	}
+
+	var response rpcResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if result == nil || len(response.Result) == 0 || string(response.Result) == "null" {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// Request of a batch. The result is decoded into Result and a failure of the request set in Error.
+type BatchRequest struct {
+	Method string
+	Params []interface{}
+	Result interface{}
+	Error  error
+}
+
+// Send the requests as one JSON-RPC batch. The returned error is for the batch as a whole;
+// errors of single requests are set on them.
+func (c *Client) BatchCall(requests []BatchRequest) error {
+	if len(requests) == 0 {
+		return nil
+	}
+	batch := make([]rpcRequest, len(requests))
+	byID := make(map[int64]*BatchRequest, len(requests))
+	for i := range requests {
+		params := requests[i].Params
+		if params == nil {
+			params = []interface{}{}
+		}
+		batch[i] = rpcRequest{JSONRPC: "2.0", ID: atomic.AddInt64(&c.nextID, 1), Method: requests[i].Method, Params: params}
+		byID[batch[i].ID] = &requests[i]
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("node returned status %d: %s", resp.StatusCode, data)
+	}
+
+	var responses []rpcResponse
+	if err := json.Unmarshal(data, &responses); err != nil {
+		return err
+	}
+	for _, response := range responses {
+		request, ok := byID[response.ID]
+		if !ok {
+			continue
+		}
+		delete(byID, response.ID)
+		switch {
+		case response.Error != nil:
+			request.Error = response.Error
+		case request.Result != nil && len(response.Result) > 0 && string(response.Result) != "null":
+			request.Error = json.Unmarshal(response.Result, request.Result)
+		}
+	}
+	for _, request := range byID {
+		request.Error = fmt.Errorf("no response to %s in the batch", request.Method)
+	}
+	return nil
+}
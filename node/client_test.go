@@ -0,0 +1,143 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test node answering single requests and batches with the handler
+func newTestServer(t *testing.T, handle func(method string, params []json.RawMessage) (interface{}, *RPCError)) *Client {
+	type request struct {
+		ID     int64             `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	respond := func(req request) map[string]interface{} {
+		result, rpcErr := handle(req.Method, req.Params)
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		if rpcErr != nil {
+			response["error"] = rpcErr
+		} else {
+			response["result"] = result
+		}
+		return response
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+			var batch []request
+			if err := json.Unmarshal(body, &batch); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			responses := make([]map[string]interface{}, 0, len(batch))
+			for _, req := range batch {
+				responses = append(responses, respond(req))
+			}
+			json.NewEncoder(w).Encode(responses)
+			return
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(respond(req))
+	}))
+	t.Cleanup(server.Close)
+	return NewClient(server.URL)
+}
+
+func TestClientCall(t *testing.T) {
+	client := newTestServer(t, func(method string, params []json.RawMessage) (interface{}, *RPCError) {
+		switch method {
+		case "eth_blockNumber":
+			return "0x10", nil
+		case "eth_getTransactionByHash":
+			return nil, nil
+		case "eth_call":
+			return nil, &RPCError{Code: 3, Message: "execution reverted", Data: "0x08c379a0"}
+		}
+		return nil, &RPCError{Code: -32601, Message: "method not found"}
+	})
+
+	t.Run("Test with a quantity result", func(t *testing.T) {
+		head, err := client.BlockNumber()
+		if err != nil || head != 16 {
+			t.Errorf("Expected block 16, got %d (%v)", head, err)
+		}
+	})
+
+	t.Run("Test with a null result", func(t *testing.T) {
+		tx, err := client.TransactionByHash("0x1")
+		if err != nil || tx != nil {
+			t.Errorf("Expected no transaction, got %+v (%v)", tx, err)
+		}
+	})
+
+	t.Run("Test with a revert error", func(t *testing.T) {
+		_, err := client.CallContract(CallMsg{To: "0x1"}, "latest")
+		rpcErr, ok := err.(*RPCError)
+		if !ok || rpcErr.Code != 3 || len(rpcErr.RevertData()) != 4 {
+			t.Errorf("Expected a revert error with data, got %v", err)
+		}
+	})
+}
+
+func TestRPCErrorExecutionFailed(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      RPCError
+		expected bool
+	}{
+		{"Test with a revert code", RPCError{Code: 3, Message: "execution reverted"}, true},
+		{"Test with revert data", RPCError{Code: -32000, Message: "reverted", Data: "0x08c379a0"}, true},
+		{"Test with an EVM error", RPCError{Code: -32000, Message: "out of gas"}, true},
+		{"Test with missing state", RPCError{Code: -32000, Message: "missing trie node 1f2e"}, false},
+		{"Test with an unknown block", RPCError{Code: -32000, Message: "header not found"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.err.ExecutionFailed() != test.expected {
+				t.Errorf("Expected %v for %q", test.expected, test.err.Message)
+			}
+		})
+	}
+}
+
+func TestBlocksByNumber(t *testing.T) {
+	var calls int
+	client := newTestServer(t, func(method string, params []json.RawMessage) (interface{}, *RPCError) {
+		calls++
+		var tag string
+		json.Unmarshal(params[0], &tag)
+		number := ParseUint(tag)
+		if number > 200 {
+			return nil, nil
+		}
+		return map[string]string{"number": tag, "timestamp": fmt.Sprintf("0x%x", 1700000000+number*12)}, nil
+	})
+
+	numbers := make([]uint64, 0, 150)
+	for i := uint64(100); i < 250; i++ {
+		numbers = append(numbers, i)
+	}
+	blocks, err := client.BlocksByNumber(numbers)
+	if err != nil {
+		t.Fatalf("BlocksByNumber returned error: %v", err)
+	}
+	if len(blocks) != len(numbers) || calls != len(numbers) {
+		t.Fatalf("Expected %d blocks, got %d in %d calls", len(numbers), len(blocks), calls)
+	}
+	if blocks[0] == nil || blocks[0].Number != "0x64" || ParseUint(blocks[0].Timestamp) != 1700001200 {
+		t.Errorf("Unexpected first block %+v", blocks[0])
+	}
+	if blocks[len(blocks)-1] != nil {
+		t.Errorf("Expected no block past the head, got %+v", blocks[len(blocks)-1])
+	}
+}
@@ -0,0 +1,195 @@
+package node
+
+import (
+	"math/big"
+)
+
+// Transaction as returned by eth_getTransactionByHash. BlockNumber is nil while pending.
+type Transaction struct {
+	Hash                 string  `json:"hash"`
+	From                 string  `json:"from"`
+	To                   string  `json:"to"`
+	Nonce                string  `json:"nonce"`
+	Value                string  `json:"value"`
+	Gas                  string  `json:"gas"`
+	GasPrice             string  `json:"gasPrice"`
+	MaxFeePerGas         string  `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string  `json:"maxPriorityFeePerGas"`
+	Input                string  `json:"input"`
+	BlockNumber          *string `json:"blockNumber"`
+	BlockHash            *string `json:"blockHash"`
+}
+
+type Receipt struct {
+	TransactionHash   string `json:"transactionHash"`
+	Status            string `json:"status"`
+	BlockNumber       string `json:"blockNumber"`
+	BlockHash         string `json:"blockHash"`
+	GasUsed           string `json:"gasUsed"`
+	EffectiveGasPrice string `json:"effectiveGasPrice"`
+}
+
+type Block struct {
+	Number        string `json:"number"`
+	Hash          string `json:"hash"`
+	ParentHash    string `json:"parentHash"`
+	Timestamp     string `json:"timestamp"`
+	BaseFeePerGas string `json:"baseFeePerGas"`
+	GasUsed       string `json:"gasUsed"`
+	GasLimit      string `json:"gasLimit"`
+}
+
+// Message for eth_call and eth_estimateGas
+type CallMsg struct {
+	From  string
+	To    string
+	Value *big.Int
+	Data  []byte
+	Gas   uint64
+}
+
+func (msg CallMsg) toArg() map[string]interface{} {
+	arg := map[string]interface{}{}
+	if msg.From != "" {
+		arg["from"] = msg.From
+	}
+	if msg.To != "" {
+		arg["to"] = msg.To
+	}
+	if msg.Value != nil {
+		arg["value"] = EncodeBig(msg.Value)
+	}
+	if len(msg.Data) > 0 {
+		arg["data"] = EncodeBytes(msg.Data)
+	}
+	if msg.Gas != 0 {
+		arg["gas"] = EncodeUint(msg.Gas)
+	}
+	return arg
+}
+
+func (c *Client) BlockNumber() (uint64, error) {
+	var result string
+	if err := c.Call(&result, "eth_blockNumber"); err != nil {
+		return 0, err
+	}
+	return ParseUint(result), nil
+}
+
+// Block header by number or tag ("latest", "pending", hex number). Nil if unknown.
+func (c *Client) BlockByNumber(tag string) (*Block, error) {
+	var block *Block
+	err := c.Call(&block, "eth_getBlockByNumber", tag, false)
+	return block, err
+}
+
+// Requests sent in one batch; nodes and providers limit the size of batches
+const maxBatchSize = 100
+
+// Block headers by number, in the order of the numbers. Unknown blocks are nil.
+func (c *Client) BlocksByNumber(numbers []uint64) ([]*Block, error) {
+	blocks := make([]*Block, len(numbers))
+	for start := 0; start < len(numbers); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(numbers) {
+			end = len(numbers)
+		}
+		requests := make([]BatchRequest, 0, end-start)
+		for i := start; i < end; i++ {
+			requests = append(requests, BatchRequest{Method: "eth_getBlockByNumber", Params: []interface{}{EncodeUint(numbers[i]), false}, Result: &blocks[i]})
+		}
+		if err := c.BatchCall(requests); err != nil {
+			return nil, err
+		}
+		for _, request := range requests {
+			if request.Error != nil {
+				return nil, request.Error
+			}
+		}
+	}
+	return blocks, nil
+}
+
+// Transaction by hash. Nil if the node does not know it.
+func (c *Client) TransactionByHash(hash string) (*Transaction, error) {
+	var tx *Transaction
+	err := c.Call(&tx, "eth_getTransactionByHash", hash)
+	return tx, err
+}
+
+// Receipt by transaction hash. Nil until the transaction is mined.
+func (c *Client) TransactionReceipt(hash string) (*Receipt, error) {
+	var receipt *Receipt
+	err := c.Call(&receipt, "eth_getTransactionReceipt", hash)
+	return receipt, err
+}
+
+// Nonce of the address at the block tag ("latest" or "pending")
+func (c *Client) TransactionCount(address, tag string) (uint64, error) {
+	var result string
+	if err := c.Call(&result, "eth_getTransactionCount", address, tag); err != nil {
+		return 0, err
+	}
+	return ParseUint(result), nil
+}
+
+// Execute eth_call at the block tag and return the output
+func (c *Client) CallContract(msg CallMsg, tag string) ([]byte, error) {
+	var result string
+	if err := c.Call(&result, "eth_call", msg.toArg(), tag); err != nil {
+		return nil, err
+	}
+	return DecodeBytes(result)
+}
+
+// Gas the message would use if sent now, from eth_estimateGas
+func (c *Client) EstimateGas(msg CallMsg) (uint64, error) {
+	var result string
+	if err := c.Call(&result, "eth_estimateGas", msg.toArg()); err != nil {
+		return 0, err
+	}
+	return ParseUint(result), nil
+}
+
+// Pending and queued transactions of an address from the node's pool, keyed by nonce.
+// Only supported by nodes exposing the txpool namespace.
+func (c *Client) TxPoolContentFrom(address string) (map[string]map[string]*Transaction, error) {
+	var content map[string]map[string]*Transaction
+	err := c.Call(&content, "txpool_contentFrom", address)
+	return content, err
+}
+
+// Result of eth_feeHistory. BaseFeePerGas has one more entry than blocks: the next block's base fee.
+type FeeHistory struct {
+	OldestBlock   string     `json:"oldestBlock"`
+	BaseFeePerGas []string   `json:"baseFeePerGas"`
+	GasUsedRatio  []float64  `json:"gasUsedRatio"`
+	Reward        [][]string `json:"reward"`
+}
+
+// Base fees, gas usage and priority fee percentiles of the blocks up to newest
+func (c *Client) FeeHistory(blocks uint64, newest string, percentiles []float64) (*FeeHistory, error) {
+	var history FeeHistory
+	if err := c.Call(&history, "eth_feeHistory", EncodeUint(blocks), newest, percentiles); err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+// Wei balance of the address at the block tag
+func (c *Client) Balance(address, tag string) (*big.Int, error) {
+	var result string
+	if err := c.Call(&result, "eth_getBalance", address, tag); err != nil {
+		return nil, err
+	}
+	return ParseBig(result), nil
+}
+
+// Deployed bytecode of the address at the block tag; empty for externally owned accounts
+func (c *Client) Code(address, tag string) ([]byte, error) {
+	var result string
+	if err := c.Call(&result, "eth_getCode", address, tag); err != nil {
+		return nil, err
+	}
+	return DecodeBytes(result)
+}
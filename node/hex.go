@@ -0,0 +1,43 @@
+package node
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Parse a hex quantity such as "0x1a". Invalid input yields zero.
+func ParseBig(s string) *big.Int {
+	value, ok := new(big.Int).SetString(strings.TrimPrefix(s, "0x"), 16)
+	if !ok {
+		return new(big.Int)
+	}
+	return value
+}
+
+// Parse a hex quantity that fits in 64 bits. Invalid input yields zero.
+func ParseUint(s string) uint64 {
+	value, err := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+func EncodeBig(value *big.Int) string {
+	return fmt.Sprintf("0x%x", value)
+}
+
+func EncodeUint(value uint64) string {
+	return fmt.Sprintf("0x%x", value)
+}
+
+func DecodeBytes(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
+
+func EncodeBytes(data []byte) string {
+	return "0x" + hex.EncodeToString(data)
+}
@@ -0,0 +1,168 @@
+package portfolio
+
+import (
+	"encoding/json"
+	"ethereye/node"
+	"ethereye/prices"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/******************
+Allocation
+******************/
+
+// Slices below this percentage of the total are grouped into "other"
+const DefaultAllocationThreshold = 1.0
+
+const (
+	GroupByToken    = "token"
+	GroupByCategory = "category"
+)
+
+const otherSlice = "other"
+
+// Share of the total value. Key is the token ("eth" or contract address) or the category;
+// Tokens lists the tokens the slice covers.
+type AllocationSlice struct {
+	Key     string   `json:"key"`
+	Label   string   `json:"label"`
+	Value   float64  `json:"value"`
+	Percent float64  `json:"percent"`
+	Tokens  []string `json:"tokens"`
+}
+
+type Allocation struct {
+	Addresses  []string          `json:"addresses"`
+	Currency   string            `json:"currency"`
+	GroupBy    string            `json:"groupBy"`
+	TotalValue float64           `json:"totalValue"`
+	Slices     []AllocationSlice `json:"slices"`
+	// Held tokens without a price, which are not part of any slice
+	Unpriced []Token `json:"unpriced"`
+}
+
+// Share of each token or category in the combined value of the addresses
+func BuildAllocation(apiKey string, client *node.Client, provider prices.PriceProvider, classification *Classification, addresses []string, currency, groupBy string, threshold float64) (Allocation, error) {
+	allocation := Allocation{Addresses: addresses, Currency: strings.ToLower(currency), GroupBy: groupBy, Slices: []AllocationSlice{}, Unpriced: []Token{}}
+
+	values := make(map[string]float64)
+	tokens := make(map[string]Token)
+	unpriced := make(map[string]bool)
+	for _, address := range addresses {
+		balances, err := FetchBalances(apiKey, client, address, false)
+		if err != nil {
+			return allocation, err
+		}
+		if err := ValueBalances(&balances, provider, currency); err != nil {
+			return allocation, err
+		}
+		for _, balance := range append([]TokenBalance{balances.ETH}, balances.Tokens...) {
+			if balance.Balance <= 0 {
+				continue
+			}
+			key := prices.TokenKey(balance.Contract)
+			tokens[key] = balance.Token
+			if balance.Value == nil {
+				if !unpriced[key] {
+					unpriced[key] = true
+					allocation.Unpriced = append(allocation.Unpriced, balance.Token)
+				}
+				continue
+			}
+			values[key] += *balance.Value
+			allocation.TotalValue += *balance.Value
+		}
+	}
+
+	slices := make(map[string]*AllocationSlice)
+	for key, value := range values {
+		sliceKey, label := key, tokens[key].Symbol
+		if groupBy == GroupByCategory {
+			sliceKey = classification.Category(key)
+			label = sliceKey
+		}
+		slice, ok := slices[sliceKey]
+		if !ok {
+			slice = &AllocationSlice{Key: sliceKey, Label: label}
+			slices[sliceKey] = slice
+		}
+		slice.Value += value
+		slice.Tokens = append(slice.Tokens, key)
+	}
+	if allocation.TotalValue <= 0 {
+		return allocation, nil
+	}
+
+	other := AllocationSlice{Key: otherSlice, Label: otherSlice, Tokens: []string{}}
+	for _, slice := range slices {
+		slice.Percent = slice.Value / allocation.TotalValue * 100
+		sort.Strings(slice.Tokens)
+		if slice.Percent < threshold {
+			other.Value += slice.Value
+			other.Percent += slice.Percent
+			other.Tokens = append(other.Tokens, slice.Tokens...)
+			continue
+		}
+		allocation.Slices = append(allocation.Slices, *slice)
+	}
+	sort.Slice(allocation.Slices, func(i, j int) bool {
+		if allocation.Slices[i].Value != allocation.Slices[j].Value {
+			return allocation.Slices[i].Value > allocation.Slices[j].Value
+		}
+		return allocation.Slices[i].Key < allocation.Slices[j].Key
+	})
+	if len(other.Tokens) > 0 {
+		sort.Strings(other.Tokens)
+		allocation.Slices = append(allocation.Slices, other)
+	}
+	return allocation, nil
+}
+
+// GET /api/v1/portfolio/allocation?address={address,...}&group={id}&groupBy={token|category}&threshold={percent}&currency={usd|eur|...}
+func AllocationHandler(apiKey string, client *node.Client, provider prices.PriceProvider, classification *Classification) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if provider == nil {
+			http.Error(w, "price provider not configured", http.StatusServiceUnavailable)
+			return
+		}
+		query := r.URL.Query()
+		addresses, ok := requestAddresses(w, query)
+		if !ok {
+			return
+		}
+		groupBy := query.Get("groupBy")
+		if groupBy == "" {
+			groupBy = GroupByToken
+		}
+		if groupBy != GroupByToken && groupBy != GroupByCategory {
+			http.Error(w, "Invalid groupBy, expected token or category", http.StatusBadRequest)
+			return
+		}
+		threshold := DefaultAllocationThreshold
+		if value := query.Get("threshold"); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed < 0 || parsed > 100 {
+				http.Error(w, "Invalid threshold, expected a percentage from 0 to 100", http.StatusBadRequest)
+				return
+			}
+			threshold = parsed
+		}
+		currency := query.Get("currency")
+		if currency == "" {
+			currency = prices.DefaultCurrency
+		}
+
+		allocation, err := BuildAllocation(apiKey, client, provider, classification, addresses, currency, groupBy, threshold)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error building allocation: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(allocation)
+	}
+}
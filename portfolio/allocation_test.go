@@ -0,0 +1,95 @@
+package portfolio
+
+import (
+	"ethereye/prices"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildAllocation(t *testing.T) {
+	useFakeEtherscan(t, map[string]interface{}{
+		"tokentx":              tokenTransfers,
+		"balance":              "1000000000000000000",
+		"tokenbalance:" + usdc: "90000000",
+		"tokenbalance:" + dai:  "10000000000000000000",
+		"tokenbalance:" + shib: "1000000000000000000000",
+	})
+	provider := fixedPrices{prices.ETH: 2000, usdc: 1, dai: 1}
+	other := "0x2222222222222222222222222222222222222222"
+
+	t.Run("Test grouped by token", func(t *testing.T) {
+		allocation, err := BuildAllocation("", nil, provider, DefaultClassification, []string{wallet, other}, "usd", GroupByToken, DefaultAllocationThreshold)
+		if err != nil {
+			t.Fatalf("BuildAllocation returned error: %v", err)
+		}
+		if allocation.TotalValue != 4200 {
+			t.Errorf("Expected a total value of 4200, got %f", allocation.TotalValue)
+		}
+		// DAI is under 1% and falls into other
+		expected := []string{prices.ETH, usdc, otherSlice}
+		if len(allocation.Slices) != len(expected) {
+			t.Fatalf("Unexpected slices %+v", allocation.Slices)
+		}
+		for i, slice := range allocation.Slices {
+			if slice.Key != expected[i] {
+				t.Errorf("Expected slice %d to be %s, got %s", i, expected[i], slice.Key)
+			}
+		}
+		if last := allocation.Slices[2]; last.Value != 20 || len(last.Tokens) != 1 || last.Tokens[0] != dai {
+			t.Errorf("Unexpected other slice %+v", last)
+		}
+		if len(allocation.Unpriced) != 1 || allocation.Unpriced[0].Symbol != "SHIB" {
+			t.Errorf("Expected SHIB to be unpriced, got %+v", allocation.Unpriced)
+		}
+	})
+
+	t.Run("Test grouped by category", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "categories.json")
+		os.WriteFile(filename, []byte(`{"stablecoins": ["`+usdc+`", "`+dai+`"], "eth": ["eth"]}`), 0644)
+		classification, err := LoadClassification(filename)
+		if err != nil {
+			t.Fatalf("LoadClassification returned error: %v", err)
+		}
+
+		allocation, err := BuildAllocation("", nil, provider, classification, []string{wallet}, "usd", GroupByCategory, DefaultAllocationThreshold)
+		if err != nil {
+			t.Fatalf("BuildAllocation returned error: %v", err)
+		}
+		if len(allocation.Slices) != 2 || allocation.Slices[0].Key != CategoryETH || allocation.Slices[1].Key != CategoryStablecoins {
+			t.Fatalf("Unexpected slices %+v", allocation.Slices)
+		}
+		if math.Abs(allocation.Slices[1].Percent-100.0/21) > 1e-9 || len(allocation.Slices[1].Tokens) != 2 {
+			t.Errorf("Unexpected stablecoin slice %+v", allocation.Slices[1])
+		}
+	})
+}
+
+func TestAllocationHandler(t *testing.T) {
+	useFakeEtherscan(t, map[string]interface{}{"balance": "0"})
+	handler := AllocationHandler("", nil, fixedPrices{}, DefaultClassification)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"Test with missing address", "", http.StatusBadRequest},
+		{"Test with an invalid address in the list", "?address=" + wallet + ",0x12", http.StatusBadRequest},
+		{"Test with invalid groupBy", "?address=" + wallet + "&groupBy=chain", http.StatusBadRequest},
+		{"Test with invalid threshold", "?address=" + wallet + "&threshold=150", http.StatusBadRequest},
+		{"Test with valid request", "?address=" + wallet + "&groupBy=category&threshold=5", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/portfolio/allocation"+test.query, nil))
+			if rr.Code != test.expected {
+				t.Errorf("Expected status code %d, got %d", test.expected, rr.Code)
+			}
+		})
+	}
+}
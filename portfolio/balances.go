@@ -0,0 +1,263 @@
+package portfolio
+
+import (
+	"encoding/json"
+	"ethereye/abi"
+	"ethereye/node"
+	"ethereye/prices"
+	. "ethereye/transactions"
+	. "ethereye/utils"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+/******************
+Balances
+******************/
+
+var balanceOfSelector = abi.Selector("balanceOf(address)")
+
+// ERC-20 token metadata. Ether is represented with an empty contract address.
+type Token struct {
+	Contract string `json:"contractAddress"`
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+}
+
+var Ether = Token{Name: "Ether", Symbol: "ETH", Decimals: EtherDecimals}
+
+// Balance of a token. RawBalance is the integer amount, Balance the amount scaled by the token's decimals.
+// Price and Value are in the fiat currency of the balances, and left out when the token has no known price.
+type TokenBalance struct {
+	Token
+	RawBalance string   `json:"rawBalance"`
+	Balance    float64  `json:"balance"`
+	Price      *float64 `json:"price,omitempty"`
+	Value      *float64 `json:"value,omitempty"`
+}
+
+func newTokenBalance(token Token, raw *big.Int) TokenBalance {
+	return TokenBalance{Token: token, RawBalance: raw.String(), Balance: ToFloat(raw, token.Decimals)}
+}
+
+// Balances of an address, or the combined balances of a wallet group's addresses.
+// PricingError is set when the balances could not be valued, in which case they come without prices.
+type Balances struct {
+	Address      string         `json:"address,omitempty"`
+	Addresses    []string       `json:"addresses,omitempty"`
+	ETH          TokenBalance   `json:"eth"`
+	Tokens       []TokenBalance `json:"tokens"`
+	Currency     string         `json:"currency,omitempty"`
+	TotalValue   *float64       `json:"totalValue,omitempty"`
+	PricingError string         `json:"pricingError,omitempty"`
+}
+
+// Tokens the address ever sent or received, in order of first transfer
+func DiscoverTokens(apiKey, address string) ([]Token, error) {
+	transfers, err := FetchTokenTransfers(apiKey, address)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []Token
+	seen := make(map[string]bool)
+	for _, transfer := range transfers {
+		if seen[transfer.ContractAddr] {
+			continue
+		}
+		seen[transfer.ContractAddr] = true
+		tokens = append(tokens, Token{
+			Contract: transfer.ContractAddr,
+			Name:     transfer.TokenName,
+			Symbol:   transfer.TokenSymbol,
+			Decimals: transfer.TokenDecimal,
+		})
+	}
+	return tokens, nil
+}
+
+// ETH and ERC-20 balances of the address. Balances are read from the node backend when
+// configured, otherwise from Etherscan. Tokens with a zero balance are left out unless includeZero is set.
+func FetchBalances(apiKey string, client *node.Client, address string, includeZero bool) (Balances, error) {
+	balances := Balances{Address: strings.ToLower(address), Tokens: []TokenBalance{}}
+
+	tokens, err := DiscoverTokens(apiKey, address)
+	if err != nil {
+		return balances, err
+	}
+
+	var eth *big.Int
+	var raw []*big.Int
+	if client != nil {
+		if eth, err = client.Balance(address, "latest"); err != nil {
+			return balances, err
+		}
+		raw, err = tokenBalancesFromNode(client, address, tokens)
+	} else {
+		if eth, err = etherscanBalance(apiKey, address); err != nil {
+			return balances, err
+		}
+		raw, err = tokenBalancesFromEtherscan(apiKey, address, tokens)
+	}
+	if err != nil {
+		return balances, err
+	}
+
+	balances.ETH = newTokenBalance(Ether, eth)
+	for i, token := range tokens {
+		if raw[i].Sign() == 0 && !includeZero {
+			continue
+		}
+		balances.Tokens = append(balances.Tokens, newTokenBalance(token, raw[i]))
+	}
+	sort.SliceStable(balances.Tokens, func(i, j int) bool { return balances.Tokens[i].Symbol < balances.Tokens[j].Symbol })
+	return balances, nil
+}
+
+// Price every balance at current prices and sum the total value. Tokens without a price do not count towards the total.
+func ValueBalances(balances *Balances, provider prices.PriceProvider, currency string) error {
+	tokens := []string{prices.ETH}
+	for _, token := range balances.Tokens {
+		tokens = append(tokens, token.Contract)
+	}
+	spot, err := provider.SpotPrices(tokens, currency)
+	if err != nil {
+		return err
+	}
+
+	total := 0.0
+	value := func(balance *TokenBalance) {
+		price, ok := spot[prices.TokenKey(balance.Contract)]
+		if !ok {
+			return
+		}
+		worth := balance.Balance * price
+		balance.Price = &price
+		balance.Value = &worth
+		total += worth
+	}
+	value(&balances.ETH)
+	for i := range balances.Tokens {
+		value(&balances.Tokens[i])
+	}
+	balances.Currency = strings.ToLower(currency)
+	balances.TotalValue = &total
+	return nil
+}
+
+func balanceOfCall(token Token, owner string) (call, error) {
+	word, err := abi.EncodeAddress(owner)
+	if err != nil {
+		return call{}, err
+	}
+	return call{target: token.Contract, data: append(append([]byte(nil), balanceOfSelector...), word...)}, nil
+}
+
+// balanceOf of every token, batched through Multicall3 and falling back to one eth_call per token.
+// Tokens whose call reverts count as a zero balance; other node errors are returned.
+func tokenBalancesFromNode(client *node.Client, owner string, tokens []Token) ([]*big.Int, error) {
+	calls := make([]call, len(tokens))
+	for i, token := range tokens {
+		c, err := balanceOfCall(token, owner)
+		if err != nil {
+			return nil, err
+		}
+		calls[i] = c
+	}
+	if len(calls) == 0 {
+		return nil, nil
+	}
+
+	results, err := multicall(client, calls, "latest")
+	if err != nil {
+		// Multicall3 is not deployed or the node rejected the batch
+		results = make([]callResult, len(calls))
+		for i, c := range calls {
+			output, err := client.CallContract(node.CallMsg{To: c.target, Data: c.data}, "latest")
+			if rpcErr, ok := err.(*node.RPCError); ok && rpcErr.ExecutionFailed() {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			results[i] = callResult{success: true, data: output}
+		}
+	}
+
+	balances := make([]*big.Int, len(results))
+	for i, result := range results {
+		balances[i] = new(big.Int)
+		if !result.success {
+			continue
+		}
+		if value, err := abi.DecodeUint(result.data, 0); err == nil {
+			balances[i] = value
+		}
+	}
+	return balances, nil
+}
+
+func etherscanBalance(apiKey, address string) (*big.Int, error) {
+	data, err := FetchEtherscan(map[string]string{"module": "account", "action": "balance", "address": address, "tag": "latest"}, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	if data["status"] != "1" {
+		return nil, fmt.Errorf("error fetching balance: %v", data["result"])
+	}
+	return ParseBigInt(fmt.Sprint(data["result"])), nil
+}
+
+func tokenBalancesFromEtherscan(apiKey, address string, tokens []Token) ([]*big.Int, error) {
+	balances := make([]*big.Int, len(tokens))
+	for i, token := range tokens {
+		data, err := FetchEtherscan(map[string]string{
+			"module":          "account",
+			"action":          "tokenbalance",
+			"contractaddress": token.Contract,
+			"address":         address,
+			"tag":             "latest",
+		}, apiKey)
+		if err != nil {
+			return nil, err
+		}
+		if data["status"] != "1" {
+			return nil, fmt.Errorf("error fetching %s balance: %v", token.Symbol, data["result"])
+		}
+		balances[i] = ParseBigInt(fmt.Sprint(data["result"]))
+	}
+	return balances, nil
+}
+
+// GET /api/v1/portfolio/balances?address={address,...}&group={id}&includeZero={true|false}&currency={usd|eur|...}
+func BalancesHandler(apiKey string, client *node.Client, provider prices.PriceProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		addresses, ok := requestAddresses(w, r.URL.Query())
+		if !ok {
+			return
+		}
+		includeZero := r.URL.Query().Get("includeZero") == "true"
+		currency := r.URL.Query().Get("currency")
+		if currency == "" {
+			currency = prices.DefaultCurrency
+		}
+
+		balances, err := FetchGroupBalances(apiKey, client, addresses, includeZero)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching balances: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+		// The balances are still worth returning when the price provider is down
+		if provider != nil {
+			if err := ValueBalances(&balances, provider, currency); err != nil {
+				balances.PricingError = fmt.Sprintf("Error fetching prices: %s", err.Error())
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(balances)
+	}
+}
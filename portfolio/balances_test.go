@@ -0,0 +1,288 @@
+package portfolio
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"ethereye/abi"
+	"ethereye/internal/testutil"
+	"ethereye/node"
+	"ethereye/prices"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+/************
+common
+************/
+
+const (
+	wallet = "0x1111111111111111111111111111111111111111"
+	usdc   = "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"
+	dai    = "0x6b175474e89094c44da98b954eedeac495271d0f"
+	shib   = "0x95ad61b0a150d79219dcf64e1e6cc01f0b64c4ce"
+)
+
+// Token transfers of USDC, DAI and SHIB to and from the wallet
+var tokenTransfers = []map[string]string{
+	{"blockNumber": "1", "timeStamp": "1", "hash": "0x1", "from": "0x2", "to": wallet, "value": "1", "contractAddress": usdc, "tokenName": "USD Coin", "tokenSymbol": "USDC", "tokenDecimal": "6"},
+	{"blockNumber": "2", "timeStamp": "2", "hash": "0x2", "from": "0x2", "to": wallet, "value": "1", "contractAddress": strings.ToUpper(dai[:2]) + dai[2:], "tokenName": "Dai Stablecoin", "tokenSymbol": "DAI", "tokenDecimal": "18"},
+	{"blockNumber": "3", "timeStamp": "3", "hash": "0x3", "from": wallet, "to": "0x2", "value": "1", "contractAddress": usdc, "tokenName": "USD Coin", "tokenSymbol": "USDC", "tokenDecimal": "6"},
+	{"blockNumber": "4", "timeStamp": "4", "hash": "0x4", "from": "0x2", "to": wallet, "value": "1", "contractAddress": shib, "tokenName": "SHIBA INU", "tokenSymbol": "SHIB", "tokenDecimal": "18"},
+}
+
+// Fake Etherscan answering each action with the given result. Token balances are looked up
+// as "tokenbalance:{contract}"; a result under "{action}@{address}" answers for that address only.
+// Account lists are cut at the requested start block. Actions without a result report no transactions.
+// Returns the queries received.
+func useFakeEtherscan(t *testing.T, results map[string]interface{}) *[]url.Values {
+	return testutil.UseFakeEtherscan(t, func(query url.Values) interface{} {
+		action := query.Get("action")
+		if contract := query.Get("contractaddress"); contract != "" {
+			action += ":" + contract
+		}
+		result, ok := results[action+"@"+strings.ToLower(query.Get("address"))]
+		if !ok {
+			result, ok = results[action]
+		}
+		if records, isList := result.([]map[string]string); ok && isList {
+			startBlock, _ := strconv.ParseUint(query.Get("startblock"), 10, 64)
+			var kept []map[string]string
+			for _, record := range records {
+				if block, _ := strconv.ParseUint(record["blockNumber"], 10, 64); block >= startBlock {
+					kept = append(kept, record)
+				}
+			}
+			return testutil.ListResponse(kept)
+		}
+		if !ok {
+			return testutil.ListResponse(nil)
+		}
+		return testutil.Response(result)
+	})
+}
+
+// Fake node answering balanceOf on the given tokens, directly or through Multicall3 when withMulticall is set
+func newFakeNode(t *testing.T, balances map[string]*big.Int, withMulticall bool) *node.Client {
+	balanceOf := func(target string, data []byte) ([]byte, bool) {
+		balance, ok := balances[strings.ToLower(target)]
+		if !ok || len(data) != 36 || hex.EncodeToString(data[:4]) != "70a08231" {
+			return nil, false
+		}
+		return abi.EncodeUint(balance), true
+	}
+
+	return testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+		"eth_getBalance": testutil.Result(node.EncodeBig(balances[""])),
+		"eth_call": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+			var msg struct {
+				To   string `json:"to"`
+				Data string `json:"data"`
+			}
+			json.Unmarshal(params[0], &msg)
+			data, _ := node.DecodeBytes(msg.Data)
+			if strings.EqualFold(msg.To, Multicall3Address) {
+				if !withMulticall {
+					return "0x", nil
+				}
+				return node.EncodeBytes(fakeAggregate3(data[4:], balanceOf)), nil
+			}
+			if output, ok := balanceOf(msg.To, data); ok {
+				return node.EncodeBytes(output), nil
+			}
+			return nil, &node.RPCError{Code: 3, Message: "execution reverted"}
+		},
+	})
+}
+
+// Execute the Call3[] argument of aggregate3 and encode the Result[] it returns
+func fakeAggregate3(args []byte, execute func(target string, data []byte) ([]byte, bool)) []byte {
+	start, _ := abi.DecodeUint(args, 0)
+	array := args[start.Int64():]
+	count, _ := abi.DecodeUint(array, 0)
+	heads := array[abi.WordSize:]
+
+	output := append(abi.EncodeUint(big.NewInt(abi.WordSize)), abi.EncodeUint(count)...)
+	var tails []byte
+	for i := 0; i < int(count.Int64()); i++ {
+		offset, _ := abi.DecodeUint(heads, i*abi.WordSize)
+		tuple := heads[offset.Int64():]
+		target, _ := abi.DecodeValue(tuple, 0, "address")
+		data, _ := abi.DecodeBytes(tuple, 2*abi.WordSize)
+		returned, success := execute(target, data)
+
+		output = append(output, abi.EncodeUint(big.NewInt(int64(int(count.Int64())*abi.WordSize+len(tails))))...)
+		tails = append(tails, abi.EncodeBool(success)...)
+		tails = append(tails, abi.EncodeUint(big.NewInt(2*abi.WordSize))...)
+		tails = append(tails, abi.EncodeDynamicBytes(returned)...)
+	}
+	return append(output, tails...)
+}
+
+// Price provider with fixed spot prices
+type fixedPrices map[string]float64
+
+func (p fixedPrices) SpotPrices(tokens []string, currency string) (map[string]float64, error) {
+	result := make(map[string]float64)
+	for _, token := range tokens {
+		if price, ok := p[prices.TokenKey(token)]; ok {
+			result[prices.TokenKey(token)] = price
+		}
+	}
+	return result, nil
+}
+
+func (p fixedPrices) HistoricalPrice(token, currency string, at time.Time) (float64, error) {
+	if price, ok := p[prices.TokenKey(token)]; ok {
+		return price, nil
+	}
+	return 0, prices.ErrPriceNotFound
+}
+
+// Price provider whose API is down
+type failingPrices struct{}
+
+func (failingPrices) SpotPrices(tokens []string, currency string) (map[string]float64, error) {
+	return nil, errors.New("rate limited")
+}
+
+func (failingPrices) HistoricalPrice(token, currency string, at time.Time) (float64, error) {
+	return 0, errors.New("rate limited")
+}
+
+/************
+test body
+************/
+
+func TestFetchBalances(t *testing.T) {
+	useFakeEtherscan(t, map[string]interface{}{
+		"tokentx":              tokenTransfers,
+		"balance":              "1500000000000000000",
+		"tokenbalance:" + usdc: "2500000",
+		"tokenbalance:" + dai:  "0",
+		"tokenbalance:" + shib: "1000000000000000000000",
+	})
+	nodeBalances := map[string]*big.Int{"": big.NewInt(2e18), usdc: big.NewInt(1e6), dai: big.NewInt(0)}
+
+	check := func(t *testing.T, balances Balances, eth float64, expected map[string]float64) {
+		if balances.ETH.Balance != eth || balances.ETH.Symbol != "ETH" {
+			t.Errorf("Unexpected ETH balance %+v", balances.ETH)
+		}
+		if len(balances.Tokens) != len(expected) {
+			t.Fatalf("Expected %d tokens, got %+v", len(expected), balances.Tokens)
+		}
+		for _, token := range balances.Tokens {
+			if balance, ok := expected[token.Symbol]; !ok || token.Balance != balance {
+				t.Errorf("Unexpected balance %+v", token)
+			}
+		}
+	}
+
+	t.Run("Test with multicall", func(t *testing.T) {
+		balances, err := FetchBalances("", newFakeNode(t, nodeBalances, true), wallet, false)
+		if err != nil {
+			t.Fatalf("FetchBalances returned error: %v", err)
+		}
+		// SHIB is not known to the fake node, so its balanceOf fails and counts as zero
+		check(t, balances, 2, map[string]float64{"USDC": 1})
+		if balances.Tokens[0].Name != "USD Coin" || balances.Tokens[0].Decimals != 6 || balances.Tokens[0].RawBalance != "1000000" {
+			t.Errorf("Unexpected token metadata %+v", balances.Tokens[0])
+		}
+	})
+
+	t.Run("Test without multicall", func(t *testing.T) {
+		balances, err := FetchBalances("", newFakeNode(t, nodeBalances, false), wallet, true)
+		if err != nil {
+			t.Fatalf("FetchBalances returned error: %v", err)
+		}
+		check(t, balances, 2, map[string]float64{"USDC": 1, "DAI": 0, "SHIB": 0})
+	})
+
+	t.Run("Test with node error", func(t *testing.T) {
+		// A node that lost the state fails every call without executing it
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+			"eth_getBalance": testutil.Result(node.EncodeBig(big.NewInt(2e18))),
+			"eth_call": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+				return nil, &node.RPCError{Code: -32000, Message: "missing trie node 1f2e"}
+			},
+		})
+		if _, err := FetchBalances("", client, wallet, false); err == nil {
+			t.Errorf("Expected an error instead of zero balances")
+		}
+	})
+
+	t.Run("Test without node backend", func(t *testing.T) {
+		balances, err := FetchBalances("", nil, wallet, false)
+		if err != nil {
+			t.Fatalf("FetchBalances returned error: %v", err)
+		}
+		check(t, balances, 1.5, map[string]float64{"USDC": 2.5, "SHIB": 1000})
+	})
+}
+
+func TestValueBalances(t *testing.T) {
+	balances := Balances{
+		ETH: newTokenBalance(Ether, big.NewInt(2e18)),
+		Tokens: []TokenBalance{
+			newTokenBalance(Token{Contract: usdc, Symbol: "USDC", Decimals: 6}, big.NewInt(5e6)),
+			newTokenBalance(Token{Contract: shib, Symbol: "SHIB", Decimals: 18}, big.NewInt(1e18)),
+		},
+	}
+	if err := ValueBalances(&balances, fixedPrices{prices.ETH: 3000, usdc: 1}, "USD"); err != nil {
+		t.Fatalf("ValueBalances returned error: %v", err)
+	}
+	if balances.ETH.Value == nil || *balances.ETH.Value != 6000 {
+		t.Errorf("Unexpected ETH value %v", balances.ETH.Value)
+	}
+	if balances.Tokens[0].Value == nil || *balances.Tokens[0].Value != 5 {
+		t.Errorf("Unexpected USDC value %v", balances.Tokens[0].Value)
+	}
+	if balances.Tokens[1].Price != nil || balances.Tokens[1].Value != nil {
+		t.Errorf("Expected no value for a token without price, got %+v", balances.Tokens[1])
+	}
+	if balances.TotalValue == nil || *balances.TotalValue != 6005 || balances.Currency != "usd" {
+		t.Errorf("Unexpected total value %v %s", balances.TotalValue, balances.Currency)
+	}
+}
+
+func TestBalancesHandler(t *testing.T) {
+	useFakeEtherscan(t, map[string]interface{}{"balance": "0"})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"Test with missing address", "", http.StatusBadRequest},
+		{"Test with invalid address", "?address=0x123", http.StatusBadRequest},
+		{"Test with valid address", "?address=" + wallet, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			BalancesHandler("", nil, nil).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/portfolio/balances"+test.query, nil))
+			if rr.Code != test.expected {
+				t.Errorf("Expected status code %d, got %d", test.expected, rr.Code)
+			}
+		})
+	}
+
+	t.Run("Test with a failing price provider", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		BalancesHandler("", nil, failingPrices{}).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/portfolio/balances?address="+wallet, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		var balances Balances
+		json.NewDecoder(rr.Body).Decode(&balances)
+		if balances.PricingError == "" || balances.TotalValue != nil || balances.ETH.RawBalance != "0" {
+			t.Errorf("Expected unvalued balances with a pricing error, got %+v", balances)
+		}
+	})
+}
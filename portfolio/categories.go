@@ -0,0 +1,83 @@
+package portfolio
+
+import (
+	"encoding/json"
+	"ethereye/prices"
+	"io/ioutil"
+)
+
+/******************
+Token Categories
+******************/
+
+const (
+	CategoryStablecoins   = "stablecoins"
+	CategoryETH           = "eth"
+	CategoryGovernance    = "governance"
+	CategoryNFT           = "nft"
+	CategoryUncategorized = "uncategorized"
+)
+
+// Category of every classified token, keyed by token ("eth" or the contract address)
+type Classification struct {
+	categories map[string]string
+}
+
+// Build a classification from lists of tokens per category
+func NewClassification(tokens map[string][]string) *Classification {
+	c := &Classification{categories: make(map[string]string)}
+	for category, keys := range tokens {
+		for _, key := range keys {
+			c.categories[prices.TokenKey(key)] = category
+		}
+	}
+	return c
+}
+
+// Load a classification file mapping categories to token lists:
+//
+//	{"stablecoins": ["0xa0b8..."], "eth": ["eth", "0xae7a..."]}
+func LoadClassification(filename string) (*Classification, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var tokens map[string][]string
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, err
+	}
+	return NewClassification(tokens), nil
+}
+
+func (c *Classification) Category(token string) string {
+	if category, ok := c.categories[prices.TokenKey(token)]; ok {
+		return category
+	}
+	return CategoryUncategorized
+}
+
+// Well-known mainnet tokens, used unless a classification file is configured
+var DefaultClassification = NewClassification(map[string][]string{
+	CategoryStablecoins: {
+		"0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", // USDC
+		"0xdac17f958d2ee523a2206206994597c13d831ec7", // USDT
+		"0x6b175474e89094c44da98b954eedeac495271d0f", // DAI
+	},
+	CategoryETH: {
+		prices.ETH,
+		"0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2", // WETH
+		"0xae7ab96520de3a18e5e111b5eaab095312d7fe84", // stETH
+		"0x7f39c581f595b53c5cb19bd0b3f8da6c935e2ca0", // wstETH
+		"0xae78736cd615f374d3085123a210448e74fc6393", // rETH
+	},
+	CategoryGovernance: {
+		"0x1f9840a85d5af5bf1d1762f925bdaddc4201f984", // UNI
+		"0x7fc66500c84a76ad7e9c93437bfc5ac33e2ddae9", // AAVE
+		"0x9f8f72aa9304c8b593d555f12ef6589cc3a579a2", // MKR
+		"0xc00e94cb662c3520282e6f5717214004a7f26888", // COMP
+		"0x5a98fcbea516cf06857215779fd812ca3bef1b32", // LDO
+	},
+	CategoryNFT: {
+		"0xbc4ca0eda7647a8ab7c2061c2e118a18a936f13d", // BAYC
+	},
+})
@@ -0,0 +1,80 @@
+package portfolio
+
+import (
+	"ethereye/node"
+	. "ethereye/transactions"
+	. "ethereye/utils"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+/******************
+Wallet Groups
+******************/
+
+// Addresses of the request's 'group' or 'address' parameters. Writes the error response and returns false when invalid.
+func requestAddresses(w http.ResponseWriter, query url.Values) ([]string, bool) {
+	return RequireAddresses(w, query)
+}
+
+// Combined balances of the addresses. A single address is fetched as is.
+func FetchGroupBalances(apiKey string, client *node.Client, addresses []string, includeZero bool) (Balances, error) {
+	if len(addresses) == 1 {
+		return FetchBalances(apiKey, client, addresses[0], includeZero)
+	}
+
+	combined := Balances{Addresses: addresses, Tokens: []TokenBalance{}}
+	eth := new(big.Int)
+	raw := make(map[string]*big.Int)
+	var tokens []Token
+	for _, address := range addresses {
+		balances, err := FetchBalances(apiKey, client, address, true)
+		if err != nil {
+			return combined, err
+		}
+		eth.Add(eth, ParseBigInt(balances.ETH.RawBalance))
+		for _, balance := range balances.Tokens {
+			if raw[balance.Contract] == nil {
+				raw[balance.Contract] = new(big.Int)
+				tokens = append(tokens, balance.Token)
+			}
+			raw[balance.Contract].Add(raw[balance.Contract], ParseBigInt(balance.RawBalance))
+		}
+	}
+
+	combined.ETH = newTokenBalance(Ether, eth)
+	for _, token := range tokens {
+		if raw[token.Contract].Sign() == 0 && !includeZero {
+			continue
+		}
+		combined.Tokens = append(combined.Tokens, newTokenBalance(token, raw[token.Contract]))
+	}
+	sort.SliceStable(combined.Tokens, func(i, j int) bool { return combined.Tokens[i].Symbol < combined.Tokens[j].Symbol })
+	return combined, nil
+}
+
+// Balance changes of all the addresses from the start block on, oldest first. Transfers between two
+// of them are not income or expense of the group and are left out; the gas paid for them still counts.
+func fetchGroupMovements(apiKey string, addresses []string, startBlock uint64) ([]movement, error) {
+	if len(addresses) == 1 {
+		return fetchMovements(apiKey, addresses[0], startBlock)
+	}
+
+	var movements []movement
+	for _, address := range addresses {
+		members, err := fetchMovements(apiKey, address, startBlock)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			if !m.fee && IsInternalTransfer(address, m.counterparty, addresses) {
+				continue
+			}
+			movements = append(movements, m)
+		}
+	}
+	sort.SliceStable(movements, func(i, j int) bool { return movements[i].time.Before(movements[j].time) })
+	return movements, nil
+}
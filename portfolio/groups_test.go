@@ -0,0 +1,102 @@
+package portfolio
+
+import (
+	"ethereye/prices"
+	. "ethereye/transactions"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const savings = "0x4444444444444444444444444444444444444444"
+
+// Wallet groups by ID
+type fakeGroups map[string][]string
+
+func (g fakeGroups) GroupAddresses(id string) ([]string, bool) {
+	addresses, ok := g[id]
+	return addresses, ok
+}
+
+func useFakeGroups(t *testing.T) {
+	UseGroups(fakeGroups{"household": {wallet, savings}})
+	t.Cleanup(func() { UseGroups(nil) })
+}
+
+func TestFetchGroupMovements(t *testing.T) {
+	// The wallet moves 1 ETH to savings, which also received 2 ETH from outside
+	transfer := map[string]string{"hash": "0xa", "from": wallet, "to": savings, "value": "1000000000000000000", "gasPrice": "1000000000", "gasUsed": "21000", "blockNumber": "1", "timeStamp": "100", "txreceipt_status": "1"}
+	useFakeEtherscan(t, map[string]interface{}{
+		"txlist@" + wallet: []map[string]string{transfer},
+		"txlist@" + savings: []map[string]string{
+			transfer,
+			{"hash": "0xb", "from": "0x2", "to": savings, "value": "2000000000000000000", "gasPrice": "1000000000", "gasUsed": "21000", "blockNumber": "2", "timeStamp": "200", "txreceipt_status": "1"},
+		},
+	})
+
+	movements, err := fetchGroupMovements("", []string{wallet, savings}, 0)
+	if err != nil {
+		t.Fatalf("fetchGroupMovements returned error: %v", err)
+	}
+	if len(movements) != 2 {
+		t.Fatalf("Expected the fee and the external deposit, got %+v", movements)
+	}
+	if !movements[0].fee || movements[0].amount.String() != "-21000000000000" {
+		t.Errorf("Unexpected fee movement %+v", movements[0])
+	}
+	if movements[1].hash != "0xb" || movements[1].amount.String() != "2000000000000000000" {
+		t.Errorf("Unexpected deposit movement %+v", movements[1])
+	}
+}
+
+func TestFetchGroupBalances(t *testing.T) {
+	useFakeEtherscan(t, map[string]interface{}{
+		"tokentx":              tokenTransfers,
+		"balance@" + wallet:    "1000000000000000000",
+		"balance@" + savings:   "500000000000000000",
+		"tokenbalance:" + usdc: "2500000",
+		"tokenbalance:" + dai:  "0",
+		"tokenbalance:" + shib: "0",
+	})
+
+	balances, err := FetchGroupBalances("", nil, []string{wallet, savings}, false)
+	if err != nil {
+		t.Fatalf("FetchGroupBalances returned error: %v", err)
+	}
+	if balances.ETH.Balance != 1.5 || len(balances.Addresses) != 2 || balances.Address != "" {
+		t.Errorf("Unexpected combined balances %+v", balances)
+	}
+	if len(balances.Tokens) != 1 || balances.Tokens[0].Symbol != "USDC" || balances.Tokens[0].Balance != 5 {
+		t.Errorf("Unexpected combined tokens %+v", balances.Tokens)
+	}
+}
+
+func TestGroupParameter(t *testing.T) {
+	useFakeGroups(t)
+	useFakeEtherscan(t, map[string]interface{}{"balance": "0"})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"Test with unknown group", "?group=office", http.StatusNotFound},
+		{"Test with known group", "?group=household", http.StatusOK},
+	}
+	handlers := map[string]http.HandlerFunc{
+		"balances":   BalancesHandler("", nil, nil),
+		"history":    ValueHistoryHandler("", fixedPrices{prices.ETH: 2000}, nil),
+		"allocation": AllocationHandler("", nil, fixedPrices{prices.ETH: 2000}, DefaultClassification),
+	}
+	for endpoint, handler := range handlers {
+		for _, test := range tests {
+			t.Run(test.name+" on "+endpoint, func(t *testing.T) {
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/portfolio/"+endpoint+test.query, nil))
+				if rr.Code != test.expected {
+					t.Errorf("Expected status code %d, got %d", test.expected, rr.Code)
+				}
+			})
+		}
+	}
+}
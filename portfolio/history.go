@@ -0,0 +1,320 @@
+package portfolio
+
+import (
+	"encoding/json"
+	"errors"
+	"ethereye/prices"
+	. "ethereye/utils"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/******************
+Value History
+******************/
+
+const (
+	IntervalDay  = "day"
+	IntervalHour = "hour"
+)
+
+var intervals = map[string]time.Duration{IntervalDay: 24 * time.Hour, IntervalHour: time.Hour}
+
+// Most points a single request may cover
+const maxHistoryPoints = 2000
+
+// Points this recent are not cached, as transfers may still be missing from the explorer
+const historyFinality = 15 * time.Minute
+
+var errTooManyPoints = fmt.Errorf("range too large, at most %d points", maxHistoryPoints)
+
+// Holding of a token at a point. Price is left out when unknown, in which case Value is zero.
+type TokenValue struct {
+	Balance float64  `json:"balance"`
+	Price   *float64 `json:"price,omitempty"`
+	Value   float64  `json:"value"`
+}
+
+// Holdings at the given time, keyed by token ("eth" or the contract address)
+type ValuePoint struct {
+	Time   time.Time             `json:"time"`
+	Value  float64               `json:"value"`
+	Tokens map[string]TokenValue `json:"tokens"`
+}
+
+type ValueHistory struct {
+	Address   string       `json:"address,omitempty"`
+	Addresses []string     `json:"addresses,omitempty"`
+	Currency  string       `json:"currency"`
+	Interval  string       `json:"interval"`
+	Tokens    []Token      `json:"tokens"`
+	Points    []ValuePoint `json:"points"`
+}
+
+// Computed points, persisted as a JSON file so extending a range only values the new points.
+// The movements behind them are kept in memory, so a later request only fetches newer blocks.
+type HistoryCache struct {
+	filename  string
+	mu        sync.RWMutex
+	points    map[string]map[int64]ValuePoint
+	movements map[string]cachedMovements
+}
+
+// Final movements of a set of addresses, up to and including the last block
+type cachedMovements struct {
+	lastBlock uint64
+	movements []movement
+}
+
+func NewHistoryCache(filename string) *HistoryCache {
+	return &HistoryCache{filename: filename, points: make(map[string]map[int64]ValuePoint), movements: make(map[string]cachedMovements)}
+}
+
+func (c *HistoryCache) Load() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := ioutil.ReadFile(c.filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, &c.points)
+}
+
+func (c *HistoryCache) Save() error {
+	c.mu.RLock()
+	data, err := json.Marshal(c.points)
+	c.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := c.filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.filename)
+}
+
+func (c *HistoryCache) get(key string, at time.Time) (ValuePoint, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	point, ok := c.points[key][at.Unix()]
+	return point, ok
+}
+
+func (c *HistoryCache) put(key string, point ValuePoint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.points[key] == nil {
+		c.points[key] = make(map[int64]ValuePoint)
+	}
+	c.points[key][point.Time.Unix()] = point
+}
+
+// Movements of the addresses, fetching only the blocks after the cached ones. Movements newer than
+// the finality delay are returned but not kept, as the explorer may still be missing some of their block.
+func (c *HistoryCache) groupMovements(apiKey string, members []string, fetchedAt time.Time) ([]movement, error) {
+	key := strings.Join(members, ",")
+	c.mu.RLock()
+	cached, ok := c.movements[key]
+	c.mu.RUnlock()
+
+	startBlock := uint64(0)
+	if ok {
+		startBlock = cached.lastBlock + 1
+	}
+	fresh, err := fetchGroupMovements(apiKey, members, startBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	// Slices are capped so that concurrent requests never append to the same array
+	final := cachedMovements{lastBlock: cached.lastBlock, movements: cached.movements[:len(cached.movements):len(cached.movements)]}
+	kept := 0
+	for ; kept < len(fresh) && fresh[kept].time.Before(fetchedAt.Add(-historyFinality)); kept++ {
+		final.movements = append(final.movements, fresh[kept])
+		if fresh[kept].block > final.lastBlock {
+			final.lastBlock = fresh[kept].block
+		}
+	}
+	if kept > 0 {
+		c.mu.Lock()
+		c.movements[key] = final
+		c.mu.Unlock()
+	}
+
+	return append(final.movements[:len(final.movements):len(final.movements)], fresh[kept:]...), nil
+}
+
+// Value the combined holdings of the addresses at every interval boundary in [from, to] by replaying
+// their transfers. The cache may be nil.
+func BuildValueHistory(apiKey string, provider prices.PriceProvider, cache *HistoryCache, addresses []string, currency, interval string, from, to time.Time) (ValueHistory, error) {
+	currency = strings.ToLower(currency)
+	history := ValueHistory{Currency: currency, Interval: interval, Tokens: []Token{}, Points: []ValuePoint{}}
+	if len(addresses) == 1 {
+		history.Address = strings.ToLower(addresses[0])
+	} else {
+		history.Addresses = addresses
+	}
+	step, ok := intervals[interval]
+	if !ok {
+		return history, fmt.Errorf("unknown interval %q", interval)
+	}
+	start := from.UTC().Truncate(step)
+	if start.Before(from) {
+		start = start.Add(step)
+	}
+	if to.Sub(start)/step >= maxHistoryPoints {
+		return history, errTooManyPoints
+	}
+
+	members := make([]string, len(addresses))
+	for i, address := range addresses {
+		members[i] = strings.ToLower(address)
+	}
+	sort.Strings(members)
+
+	fetchedAt := time.Now()
+	var movements []movement
+	var err error
+	if cache != nil {
+		movements, err = cache.groupMovements(apiKey, members, fetchedAt)
+	} else {
+		movements, err = fetchGroupMovements(apiKey, members, 0)
+	}
+	if err != nil {
+		return history, err
+	}
+
+	// Points depend on the price source as much as on the holdings
+	cacheKey := strings.Join(members, ",") + "/" + prices.ProviderID(provider) + "/" + currency + "/" + interval
+	balances := make(map[string]*big.Int)
+	tokens := make(map[string]Token)
+	next, cached := 0, 0
+	for at := start; !at.After(to); at = at.Add(step) {
+		for ; next < len(movements) && !movements[next].time.After(at); next++ {
+			m := movements[next]
+			key := m.key()
+			if balances[key] == nil {
+				balances[key] = new(big.Int)
+				tokens[key] = m.token
+			}
+			balances[key].Add(balances[key], m.amount)
+		}
+
+		if cache != nil {
+			if point, ok := cache.get(cacheKey, at); ok {
+				history.Points = append(history.Points, point)
+				continue
+			}
+		}
+		point, err := valuePoint(provider, currency, at, balances, tokens)
+		if err != nil {
+			return history, err
+		}
+		history.Points = append(history.Points, point)
+		// A price missing now may be filled in by the source later
+		if cache != nil && at.Before(fetchedAt.Add(-historyFinality)) && point.priced() {
+			cache.put(cacheKey, point)
+			cached++
+		}
+	}
+	if cached > 0 {
+		if err := cache.Save(); err != nil {
+			log.Printf("Failed to save portfolio history cache: %v", err)
+		}
+	}
+
+	for _, token := range tokens {
+		history.Tokens = append(history.Tokens, token)
+	}
+	sort.Slice(history.Tokens, func(i, j int) bool { return history.Tokens[i].Symbol < history.Tokens[j].Symbol })
+	return history, nil
+}
+
+func valuePoint(provider prices.PriceProvider, currency string, at time.Time, balances map[string]*big.Int, tokens map[string]Token) (ValuePoint, error) {
+	point := ValuePoint{Time: at, Tokens: make(map[string]TokenValue)}
+	for key, raw := range balances {
+		if raw.Sign() <= 0 {
+			continue
+		}
+		holding := TokenValue{Balance: ToFloat(raw, tokens[key].Decimals)}
+		price, err := provider.HistoricalPrice(key, currency, at)
+		if err == nil {
+			holding.Price = &price
+			holding.Value = holding.Balance * price
+		} else if !errors.Is(err, prices.ErrPriceNotFound) {
+			return point, err
+		}
+		point.Tokens[key] = holding
+		point.Value += holding.Value
+	}
+	return point, nil
+}
+
+// Whether every holding of the point has a price
+func (p ValuePoint) priced() bool {
+	for _, holding := range p.Tokens {
+		if holding.Price == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// GET /api/v1/portfolio/history?address={address,...}&group={id}&from={date}&to={date}&interval={day|hour}&currency={usd|eur|...}
+func ValueHistoryHandler(apiKey string, provider prices.PriceProvider, cache *HistoryCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if provider == nil {
+			http.Error(w, "price provider not configured", http.StatusServiceUnavailable)
+			return
+		}
+		query := r.URL.Query()
+		addresses, ok := requestAddresses(w, query)
+		if !ok {
+			return
+		}
+		interval := query.Get("interval")
+		if interval == "" {
+			interval = IntervalDay
+		}
+		if _, ok := intervals[interval]; !ok {
+			http.Error(w, "Invalid interval, expected day or hour", http.StatusBadRequest)
+			return
+		}
+		currency := query.Get("currency")
+		if currency == "" {
+			currency = prices.DefaultCurrency
+		}
+		from, to, err := ParsePeriod(query, 30*24*time.Hour)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		history, err := BuildValueHistory(apiKey, provider, cache, addresses, currency, interval, from, to)
+		if errors.Is(err, errTooManyPoints) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error building portfolio history: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(history)
+	}
+}
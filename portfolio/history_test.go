@@ -0,0 +1,163 @@
+package portfolio
+
+import (
+	"ethereye/prices"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Price provider counting historical lookups
+type countingPrices struct {
+	fixedPrices
+	lookups int
+}
+
+func (p *countingPrices) HistoricalPrice(token, currency string, at time.Time) (float64, error) {
+	p.lookups++
+	return p.fixedPrices.HistoricalPrice(token, currency, at)
+}
+
+// Price provider with a name of its own
+type namedPrices struct {
+	*countingPrices
+	id string
+}
+
+func (p namedPrices) ID() string {
+	return p.id
+}
+
+func useFakeHistory(t *testing.T) *[]url.Values {
+	at := func(day, hour int) string {
+		return fmt.Sprint(time.Date(2024, 1, day, hour, 0, 0, 0, time.UTC).Unix())
+	}
+	return useFakeEtherscan(t, map[string]interface{}{
+		"txlist": []map[string]string{
+			{"hash": "0xa", "from": "0x2", "to": wallet, "value": "2000000000000000000", "gasPrice": "1000000000", "gasUsed": "21000", "blockNumber": "1", "timeStamp": at(1, 12), "txreceipt_status": "1"},
+			{"hash": "0xb", "from": wallet, "to": "0x2", "value": "500000000000000000", "gasPrice": "1000000000", "gasUsed": "21000", "blockNumber": "2", "timeStamp": at(2, 12), "txreceipt_status": "1"},
+			// Failed: only the fee leaves the wallet
+			{"hash": "0xc", "from": wallet, "to": "0x2", "value": "500000000000000000", "gasPrice": "1000000000", "gasUsed": "21000", "blockNumber": "3", "timeStamp": at(2, 12), "txreceipt_status": "0"},
+		},
+		"txlistinternal": []map[string]string{
+			{"hash": "0xd", "from": "0x3", "to": wallet, "value": "1000000000000000000", "blockNumber": "4", "timeStamp": at(3, 6), "isError": "0"},
+			{"hash": "0xe", "from": "0x3", "to": wallet, "value": "1000000000000000000", "blockNumber": "5", "timeStamp": at(3, 6), "isError": "1"},
+		},
+		"tokentx": []map[string]string{
+			{"blockNumber": "6", "timeStamp": at(2, 13), "hash": "0xf", "from": "0x2", "to": wallet, "value": "100000000", "contractAddress": usdc, "tokenName": "USD Coin", "tokenSymbol": "USDC", "tokenDecimal": "6"},
+		},
+	})
+}
+
+func TestBuildValueHistory(t *testing.T) {
+	queries := useFakeHistory(t)
+	provider := &countingPrices{fixedPrices: fixedPrices{prices.ETH: 2000, usdc: 1}}
+	cache := NewHistoryCache(filepath.Join(t.TempDir(), "portfolio_history.json"))
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	history, err := BuildValueHistory("", provider, cache, []string{wallet}, "USD", IntervalDay, from, from.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatalf("BuildValueHistory returned error: %v", err)
+	}
+	expected := []float64{0, 4000, 1.499958*2000 + 100, 2.499958*2000 + 100}
+	if len(history.Points) != len(expected) {
+		t.Fatalf("Expected %d points, got %d", len(expected), len(history.Points))
+	}
+	for i, point := range history.Points {
+		if math.Abs(point.Value-expected[i]) > 1e-6 {
+			t.Errorf("Point %s: expected value %f, got %f", point.Time, expected[i], point.Value)
+		}
+	}
+	if holding := history.Points[3].Tokens[usdc]; holding.Balance != 100 || holding.Price == nil || *holding.Price != 1 {
+		t.Errorf("Unexpected USDC holding %+v", holding)
+	}
+	if len(history.Tokens) != 2 || history.Tokens[0].Symbol != "ETH" || history.Tokens[1].Symbol != "USDC" {
+		t.Errorf("Unexpected tokens %+v", history.Tokens)
+	}
+
+	t.Run("Test with an extended range", func(t *testing.T) {
+		lookups, fetched := provider.lookups, len(*queries)
+		extended, err := BuildValueHistory("", provider, cache, []string{wallet}, "usd", IntervalDay, from, from.AddDate(0, 0, 4))
+		if err != nil {
+			t.Fatalf("BuildValueHistory returned error: %v", err)
+		}
+		if len(extended.Points) != 5 {
+			t.Fatalf("Expected 5 points, got %d", len(extended.Points))
+		}
+		// Only the new point holds ETH and USDC to price
+		if provider.lookups-lookups != 2 {
+			t.Errorf("Expected 2 new price lookups, got %d", provider.lookups-lookups)
+		}
+		if last := extended.Points[4]; math.Abs(last.Value-expected[3]) > 1e-6 {
+			t.Errorf("Expected the cached movements to be counted once, got %f", last.Value)
+		}
+		// Only blocks after the cached movements are fetched again
+		for _, query := range (*queries)[fetched:] {
+			if query.Get("startblock") != "7" {
+				t.Errorf("Expected %s to start at block 7, got %s", query.Get("action"), query.Get("startblock"))
+			}
+		}
+
+		reloaded := NewHistoryCache(cache.filename)
+		if err := reloaded.Load(); err != nil {
+			t.Fatalf("Load returned error: %v", err)
+		}
+		if _, ok := reloaded.get(wallet+"/"+prices.ProviderID(provider)+"/usd/day", from.AddDate(0, 0, 4)); !ok {
+			t.Errorf("Expected the new point to be persisted")
+		}
+	})
+
+	t.Run("Test with a missing price", func(t *testing.T) {
+		unpriced := namedPrices{countingPrices: &countingPrices{fixedPrices: fixedPrices{prices.ETH: 2000}}, id: "unpriced"}
+		for i := 0; i < 2; i++ {
+			if _, err := BuildValueHistory("", unpriced, cache, []string{wallet}, "usd", IntervalDay, from, from.AddDate(0, 0, 3)); err != nil {
+				t.Fatalf("BuildValueHistory returned error: %v", err)
+			}
+		}
+		// The two points holding USDC are looked up again, the one holding only ETH comes from the cache
+		if unpriced.lookups != 5+4 {
+			t.Errorf("Expected 9 price lookups, got %d", unpriced.lookups)
+		}
+	})
+
+	t.Run("Test with another price source", func(t *testing.T) {
+		other := namedPrices{countingPrices: &countingPrices{fixedPrices: fixedPrices{prices.ETH: 3000, usdc: 1}}, id: "other"}
+		history, err := BuildValueHistory("", other, cache, []string{wallet}, "usd", IntervalDay, from, from.AddDate(0, 0, 3))
+		if err != nil {
+			t.Fatalf("BuildValueHistory returned error: %v", err)
+		}
+		if other.lookups == 0 || math.Abs(history.Points[1].Value-6000) > 1e-6 {
+			t.Errorf("Expected points valued with the other source, got %f after %d lookups", history.Points[1].Value, other.lookups)
+		}
+	})
+}
+
+func TestValueHistoryHandler(t *testing.T) {
+	useFakeHistory(t)
+	handler := ValueHistoryHandler("", fixedPrices{prices.ETH: 2000}, nil)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"Test with missing address", "", http.StatusBadRequest},
+		{"Test with invalid interval", "?address=" + wallet + "&interval=week", http.StatusBadRequest},
+		{"Test with too many points", "?address=" + wallet + "&interval=hour&from=2023-01-01&to=2024-01-01", http.StatusBadRequest},
+		{"Test with valid request", "?address=" + wallet + "&from=2024-01-01&to=2024-01-31", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/portfolio/history"+test.query, nil))
+			if rr.Code != test.expected {
+				t.Errorf("Expected status code %d, got %d", test.expected, rr.Code)
+			}
+		})
+	}
+}
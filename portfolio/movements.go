@@ -0,0 +1,130 @@
+package portfolio
+
+import (
+	"ethereye/prices"
+	. "ethereye/transactions"
+	. "ethereye/utils"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+/******************
+Balance Movements
+******************/
+
+// Change of a wallet's balance of one token. Amount is the signed raw amount.
+type movement struct {
+	time         time.Time
+	block        uint64
+	hash         string
+	token        Token
+	amount       *big.Int
+	counterparty string
+	// Gas paid for a transaction sent by the wallet
+	fee bool
+	// Validator balance withdrawn by the beacon chain, which has no transaction hash
+	withdrawal bool
+	// Staked principal returned by a validator exit, as opposed to rewards
+	principal bool
+}
+
+// Every validator is funded with 32 ETH. Validators are ejected below 16 ETH, so a withdrawal of at
+// least that much is an exit returning the principal, while reward skims stay far below it.
+var (
+	validatorPrincipal = new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18))
+	exitWithdrawal     = new(big.Int).Mul(big.NewInt(16), big.NewInt(1e18))
+)
+
+// Split a withdrawal into the principal it returns, if it is an exit, and the rewards above it
+func splitWithdrawal(amount *big.Int) (principal, rewards *big.Int) {
+	if amount.Cmp(exitWithdrawal) < 0 {
+		return new(big.Int), amount
+	}
+	if amount.Cmp(validatorPrincipal) <= 0 {
+		return amount, new(big.Int)
+	}
+	return new(big.Int).Set(validatorPrincipal), new(big.Int).Sub(amount, validatorPrincipal)
+}
+
+func (m movement) key() string {
+	return prices.TokenKey(m.token.Contract)
+}
+
+// Every balance change of the address from the start block on, oldest first: ETH sent and received
+// with gas fees, internal ETH transfers, beacon chain withdrawals and ERC-20 transfers
+func fetchMovements(apiKey, address string, startBlock uint64) ([]movement, error) {
+	var movements []movement
+	add := func(block, at int64, hash string, token Token, value string, from, to string) {
+		amount := ParseBigInt(value)
+		if amount.Sign() == 0 {
+			return
+		}
+		// A transfer to oneself changes nothing
+		if strings.EqualFold(from, address) && strings.EqualFold(to, address) {
+			return
+		}
+		m := movement{time: time.Unix(at, 0).UTC(), block: uint64(block), hash: hash, token: token, amount: amount, counterparty: from}
+		if strings.EqualFold(from, address) {
+			m.amount = new(big.Int).Neg(amount)
+			m.counterparty = to
+		}
+		movements = append(movements, m)
+	}
+
+	transactions, err := FetchTransactionsFrom(apiKey, address, startBlock)
+	if err != nil && err != ErrNoTransactions {
+		return nil, err
+	}
+	for _, tx := range transactions {
+		if strings.EqualFold(tx.FromAddress, address) {
+			fee := new(big.Int).Mul(ParseBigInt(tx.GasUsed), ParseBigInt(tx.GasPrice))
+			if fee.Sign() > 0 {
+				movements = append(movements, movement{time: tx.Timestamp.UTC(), block: tx.BlockHeight, hash: tx.ID, token: Ether, amount: fee.Neg(fee), counterparty: tx.ToAddress, fee: true})
+			}
+		}
+		// Failed transactions still pay gas but move no value
+		if tx.Status == "0" {
+			continue
+		}
+		add(int64(tx.BlockHeight), tx.Timestamp.Unix(), tx.ID, Ether, tx.Value, tx.FromAddress, tx.ToAddress)
+	}
+
+	internals, err := FetchInternalTransactionsFrom(apiKey, address, startBlock)
+	if err != nil {
+		return nil, err
+	}
+	for _, internal := range internals {
+		if !internal.IsError {
+			add(internal.BlockNumber, internal.Timestamp, internal.Hash, Ether, internal.Value, internal.From, internal.To)
+		}
+	}
+
+	withdrawals, err := FetchBeaconWithdrawalsFrom(apiKey, address, startBlock)
+	if err != nil {
+		return nil, err
+	}
+	for _, withdrawal := range withdrawals {
+		at, block := time.Unix(withdrawal.Timestamp, 0).UTC(), uint64(withdrawal.BlockNumber)
+		principal, rewards := splitWithdrawal(ParseBigInt(withdrawal.Amount))
+		if principal.Sign() > 0 {
+			movements = append(movements, movement{time: at, block: block, token: Ether, amount: principal, withdrawal: true, principal: true})
+		}
+		if rewards.Sign() > 0 {
+			movements = append(movements, movement{time: at, block: block, token: Ether, amount: rewards, withdrawal: true})
+		}
+	}
+
+	transfers, err := FetchTokenTransfersFrom(apiKey, address, startBlock)
+	if err != nil {
+		return nil, err
+	}
+	for _, transfer := range transfers {
+		token := Token{Contract: transfer.ContractAddr, Name: transfer.TokenName, Symbol: transfer.TokenSymbol, Decimals: transfer.TokenDecimal}
+		add(transfer.BlockNumber, transfer.Timestamp, transfer.Hash, token, transfer.Value, transfer.From, transfer.To)
+	}
+
+	sort.SliceStable(movements, func(i, j int) bool { return movements[i].time.Before(movements[j].time) })
+	return movements, nil
+}
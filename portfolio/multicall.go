@@ -0,0 +1,119 @@
+package portfolio
+
+import (
+	"errors"
+	"ethereye/abi"
+	"ethereye/node"
+	"math/big"
+)
+
+/******************
+Multicall
+******************/
+
+// Multicall3, deployed at the same address on mainnet and most EVM chains
+const Multicall3Address = "0xcA11bde05977b3631167028862bE2a173976CA11"
+
+// Calls batched into a single eth_call
+const multicallBatchSize = 200
+
+var aggregate3Selector = abi.Selector("aggregate3((address,bool,bytes)[])")
+
+var errMulticallUnavailable = errors.New("multicall unavailable")
+
+type call struct {
+	target string
+	data   []byte
+}
+
+// Result of a call; Success is false when the call reverted
+type callResult struct {
+	success bool
+	data    []byte
+}
+
+// Run the calls through Multicall3, allowing individual calls to fail
+func multicall(client *node.Client, calls []call, tag string) ([]callResult, error) {
+	results := make([]callResult, 0, len(calls))
+	for start := 0; start < len(calls); start += multicallBatchSize {
+		end := start + multicallBatchSize
+		if end > len(calls) {
+			end = len(calls)
+		}
+		input, err := encodeAggregate3(calls[start:end])
+		if err != nil {
+			return nil, err
+		}
+		output, err := client.CallContract(node.CallMsg{To: Multicall3Address, Data: input}, tag)
+		if err != nil {
+			return nil, err
+		}
+		batch, err := decodeAggregate3(output, end-start)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, batch...)
+	}
+	return results, nil
+}
+
+// Encode aggregate3(Call3[] calls) where Call3 is (address target, bool allowFailure, bytes callData)
+func encodeAggregate3(calls []call) ([]byte, error) {
+	input := append([]byte(nil), aggregate3Selector...)
+	input = append(input, abi.EncodeUint(big.NewInt(abi.WordSize))...)
+	input = append(input, abi.EncodeUint(big.NewInt(int64(len(calls))))...)
+
+	// Each tuple is dynamic, so the array head holds offsets relative to the first head word
+	var tails []byte
+	for _, c := range calls {
+		offset := len(calls)*abi.WordSize + len(tails)
+		input = append(input, abi.EncodeUint(big.NewInt(int64(offset)))...)
+
+		target, err := abi.EncodeAddress(c.target)
+		if err != nil {
+			return nil, err
+		}
+		tails = append(tails, target...)
+		tails = append(tails, abi.EncodeBool(true)...)
+		tails = append(tails, abi.EncodeUint(big.NewInt(3*abi.WordSize))...)
+		tails = append(tails, abi.EncodeDynamicBytes(c.data)...)
+	}
+	return append(input, tails...), nil
+}
+
+// Decode the Result[] returned by aggregate3, where Result is (bool success, bytes returnData)
+func decodeAggregate3(output []byte, count int) ([]callResult, error) {
+	// Calling an address without code returns nothing
+	if len(output) == 0 {
+		return nil, errMulticallUnavailable
+	}
+	start, err := abi.DecodeUint(output, 0)
+	if err != nil || !start.IsInt64() || start.Int64() > int64(len(output)) {
+		return nil, errMulticallUnavailable
+	}
+	array := output[start.Int64():]
+	length, err := abi.DecodeUint(array, 0)
+	if err != nil || length.Cmp(big.NewInt(int64(count))) != 0 {
+		return nil, errMulticallUnavailable
+	}
+	heads := array[abi.WordSize:]
+
+	results := make([]callResult, count)
+	for i := range results {
+		offset, err := abi.DecodeUint(heads, i*abi.WordSize)
+		if err != nil || !offset.IsInt64() || offset.Int64() > int64(len(heads)) {
+			return nil, errMulticallUnavailable
+		}
+		tuple := heads[offset.Int64():]
+		success, err := abi.DecodeUint(tuple, 0)
+		if err != nil {
+			return nil, errMulticallUnavailable
+		}
+		data, err := abi.DecodeBytes(tuple, abi.WordSize)
+		if err != nil {
+			return nil, errMulticallUnavailable
+		}
+		results[i] = callResult{success: success.Sign() != 0, data: data}
+	}
+	return results, nil
+}
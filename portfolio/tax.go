@@ -0,0 +1,350 @@
+package portfolio
+
+import (
+	"errors"
+	"ethereye/prices"
+	. "ethereye/utils"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+/******************
+Tax Report
+******************/
+
+const (
+	TaxAcquisition = "acquisition"
+	TaxDisposal    = "disposal"
+	TaxIncome      = "income"
+	TaxFee         = "fee"
+)
+
+const (
+	IncomeAirdrop = "airdrop"
+	IncomeStaking = "staking"
+)
+
+// Holding periods of disposed tokens
+const (
+	HoldingShortTerm = "short"
+	HoldingLongTerm  = "long"
+)
+
+// Tokens held longer than this are long-term holdings
+const longTermHolding = 365 * 24 * time.Hour
+
+// Cost basis methods of tax reports. Average cost has no acquisition date to derive holding periods from.
+var TaxMethods = []string{MethodFIFO, MethodLIFO}
+
+const zeroAddress = "0x0000000000000000000000000000000000000000"
+
+// ETH sent here funds validators; it comes back with their exit
+const beaconDepositContract = "0x00000000219ab540356cbb839cbe05303d7705fa"
+
+// Taxable event. Value is the market value in the report's currency at the time and left out when
+// unknown. Disposals carry the cost basis of the acquisitions they consumed, the gain and the holding
+// period; a disposal of lots held for both periods is split into one event per period. Disposals of
+// lots acquired without a price are split apart too and marked UnknownCost, without a cost basis or gain.
+type TaxEvent struct {
+	Time          time.Time  `json:"time"`
+	Type          string     `json:"type"`
+	IncomeKind    string     `json:"incomeKind,omitempty"`
+	Token         Token      `json:"token"`
+	Amount        float64    `json:"amount"`
+	Value         *float64   `json:"value,omitempty"`
+	CostBasis     *float64   `json:"costBasis,omitempty"`
+	Gain          *float64   `json:"gain,omitempty"`
+	HoldingPeriod string     `json:"holdingPeriod,omitempty"`
+	AcquiredAt    *time.Time `json:"acquiredAt,omitempty"`
+	Hash          string     `json:"hash"`
+	Counterparty  string     `json:"counterparty"`
+	UnknownCost   bool       `json:"unknownCost,omitempty"`
+}
+
+type TaxSummary struct {
+	Proceeds      float64 `json:"proceeds"`
+	CostBasis     float64 `json:"costBasis"`
+	ShortTermGain float64 `json:"shortTermGain"`
+	LongTermGain  float64 `json:"longTermGain"`
+	Income        float64 `json:"income"`
+	Fees          float64 `json:"fees"`
+	// Events of the year and earlier acquisitions without a historical price, which are left out of the totals
+	MissingPrices int `json:"missingPrices"`
+	// Disposals of unknown cost, left out of the proceeds, cost basis and gains
+	ExcludedDisposals int `json:"excludedDisposals"`
+}
+
+type TaxReport struct {
+	Address   string     `json:"address,omitempty"`
+	Addresses []string   `json:"addresses,omitempty"`
+	Year      int        `json:"year"`
+	Currency  string     `json:"currency"`
+	Method    string     `json:"method"`
+	Events    []TaxEvent `json:"events"`
+	Summary   TaxSummary `json:"summary"`
+}
+
+// Part of an acquisition not yet disposed of, in the token's smallest unit, with the time it was
+// acquired. The cost of a lot acquired without a price is unknown.
+type taxLot struct {
+	units    *big.Int
+	unitCost float64
+	acquired time.Time
+	unknown  bool
+}
+
+// Amount of a disposal matched against lots of one holding period and of known or unknown cost,
+// in the token's smallest unit
+type taxPortion struct {
+	period   string
+	unknown  bool
+	units    *big.Int
+	cost     float64
+	acquired time.Time
+}
+
+// Taxable events of the addresses in the calendar year (UTC). Every transfer since the first one is
+// replayed so disposals are matched against their original acquisitions. Incoming tokens are income
+// when they are beacon chain reward withdrawals (staking) or minted to the wallet by a transaction it
+// did not send (airdrops), and acquisitions at market value otherwise. Gas fees consume ETH lots
+// without a gain. Staking deposits and the principal returned by validator exits are not taxable: the
+// deposited lots are set aside and restored with their cost basis on exit. Principal deposited from
+// elsewhere is acquired at market value.
+func BuildTaxReport(apiKey string, provider prices.PriceProvider, addresses []string, year int, currency, method string) (TaxReport, error) {
+	currency = strings.ToLower(currency)
+	report := TaxReport{Year: year, Currency: currency, Method: method, Events: []TaxEvent{}}
+	if len(addresses) == 1 {
+		report.Address = strings.ToLower(addresses[0])
+	} else {
+		report.Addresses = addresses
+	}
+	if !validTaxMethod(method) {
+		return report, errors.New("unsupported cost basis method, expected fifo or lifo")
+	}
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, 0)
+
+	movements, err := fetchGroupMovements(apiKey, addresses, 0)
+	if err != nil {
+		return report, err
+	}
+	sent := make(map[string]bool)
+	for _, m := range movements {
+		if m.fee {
+			sent[m.hash] = true
+		}
+	}
+
+	lots := make(map[string][]taxLot)
+	var staked []taxLot
+	for _, m := range movements {
+		if !m.time.Before(end) {
+			break
+		}
+		inYear := !m.time.Before(start)
+		key := m.key()
+		units := new(big.Int).Abs(m.amount)
+		amount := ToFloat(units, m.token.Decimals)
+		event := TaxEvent{Time: m.time, Token: m.token, Amount: amount, Hash: m.hash, Counterparty: m.counterparty}
+
+		if m.amount.Sign() < 0 && !m.fee && key == prices.ETH && strings.EqualFold(m.counterparty, beaconDepositContract) {
+			var deposited []taxLot
+			lots[key], deposited = takeLots(lots[key], units, method)
+			staked = append(staked, deposited...)
+			continue
+		}
+		if m.principal {
+			var returned []taxLot
+			staked, returned = takeLots(staked, units, MethodFIFO)
+			lots[key] = append(lots[key], returned...)
+			sort.SliceStable(lots[key], func(i, j int) bool { return lots[key][i].acquired.Before(lots[key][j].acquired) })
+			for _, lot := range returned {
+				units.Sub(units, lot.units)
+			}
+			if units.Sign() <= 0 {
+				continue
+			}
+			amount = ToFloat(units, m.token.Decimals)
+			event.Amount = amount
+		}
+
+		// Prices of earlier disposals are not needed, only the lots they consumed
+		var price *float64
+		if inYear || m.amount.Sign() > 0 {
+			value, err := provider.HistoricalPrice(key, currency, m.time)
+			if err == nil {
+				price = &value
+			} else if !errors.Is(err, prices.ErrPriceNotFound) {
+				return report, err
+			} else {
+				// Acquisitions of earlier years leave lots of unknown cost for this year's disposals
+				report.Summary.MissingPrices++
+			}
+		}
+
+		if m.amount.Sign() > 0 {
+			lot := taxLot{units: units, acquired: m.time, unknown: price == nil}
+			if price != nil {
+				lot.unitCost = *price
+			}
+			lots[key] = append(lots[key], lot)
+			if !inYear {
+				continue
+			}
+			event.Type = TaxAcquisition
+			if m.withdrawal && !m.principal {
+				event.Type, event.IncomeKind = TaxIncome, IncomeStaking
+			} else if strings.EqualFold(m.counterparty, zeroAddress) && !sent[m.hash] {
+				event.Type, event.IncomeKind = TaxIncome, IncomeAirdrop
+			}
+			if price != nil {
+				value := amount * *price
+				event.Value = &value
+				if event.Type == TaxIncome {
+					report.Summary.Income += value
+				}
+			}
+			report.Events = append(report.Events, event)
+			continue
+		}
+
+		var portions []taxPortion
+		lots[key], portions = consumeLots(lots[key], units, m.token.Decimals, method, m.time)
+		if !inYear {
+			continue
+		}
+		if m.fee {
+			event.Type = TaxFee
+			if price != nil {
+				value := amount * *price
+				event.Value = &value
+				report.Summary.Fees += value
+			}
+			report.Events = append(report.Events, event)
+			continue
+		}
+		for _, portion := range portions {
+			disposal := event
+			disposal.Type = TaxDisposal
+			disposal.Amount = ToFloat(portion.units, m.token.Decimals)
+			disposal.HoldingPeriod = portion.period
+			if !portion.acquired.IsZero() {
+				acquired := portion.acquired
+				disposal.AcquiredAt = &acquired
+			}
+			if portion.unknown {
+				disposal.UnknownCost = true
+				if price != nil {
+					value := disposal.Amount * *price
+					disposal.Value = &value
+				}
+				report.Summary.ExcludedDisposals++
+				report.Events = append(report.Events, disposal)
+				continue
+			}
+			cost := portion.cost
+			disposal.CostBasis = &cost
+			if price != nil {
+				value := disposal.Amount * *price
+				gain := value - cost
+				disposal.Value = &value
+				disposal.Gain = &gain
+				report.Summary.Proceeds += value
+				report.Summary.CostBasis += cost
+				if portion.period == HoldingLongTerm {
+					report.Summary.LongTermGain += gain
+				} else {
+					report.Summary.ShortTermGain += gain
+				}
+			}
+			report.Events = append(report.Events, disposal)
+		}
+	}
+	return report, nil
+}
+
+// Match the amount against the lots with the method, grouping what was used by holding period and
+// by whether its cost is known. Amounts beyond the lots have no cost basis and count as short-term.
+func consumeLots(lots []taxLot, units *big.Int, decimals int, method string, at time.Time) ([]taxLot, []taxPortion) {
+	short := taxPortion{period: HoldingShortTerm, units: new(big.Int)}
+	long := taxPortion{period: HoldingLongTerm, units: new(big.Int)}
+	unknownShort := taxPortion{period: HoldingShortTerm, unknown: true, units: new(big.Int)}
+	unknownLong := taxPortion{period: HoldingLongTerm, unknown: true, units: new(big.Int)}
+	remaining := new(big.Int).Set(units)
+	for remaining.Sign() > 0 && len(lots) > 0 {
+		index := 0
+		if method == MethodLIFO {
+			index = len(lots) - 1
+		}
+		used := minUnits(remaining, lots[index].units)
+		held := at.Sub(lots[index].acquired) > longTermHolding
+		portion := &short
+		switch {
+		case lots[index].unknown && held:
+			portion = &unknownLong
+		case lots[index].unknown:
+			portion = &unknownShort
+		case held:
+			portion = &long
+		}
+		portion.units.Add(portion.units, used)
+		portion.cost += ToFloat(used, decimals) * lots[index].unitCost
+		if portion.acquired.IsZero() || lots[index].acquired.Before(portion.acquired) {
+			portion.acquired = lots[index].acquired
+		}
+		remaining.Sub(remaining, used)
+		lots[index].units = new(big.Int).Sub(lots[index].units, used)
+		if lots[index].units.Sign() == 0 {
+			lots = append(lots[:index], lots[index+1:]...)
+		}
+	}
+	short.units.Add(short.units, remaining)
+
+	var portions []taxPortion
+	for _, portion := range []taxPortion{short, long, unknownShort, unknownLong} {
+		if portion.units.Sign() > 0 {
+			portions = append(portions, portion)
+		}
+	}
+	return lots, portions
+}
+
+// Take the amount out of the lots with the method, keeping the taken parts' cost and acquisition time
+func takeLots(lots []taxLot, units *big.Int, method string) ([]taxLot, []taxLot) {
+	var taken []taxLot
+	remaining := new(big.Int).Set(units)
+	for remaining.Sign() > 0 && len(lots) > 0 {
+		index := 0
+		if method == MethodLIFO {
+			index = len(lots) - 1
+		}
+		lot := lots[index]
+		lot.units = minUnits(remaining, lot.units)
+		taken = append(taken, lot)
+		remaining.Sub(remaining, lot.units)
+		lots[index].units = new(big.Int).Sub(lots[index].units, lot.units)
+		if lots[index].units.Sign() == 0 {
+			lots = append(lots[:index], lots[index+1:]...)
+		}
+	}
+	return lots, taken
+}
+
+// Copy of the smaller amount
+func minUnits(a, b *big.Int) *big.Int {
+	if a.Cmp(b) < 0 {
+		return new(big.Int).Set(a)
+	}
+	return new(big.Int).Set(b)
+}
+
+func validTaxMethod(method string) bool {
+	for _, candidate := range TaxMethods {
+		if candidate == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package portfolio
+
+import (
+	"ethereye/prices"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// Price provider where ETH trades at 1000 before 2023 and at 3000 after
+type yearlyPrices struct{ fixedPrices }
+
+func (p yearlyPrices) HistoricalPrice(token, currency string, at time.Time) (float64, error) {
+	if token == prices.ETH && at.Year() < 2023 {
+		return 1000, nil
+	}
+	return p.fixedPrices.HistoricalPrice(token, currency, at)
+}
+
+func useFakeTaxHistory(t *testing.T) {
+	at := func(year, month, day int) string {
+		return fmt.Sprint(time.Date(year, time.Month(month), day, 12, 0, 0, 0, time.UTC).Unix())
+	}
+	useFakeEtherscan(t, map[string]interface{}{
+		"txlist": []map[string]string{
+			{"hash": "0xa", "from": "0x2", "to": wallet, "value": "2000000000000000000", "gasPrice": "1000000000", "gasUsed": "21000", "blockNumber": "1", "timeStamp": at(2022, 1, 10), "txreceipt_status": "1"},
+			{"hash": "0xb", "from": "0x2", "to": wallet, "value": "1000000000000000000", "gasPrice": "1000000000", "gasUsed": "21000", "blockNumber": "2", "timeStamp": at(2023, 3, 1), "txreceipt_status": "1"},
+			{"hash": "0xc", "from": wallet, "to": "0x2", "value": "2500000000000000000", "gasPrice": "1000000000", "gasUsed": "21000", "blockNumber": "3", "timeStamp": at(2023, 6, 1), "txreceipt_status": "1"},
+			{"hash": "0xe", "from": "0x2", "to": wallet, "value": "1000000000000000000", "gasPrice": "1000000000", "gasUsed": "21000", "blockNumber": "6", "timeStamp": at(2024, 1, 2), "txreceipt_status": "1"},
+		},
+		"tokentx": []map[string]string{
+			{"blockNumber": "4", "timeStamp": at(2023, 7, 1), "hash": "0xd", "from": zeroAddress, "to": wallet, "value": "100000000", "contractAddress": usdc, "tokenName": "USD Coin", "tokenSymbol": "USDC", "tokenDecimal": "6"},
+		},
+		"txsBeaconWithdrawal": []map[string]string{
+			{"withdrawalIndex": "1", "validatorIndex": "7", "address": wallet, "amount": "32000000", "blockNumber": "5", "timestamp": at(2023, 8, 1)},
+		},
+	})
+}
+
+func TestBuildTaxReport(t *testing.T) {
+	useFakeTaxHistory(t)
+	provider := yearlyPrices{fixedPrices{prices.ETH: 3000, usdc: 1}}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+
+	report, err := BuildTaxReport("", provider, []string{wallet}, 2023, "USD", MethodFIFO)
+	if err != nil {
+		t.Fatalf("BuildTaxReport returned error: %v", err)
+	}
+	types := []string{TaxAcquisition, TaxFee, TaxDisposal, TaxDisposal, TaxIncome, TaxIncome}
+	if len(report.Events) != len(types) {
+		t.Fatalf("Expected %d events, got %+v", len(types), report.Events)
+	}
+	for i, event := range report.Events {
+		if event.Type != types[i] {
+			t.Errorf("Expected event %d to be %s, got %s", i, types[i], event.Type)
+		}
+	}
+
+	// The fee is paid from the 2022 lot, which is then disposed of as a long-term holding
+	short, long := report.Events[2], report.Events[3]
+	if long.HoldingPeriod != HoldingLongTerm || !near(long.Amount, 1.999979) || !near(*long.CostBasis, 1999.979) {
+		t.Errorf("Unexpected long-term disposal %+v", long)
+	}
+	if short.HoldingPeriod != HoldingShortTerm || !near(short.Amount, 0.500021) || !near(*short.Gain, 0) {
+		t.Errorf("Unexpected short-term disposal %+v", short)
+	}
+	if report.Events[4].IncomeKind != IncomeAirdrop || report.Events[5].IncomeKind != IncomeStaking {
+		t.Errorf("Unexpected income %+v %+v", report.Events[4], report.Events[5])
+	}
+
+	summary := report.Summary
+	if !near(summary.LongTermGain, 3999.958) || !near(summary.ShortTermGain, 0) {
+		t.Errorf("Unexpected gains %+v", summary)
+	}
+	if !near(summary.Income, 196) || !near(summary.Fees, 0.063) || !near(summary.Proceeds, 7500) {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+
+	t.Run("Test with unsupported method", func(t *testing.T) {
+		if _, err := BuildTaxReport("", provider, []string{wallet}, 2023, "usd", MethodAverage); err == nil {
+			t.Errorf("Expected an error for the average cost method")
+		}
+	})
+}
+
+func TestBuildTaxReportStaking(t *testing.T) {
+	at := func(year, month, day int) string {
+		return fmt.Sprint(time.Date(year, time.Month(month), day, 12, 0, 0, 0, time.UTC).Unix())
+	}
+	useFakeEtherscan(t, map[string]interface{}{
+		"txlist": []map[string]string{
+			{"hash": "0xa", "from": "0x2", "to": wallet, "value": "32000000000000000000", "gasPrice": "0", "gasUsed": "21000", "blockNumber": "1", "timeStamp": at(2022, 1, 10), "txreceipt_status": "1"},
+			{"hash": "0xb", "from": wallet, "to": beaconDepositContract, "value": "32000000000000000000", "gasPrice": "0", "gasUsed": "21000", "blockNumber": "2", "timeStamp": at(2022, 2, 1), "txreceipt_status": "1"},
+			{"hash": "0xc", "from": wallet, "to": "0x2", "value": "32000000000000000000", "gasPrice": "0", "gasUsed": "21000", "blockNumber": "4", "timeStamp": at(2023, 9, 1), "txreceipt_status": "1"},
+		},
+		"txsBeaconWithdrawal": []map[string]string{
+			{"withdrawalIndex": "1", "validatorIndex": "7", "address": wallet, "amount": "32050000000", "blockNumber": "3", "timestamp": at(2023, 8, 1)},
+		},
+	})
+	provider := yearlyPrices{fixedPrices{prices.ETH: 3000}}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+
+	report, err := BuildTaxReport("", provider, []string{wallet}, 2023, "USD", MethodFIFO)
+	if err != nil {
+		t.Fatalf("BuildTaxReport returned error: %v", err)
+	}
+	// Only the rewards above the principal are income, and the returned principal keeps its 2022 cost
+	if len(report.Events) != 2 || report.Events[0].Type != TaxIncome || report.Events[1].Type != TaxDisposal {
+		t.Fatalf("Expected staking income and a disposal, got %+v", report.Events)
+	}
+	if income := report.Events[0]; income.IncomeKind != IncomeStaking || !near(income.Amount, 0.05) {
+		t.Errorf("Unexpected income %+v", income)
+	}
+	if disposal := report.Events[1]; disposal.HoldingPeriod != HoldingLongTerm || !near(*disposal.CostBasis, 32000) {
+		t.Errorf("Unexpected disposal %+v", disposal)
+	}
+	if !near(report.Summary.Income, 150) || !near(report.Summary.LongTermGain, 64000) {
+		t.Errorf("Unexpected summary %+v", report.Summary)
+	}
+}
+
+func TestBuildTaxReportDecimalAmounts(t *testing.T) {
+	at := func(year, month, day int) string {
+		return fmt.Sprint(time.Date(year, time.Month(month), day, 12, 0, 0, 0, time.UTC).Unix())
+	}
+	// 0.7 + 0.1 ETH acquired in 2022, all 0.8 sold in 2023
+	useFakeEtherscan(t, map[string]interface{}{
+		"txlist": []map[string]string{
+			{"hash": "0xa", "from": "0x2", "to": wallet, "value": "700000000000000000", "gasPrice": "0", "gasUsed": "21000", "blockNumber": "1", "timeStamp": at(2022, 1, 10), "txreceipt_status": "1"},
+			{"hash": "0xb", "from": "0x2", "to": wallet, "value": "100000000000000000", "gasPrice": "0", "gasUsed": "21000", "blockNumber": "2", "timeStamp": at(2022, 2, 1), "txreceipt_status": "1"},
+			{"hash": "0xc", "from": wallet, "to": "0x2", "value": "800000000000000000", "gasPrice": "0", "gasUsed": "21000", "blockNumber": "3", "timeStamp": at(2023, 9, 1), "txreceipt_status": "1"},
+		},
+	})
+	provider := yearlyPrices{fixedPrices{prices.ETH: 3000}}
+
+	report, err := BuildTaxReport("", provider, []string{wallet}, 2023, "USD", MethodFIFO)
+	if err != nil {
+		t.Fatalf("BuildTaxReport returned error: %v", err)
+	}
+	// The lots are used up exactly, leaving no short-term remainder
+	if len(report.Events) != 1 || report.Events[0].HoldingPeriod != HoldingLongTerm {
+		t.Fatalf("Expected a single long-term disposal, got %+v", report.Events)
+	}
+	if math.Abs(*report.Events[0].CostBasis-800) > 1e-6 {
+		t.Errorf("Unexpected disposal %+v", report.Events[0])
+	}
+}
+
+// Price provider without ETH prices before 2023
+type laterPrices struct{ fixedPrices }
+
+func (p laterPrices) HistoricalPrice(token, currency string, at time.Time) (float64, error) {
+	if at.Year() < 2023 {
+		return 0, prices.ErrPriceNotFound
+	}
+	return p.fixedPrices.HistoricalPrice(token, currency, at)
+}
+
+func TestBuildTaxReportUnknownCost(t *testing.T) {
+	at := func(year, month, day int) string {
+		return fmt.Sprint(time.Date(year, time.Month(month), day, 12, 0, 0, 0, time.UTC).Unix())
+	}
+	useFakeEtherscan(t, map[string]interface{}{
+		"txlist": []map[string]string{
+			{"hash": "0xa", "from": "0x2", "to": wallet, "value": "1000000000000000000", "gasPrice": "0", "gasUsed": "21000", "blockNumber": "1", "timeStamp": at(2022, 1, 10), "txreceipt_status": "1"},
+			{"hash": "0xb", "from": "0x2", "to": wallet, "value": "1000000000000000000", "gasPrice": "0", "gasUsed": "21000", "blockNumber": "2", "timeStamp": at(2023, 3, 1), "txreceipt_status": "1"},
+			{"hash": "0xc", "from": wallet, "to": "0x2", "value": "1500000000000000000", "gasPrice": "0", "gasUsed": "21000", "blockNumber": "3", "timeStamp": at(2023, 9, 1), "txreceipt_status": "1"},
+		},
+	})
+	provider := laterPrices{fixedPrices{prices.ETH: 3000}}
+
+	report, err := BuildTaxReport("", provider, []string{wallet}, 2023, "USD", MethodFIFO)
+	if err != nil {
+		t.Fatalf("BuildTaxReport returned error: %v", err)
+	}
+	if len(report.Events) != 3 {
+		t.Fatalf("Expected an acquisition and two disposals, got %+v", report.Events)
+	}
+	// The unpriced 2022 lot is disposed of apart from the priced one, without a gain
+	known, unknown := report.Events[1], report.Events[2]
+	if known.UnknownCost || known.Amount != 0.5 || known.CostBasis == nil || *known.Gain != 0 {
+		t.Errorf("Unexpected disposal of known cost %+v", known)
+	}
+	if !unknown.UnknownCost || unknown.Amount != 1 || unknown.CostBasis != nil || unknown.Gain != nil || unknown.Value == nil {
+		t.Errorf("Unexpected disposal of unknown cost %+v", unknown)
+	}
+	summary := report.Summary
+	if summary.ExcludedDisposals != 1 || summary.MissingPrices != 1 || summary.Proceeds != 1500 || summary.LongTermGain != 0 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+}
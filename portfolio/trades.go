@@ -0,0 +1,315 @@
+package portfolio
+
+import (
+	"encoding/json"
+	"errors"
+	"ethereye/prices"
+	. "ethereye/utils"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/******************
+Trade History
+******************/
+
+// Cost basis methods: which acquisitions a disposal is matched against
+const (
+	MethodFIFO    = "fifo"
+	MethodLIFO    = "lifo"
+	MethodAverage = "average"
+)
+
+var CostBasisMethods = []string{MethodFIFO, MethodLIFO, MethodAverage}
+
+// Gas paid in ETH is a fee: it uses up holdings like a disposal but realizes no P&L
+const (
+	SideAcquisition = "acquisition"
+	SideDisposal    = "disposal"
+	SideFee         = "fee"
+)
+
+// Acquisition, disposal or fee payment of a token. Price and Value are in the history's currency at
+// the time of the trade and left out when unknown. Disposals and fees carry the cost basis they consumed,
+// disposals the realized P&L. UnknownCost marks acquisitions without a price and disposals or fees
+// that used them up, whose cost basis and P&L are left out.
+type Trade struct {
+	Time         time.Time `json:"time"`
+	Hash         string    `json:"hash"`
+	Side         string    `json:"side"`
+	Amount       float64   `json:"amount"`
+	Price        *float64  `json:"price,omitempty"`
+	Value        *float64  `json:"value,omitempty"`
+	Counterparty string    `json:"counterparty"`
+	CostBasis    *float64  `json:"costBasis,omitempty"`
+	RealizedPnL  *float64  `json:"realizedPnl,omitempty"`
+	UnknownCost  bool      `json:"unknownCost,omitempty"`
+
+	// Amount in the token's smallest unit, which lots are matched on
+	units *big.Int
+}
+
+// Position under a cost basis method. CostBasis, AverageCost and the P&L only cover holdings and
+// disposals of known cost: UnknownCostHolding is the part of the holding without a cost basis, and
+// ExcludedDisposals the disposals left out of RealizedPnL. FeeCost is the cost basis used up by fees.
+// UnrealizedPnL is left out without a current price.
+type CostBasisSummary struct {
+	Method             string   `json:"method"`
+	Holding            float64  `json:"holding"`
+	UnknownCostHolding float64  `json:"unknownCostHolding"`
+	CostBasis          float64  `json:"costBasis"`
+	AverageCost        float64  `json:"averageCost"`
+	RealizedPnL        float64  `json:"realizedPnl"`
+	ExcludedDisposals  int      `json:"excludedDisposals"`
+	FeeCost            float64  `json:"feeCost"`
+	UnrealizedPnL      *float64 `json:"unrealizedPnl,omitempty"`
+}
+
+type TradeHistory struct {
+	Address      string             `json:"address,omitempty"`
+	Addresses    []string           `json:"addresses,omitempty"`
+	Token        Token              `json:"token"`
+	Currency     string             `json:"currency"`
+	Method       string             `json:"method"`
+	CurrentPrice *float64           `json:"currentPrice,omitempty"`
+	Trades       []Trade            `json:"trades"`
+	Summary      CostBasisSummary   `json:"summary"`
+	Methods      []CostBasisSummary `json:"methods"`
+	// Trades without a historical price, which have an unknown value
+	MissingPrices int `json:"missingPrices"`
+}
+
+// Part of an acquisition not yet disposed of, in the token's smallest unit so that lots are used
+// up exactly. The cost of a lot acquired without a price is unknown.
+type lot struct {
+	units    *big.Int
+	unitCost float64
+	unknown  bool
+}
+
+// Match disposals and fees against acquisitions with the method, filling in the cost basis of each
+// and the realized P&L of disposals. Amounts beyond what was acquired have an unknown cost basis.
+func applyCostBasis(trades []Trade, decimals int, method string, currentPrice *float64) CostBasisSummary {
+	summary := CostBasisSummary{Method: method}
+	var lots []lot
+	for i := range trades {
+		trade := &trades[i]
+		if trade.Side == SideAcquisition {
+			acquired := lot{units: new(big.Int).Set(trade.units), unknown: trade.Value == nil}
+			if acquired.unknown {
+				trade.UnknownCost = true
+			} else {
+				acquired.unitCost = *trade.Value / trade.Amount
+			}
+			lots = append(lots, acquired)
+			if method == MethodAverage {
+				lots = averageLots(lots, decimals)
+			}
+			continue
+		}
+
+		cost, unknown, remaining := 0.0, false, new(big.Int).Set(trade.units)
+		for remaining.Sign() > 0 && len(lots) > 0 {
+			index := 0
+			if method == MethodLIFO {
+				index = len(lots) - 1
+			}
+			used := new(big.Int).Set(lots[index].units)
+			if remaining.Cmp(used) < 0 {
+				used.Set(remaining)
+			}
+			cost += ToFloat(used, decimals) * lots[index].unitCost
+			unknown = unknown || lots[index].unknown
+			remaining.Sub(remaining, used)
+			lots[index].units = new(big.Int).Sub(lots[index].units, used)
+			if lots[index].units.Sign() == 0 {
+				lots = append(lots[:index], lots[index+1:]...)
+			}
+		}
+		if unknown || remaining.Sign() > 0 {
+			trade.UnknownCost = true
+		} else {
+			trade.CostBasis = &cost
+		}
+
+		switch {
+		case trade.Side == SideFee:
+			if trade.CostBasis != nil {
+				summary.FeeCost += cost
+			}
+		case trade.CostBasis != nil && trade.Value != nil:
+			realized := *trade.Value - cost
+			trade.RealizedPnL = &realized
+			summary.RealizedPnL += realized
+		default:
+			summary.ExcludedDisposals++
+		}
+	}
+
+	knownHolding := 0.0
+	for _, l := range lots {
+		amount := ToFloat(l.units, decimals)
+		summary.Holding += amount
+		if l.unknown {
+			summary.UnknownCostHolding += amount
+			continue
+		}
+		knownHolding += amount
+		summary.CostBasis += amount * l.unitCost
+	}
+	if knownHolding > 0 {
+		summary.AverageCost = summary.CostBasis / knownHolding
+	}
+	if currentPrice != nil {
+		unrealized := knownHolding**currentPrice - summary.CostBasis
+		summary.UnrealizedPnL = &unrealized
+	}
+	return summary
+}
+
+// Merge the lots of known cost into a single lot at their average cost. Lots of unknown cost are
+// kept apart after it, so they are used up once the averaged holding is gone.
+func averageLots(lots []lot, decimals int) []lot {
+	merged := lot{units: new(big.Int)}
+	cost := 0.0
+	var unknown []lot
+	for _, l := range lots {
+		if l.unknown {
+			unknown = append(unknown, l)
+			continue
+		}
+		merged.units.Add(merged.units, l.units)
+		cost += ToFloat(l.units, decimals) * l.unitCost
+	}
+	if merged.units.Sign() == 0 {
+		return unknown
+	}
+	merged.unitCost = cost / ToFloat(merged.units, decimals)
+	return append([]lot{merged}, unknown...)
+}
+
+// Every acquisition and disposal of the token by the addresses, valued at historical prices,
+// with the cost basis computed under the method. Token is a contract address or "eth".
+func BuildTradeHistory(apiKey string, provider prices.PriceProvider, addresses []string, token, currency, method string) (TradeHistory, error) {
+	currency, token = strings.ToLower(currency), prices.TokenKey(token)
+	history := TradeHistory{Currency: currency, Method: method, Trades: []Trade{}}
+	if len(addresses) == 1 {
+		history.Address = strings.ToLower(addresses[0])
+	} else {
+		history.Addresses = addresses
+	}
+	if token == prices.ETH {
+		history.Token = Ether
+	}
+
+	movements, err := fetchGroupMovements(apiKey, addresses, 0)
+	if err != nil {
+		return history, err
+	}
+	for _, m := range movements {
+		if m.key() != token {
+			continue
+		}
+		history.Token = m.token
+		trade := Trade{
+			Time:         m.time,
+			Hash:         m.hash,
+			Side:         SideAcquisition,
+			Amount:       math.Abs(ToFloat(m.amount, m.token.Decimals)),
+			Counterparty: m.counterparty,
+			units:        new(big.Int).Abs(m.amount),
+		}
+		if m.amount.Sign() < 0 {
+			trade.Side = SideDisposal
+		}
+		if m.fee {
+			trade.Side = SideFee
+		}
+		price, err := provider.HistoricalPrice(token, currency, m.time)
+		if errors.Is(err, prices.ErrPriceNotFound) {
+			history.MissingPrices++
+		} else if err != nil {
+			return history, err
+		} else {
+			value := trade.Amount * price
+			trade.Price = &price
+			trade.Value = &value
+		}
+		history.Trades = append(history.Trades, trade)
+	}
+
+	spot, err := provider.SpotPrices([]string{token}, currency)
+	if err != nil {
+		return history, err
+	}
+	if price, ok := spot[token]; ok {
+		history.CurrentPrice = &price
+	}
+
+	// The summaries of other methods are computed on copies so the trades keep the requested method's figures
+	for _, other := range CostBasisMethods {
+		if other == method {
+			continue
+		}
+		copied := make([]Trade, len(history.Trades))
+		copy(copied, history.Trades)
+		history.Methods = append(history.Methods, applyCostBasis(copied, history.Token.Decimals, other, history.CurrentPrice))
+	}
+	history.Summary = applyCostBasis(history.Trades, history.Token.Decimals, method, history.CurrentPrice)
+	history.Methods = append([]CostBasisSummary{history.Summary}, history.Methods...)
+	return history, nil
+}
+
+func validMethod(method string) bool {
+	for _, candidate := range CostBasisMethods {
+		if candidate == method {
+			return true
+		}
+	}
+	return false
+}
+
+// GET /api/v1/portfolio/trades?address={address,...}&group={id}&token={contract|eth}&method={fifo|lifo|average}&currency={usd|eur|...}
+func TradeHistoryHandler(apiKey string, provider prices.PriceProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if provider == nil {
+			http.Error(w, "price provider not configured", http.StatusServiceUnavailable)
+			return
+		}
+		query := r.URL.Query()
+		addresses, ok := requestAddresses(w, query)
+		if !ok {
+			return
+		}
+		token := query.Get("token")
+		if !IsAddress(token) && !strings.EqualFold(token, prices.ETH) {
+			http.Error(w, "Missing or invalid 'token' query parameter, expected a contract address or eth", http.StatusBadRequest)
+			return
+		}
+		method := strings.ToLower(query.Get("method"))
+		if method == "" {
+			method = MethodFIFO
+		}
+		if !validMethod(method) {
+			http.Error(w, "Invalid method, expected fifo, lifo or average", http.StatusBadRequest)
+			return
+		}
+		currency := query.Get("currency")
+		if currency == "" {
+			currency = prices.DefaultCurrency
+		}
+
+		history, err := BuildTradeHistory(apiKey, provider, addresses, token, currency, method)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error building trade history: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(history)
+	}
+}
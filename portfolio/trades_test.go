@@ -0,0 +1,183 @@
+package portfolio
+
+import (
+	"ethereye/prices"
+	. "ethereye/utils"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestApplyCostBasis(t *testing.T) {
+	trade := func(side string, amount, price float64) Trade {
+		value := amount * price
+		units, _ := ParseUnits(strconv.FormatFloat(amount, 'f', -1, 64), 18)
+		return Trade{Side: side, Amount: amount, Price: &price, Value: &value, units: units}
+	}
+	unpriced := func(amount float64) Trade {
+		acquisition := trade(SideAcquisition, amount, 0)
+		acquisition.Price, acquisition.Value = nil, nil
+		return acquisition
+	}
+	current := 400.0
+
+	tests := []struct {
+		method     string
+		realized   float64
+		costBasis  float64
+		unrealized float64
+	}{
+		{MethodFIFO, 200, 200, 200},
+		{MethodLIFO, 100, 100, 300},
+		{MethodAverage, 150, 150, 250},
+	}
+	for _, test := range tests {
+		t.Run("Test with "+test.method, func(t *testing.T) {
+			trades := []Trade{
+				trade(SideAcquisition, 1, 100),
+				trade(SideAcquisition, 1, 200),
+				trade(SideDisposal, 1, 300),
+			}
+			summary := applyCostBasis(trades, 18, test.method, &current)
+			if summary.RealizedPnL != test.realized || *trades[2].RealizedPnL != test.realized {
+				t.Errorf("Expected realized P&L %f, got %f", test.realized, summary.RealizedPnL)
+			}
+			if summary.Holding != 1 || summary.CostBasis != test.costBasis {
+				t.Errorf("Expected a holding of 1 with cost basis %f, got %+v", test.costBasis, summary)
+			}
+			if summary.UnrealizedPnL == nil || *summary.UnrealizedPnL != test.unrealized {
+				t.Errorf("Expected unrealized P&L %f, got %v", test.unrealized, summary.UnrealizedPnL)
+			}
+		})
+	}
+
+	t.Run("Test with a disposal beyond acquisitions", func(t *testing.T) {
+		trades := []Trade{trade(SideAcquisition, 1, 100), trade(SideDisposal, 2, 150)}
+		summary := applyCostBasis(trades, 18, MethodFIFO, nil)
+		if summary.RealizedPnL != 0 || summary.ExcludedDisposals != 1 || summary.Holding != 0 || summary.UnrealizedPnL != nil {
+			t.Errorf("Unexpected summary %+v", summary)
+		}
+		if !trades[1].UnknownCost || trades[1].RealizedPnL != nil {
+			t.Errorf("Expected a disposal of unknown cost, got %+v", trades[1])
+		}
+	})
+
+	t.Run("Test with an acquisition without a price", func(t *testing.T) {
+		for _, method := range CostBasisMethods {
+			trades := []Trade{
+				trade(SideAcquisition, 1, 100),
+				unpriced(1),
+				trade(SideDisposal, 1, 300),
+				trade(SideDisposal, 0.5, 300),
+			}
+			summary := applyCostBasis(trades, 18, method, &current)
+			if !trades[1].UnknownCost {
+				t.Errorf("Expected the acquisition to have an unknown cost under %s", method)
+			}
+			// Under lifo the first disposal uses up the unknown lot and the second the priced one
+			realized, unknownHolding, costBasis := 200.0, 0.5, 0.0
+			if method == MethodLIFO {
+				realized, unknownHolding, costBasis = 100, 0, 50
+			}
+			if summary.RealizedPnL != realized || summary.ExcludedDisposals != 1 {
+				t.Errorf("Expected realized P&L %f with one excluded disposal under %s, got %+v", realized, method, summary)
+			}
+			if summary.Holding != 0.5 || summary.UnknownCostHolding != unknownHolding || summary.CostBasis != costBasis {
+				t.Errorf("Unexpected holding under %s: %+v", method, summary)
+			}
+			if unrealized := (0.5-unknownHolding)*current - costBasis; *summary.UnrealizedPnL != unrealized {
+				t.Errorf("Expected unrealized P&L %f under %s, got %f", unrealized, method, *summary.UnrealizedPnL)
+			}
+		}
+	})
+
+	t.Run("Test with decimal amounts", func(t *testing.T) {
+		// 0.7 + 0.1 is not 0.8 in floating point
+		for _, method := range CostBasisMethods {
+			trades := []Trade{trade(SideAcquisition, 0.7, 100), trade(SideAcquisition, 0.1, 100), trade(SideDisposal, 0.8, 200)}
+			summary := applyCostBasis(trades, 18, method, nil)
+			if trades[2].UnknownCost || trades[2].RealizedPnL == nil || summary.ExcludedDisposals != 0 || summary.Holding != 0 {
+				t.Errorf("Expected the disposal to use up both lots under %s, got %+v (%+v)", method, trades[2], summary)
+			}
+			if math.Abs(summary.RealizedPnL-80) > 1e-9 {
+				t.Errorf("Expected realized P&L 80 under %s, got %f", method, summary.RealizedPnL)
+			}
+		}
+	})
+
+	t.Run("Test with a fee", func(t *testing.T) {
+		trades := []Trade{trade(SideAcquisition, 1, 100), trade(SideFee, 0.25, 300), trade(SideDisposal, 0.5, 300)}
+		summary := applyCostBasis(trades, 18, MethodFIFO, nil)
+		if summary.RealizedPnL != 100 || summary.FeeCost != 25 || summary.ExcludedDisposals != 0 {
+			t.Errorf("Unexpected summary %+v", summary)
+		}
+		if trades[1].RealizedPnL != nil || trades[1].CostBasis == nil || *trades[1].CostBasis != 25 {
+			t.Errorf("Expected a fee with a cost basis and no P&L, got %+v", trades[1])
+		}
+		if summary.Holding != 0.25 {
+			t.Errorf("Expected a holding of 0.25, got %f", summary.Holding)
+		}
+	})
+}
+
+func TestBuildTradeHistory(t *testing.T) {
+	useFakeHistory(t)
+	provider := fixedPrices{prices.ETH: 2000, usdc: 1}
+
+	history, err := BuildTradeHistory("", provider, []string{wallet}, prices.ETH, "usd", MethodLIFO)
+	if err != nil {
+		t.Fatalf("BuildTradeHistory returned error: %v", err)
+	}
+	// Received 2 ETH, sent 0.5 ETH, paid two fees, received 1 ETH internally
+	if len(history.Trades) != 5 || history.Token.Symbol != "ETH" {
+		t.Fatalf("Unexpected trades %+v", history.Trades)
+	}
+	fees := 0
+	for _, trade := range history.Trades {
+		if trade.Side == SideFee {
+			fees++
+		}
+	}
+	if fees != 2 {
+		t.Errorf("Expected 2 fees, got %d", fees)
+	}
+	// Prices do not move, and fees realize nothing
+	if history.Summary.RealizedPnL != 0 || history.Summary.FeeCost <= 0 {
+		t.Errorf("Unexpected summary %+v", history.Summary)
+	}
+	if history.Summary.Method != MethodLIFO || len(history.Methods) != 3 || history.Methods[0].Method != MethodLIFO {
+		t.Errorf("Unexpected summaries %+v", history.Methods)
+	}
+	if history.CurrentPrice == nil || *history.CurrentPrice != 2000 {
+		t.Errorf("Unexpected current price %v", history.CurrentPrice)
+	}
+	if history.Summary.Holding < 2.4999 || history.Summary.Holding > 2.5 {
+		t.Errorf("Unexpected holding %f", history.Summary.Holding)
+	}
+}
+
+func TestTradeHistoryHandler(t *testing.T) {
+	useFakeHistory(t)
+	handler := TradeHistoryHandler("", fixedPrices{prices.ETH: 2000})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"Test with missing token", "?address=" + wallet, http.StatusBadRequest},
+		{"Test with invalid method", "?address=" + wallet + "&token=eth&method=hifo", http.StatusBadRequest},
+		{"Test with valid request", "?address=" + wallet + "&token=" + usdc + "&method=average", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/portfolio/trades"+test.query, nil))
+			if rr.Code != test.expected {
+				t.Errorf("Expected status code %d, got %d", test.expected, rr.Code)
+			}
+		})
+	}
+}
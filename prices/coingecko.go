@@ -0,0 +1,184 @@
+package prices
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+/******************
+CoinGecko
+******************/
+
+const CoinGeckoAPIURL = "https://api.coingecko.com/api/v3"
+
+// How long spot prices are reused
+const DefaultSpotTTL = time.Minute
+
+// Price provider backed by the CoinGecko API or any server speaking its protocol.
+// Historical prices are fetched a day at a time and kept for past days.
+type CoinGecko struct {
+	BaseURL string
+	APIKey  string
+	SpotTTL time.Duration
+
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	spot    map[string]spotPrice
+	history map[string][]PricePoint
+}
+
+type spotPrice struct {
+	price     float64
+	fetchedAt time.Time
+}
+
+func NewCoinGecko(baseURL, apiKey string) *CoinGecko {
+	if baseURL == "" {
+		baseURL = CoinGeckoAPIURL
+	}
+	return &CoinGecko{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		SpotTTL:    DefaultSpotTTL,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		spot:       make(map[string]spotPrice),
+		history:    make(map[string][]PricePoint),
+	}
+}
+
+func (c *CoinGecko) ID() string {
+	return "coingecko:" + c.BaseURL
+}
+
+func (c *CoinGecko) get(path string, query url.Values, result interface{}) error {
+	if c.APIKey != "" {
+		query.Set("x_cg_demo_api_key", c.APIKey)
+	}
+	response, err := c.httpClient.Get(c.BaseURL + path + "?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		return ErrPriceNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("price API returned %s: %s", response.Status, data)
+	}
+	return json.Unmarshal(data, result)
+}
+
+func (c *CoinGecko) SpotPrices(tokens []string, currency string) (map[string]float64, error) {
+	currency = strings.ToLower(currency)
+	prices := make(map[string]float64)
+	var missing []string
+
+	c.mu.Lock()
+	for _, token := range tokens {
+		token = TokenKey(token)
+		if cached, ok := c.spot[token+"/"+currency]; ok && time.Since(cached.fetchedAt) < c.SpotTTL {
+			prices[token] = cached.price
+		} else {
+			missing = append(missing, token)
+		}
+	}
+	c.mu.Unlock()
+	if len(missing) == 0 {
+		return prices, nil
+	}
+
+	var contracts []string
+	fetched := make(map[string]float64)
+	for _, token := range missing {
+		if token != ETH {
+			contracts = append(contracts, token)
+			continue
+		}
+		var result map[string]map[string]float64
+		if err := c.get("/simple/price", url.Values{"ids": {"ethereum"}, "vs_currencies": {currency}}, &result); err != nil {
+			return nil, err
+		}
+		if price, ok := result["ethereum"][currency]; ok {
+			fetched[ETH] = price
+		}
+	}
+	if len(contracts) > 0 {
+		var result map[string]map[string]float64
+		query := url.Values{"contract_addresses": {strings.Join(contracts, ",")}, "vs_currencies": {currency}}
+		if err := c.get("/simple/token_price/ethereum", query, &result); err != nil {
+			return nil, err
+		}
+		for contract, quotes := range result {
+			if price, ok := quotes[currency]; ok {
+				fetched[TokenKey(contract)] = price
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for token, price := range fetched {
+		c.spot[token+"/"+currency] = spotPrice{price: price, fetchedAt: time.Now()}
+		prices[token] = price
+	}
+	return prices, nil
+}
+
+func (c *CoinGecko) HistoricalPrice(token, currency string, at time.Time) (float64, error) {
+	token, currency = TokenKey(token), strings.ToLower(currency)
+	day := at.UTC().Truncate(24 * time.Hour)
+	key := token + "/" + currency + "/" + day.Format("2006-01-02")
+
+	c.mu.Lock()
+	points, ok := c.history[key]
+	c.mu.Unlock()
+	if !ok {
+		path := "/coins/ethereum/market_chart/range"
+		if token != ETH {
+			path = "/coins/ethereum/contract/" + token + "/market_chart/range"
+		}
+		query := url.Values{
+			"vs_currency": {currency},
+			"from":        {fmt.Sprint(day.Unix())},
+			"to":          {fmt.Sprint(day.Add(24 * time.Hour).Unix())},
+		}
+		var result struct {
+			Prices [][2]float64 `json:"prices"`
+		}
+		// An unknown token has no points, like a day without prices
+		if err := c.get(path, query, &result); err != nil && err != ErrPriceNotFound {
+			return 0, err
+		}
+		points = make([]PricePoint, 0, len(result.Prices))
+		for _, point := range result.Prices {
+			points = append(points, PricePoint{Time: time.UnixMilli(int64(point[0])).UTC(), Price: point[1]})
+		}
+		// The current day is still moving, so only past days are kept
+		if day.Add(24 * time.Hour).Before(time.Now()) {
+			c.mu.Lock()
+			c.history[key] = points
+			c.mu.Unlock()
+		}
+	}
+
+	if len(points) == 0 {
+		return 0, ErrPriceNotFound
+	}
+	if price, ok := priceAt(points, at); ok {
+		return price, nil
+	}
+	// Before the first point of the day
+	return points[0].Price, nil
+}
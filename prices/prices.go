@@ -0,0 +1,60 @@
+package prices
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+/******************
+Prices
+******************/
+
+// Token key of ether. ERC-20 tokens are keyed by their lowercase contract address.
+const ETH = "eth"
+
+const DefaultCurrency = "usd"
+
+var ErrPriceNotFound = errors.New("price not found")
+
+// Spot and historical token prices in a fiat currency such as "usd" or "eur"
+type PriceProvider interface {
+	// Current prices of the tokens. Tokens without a known price are left out.
+	SpotPrices(tokens []string, currency string) (map[string]float64, error)
+	// Price of the token at the given time, ErrPriceNotFound if unknown
+	HistoricalPrice(token, currency string, at time.Time) (float64, error)
+}
+
+// Name of the price source, so values computed from one provider are not mistaken for another's.
+// Providers may name themselves with an ID method; others are named by their type.
+func ProviderID(provider PriceProvider) string {
+	if named, ok := provider.(interface{ ID() string }); ok {
+		return named.ID()
+	}
+	return fmt.Sprintf("%T", provider)
+}
+
+// Normalize a token key: the contract address in lowercase, or ETH for ether
+func TokenKey(contract string) string {
+	if contract == "" || strings.EqualFold(contract, ETH) {
+		return ETH
+	}
+	return strings.ToLower(contract)
+}
+
+// Price observed at a time
+type PricePoint struct {
+	Time  time.Time `json:"time"`
+	Price float64   `json:"price"`
+}
+
+// Latest point at or before the given time, from points sorted by time
+func priceAt(points []PricePoint, at time.Time) (float64, bool) {
+	i := sort.Search(len(points), func(i int) bool { return points[i].Time.After(at) })
+	if i == 0 {
+		return 0, false
+	}
+	return points[i-1].Price, true
+}
@@ -0,0 +1,117 @@
+package prices
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const usdc = "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"
+
+func TestCoinGecko(t *testing.T) {
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		var response interface{}
+		switch r.URL.Path {
+		case "/simple/price":
+			response = map[string]map[string]float64{"ethereum": {"eur": 2800}}
+		case "/simple/token_price/ethereum":
+			response = map[string]map[string]float64{usdc: {"eur": 0.92}}
+		case "/coins/ethereum/market_chart/range":
+			from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+			response = map[string][][2]float64{"prices": {
+				{float64(from + 5*60*1000), 2200},
+				{float64(from + 12*60*60*1000), 2300},
+			}}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+	provider := NewCoinGecko(server.URL, "")
+
+	t.Run("Test with spot prices", func(t *testing.T) {
+		prices, err := provider.SpotPrices([]string{"", usdc, "0xdead"}, "EUR")
+		if err != nil {
+			t.Fatalf("SpotPrices() returned an error: %v", err)
+		}
+		if prices[ETH] != 2800 || prices[usdc] != 0.92 || len(prices) != 2 {
+			t.Errorf("Unexpected spot prices: %v", prices)
+		}
+		provider.SpotPrices([]string{ETH, usdc}, "eur")
+		if requests["/simple/price"] != 1 || requests["/simple/token_price/ethereum"] != 1 {
+			t.Errorf("Expected cached spot prices, got requests %v", requests)
+		}
+	})
+
+	t.Run("Test with historical prices", func(t *testing.T) {
+		morning, err := provider.HistoricalPrice(ETH, "usd", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		if err != nil || morning != 2200 {
+			t.Errorf("Expected the first price of the day, got %f (%v)", morning, err)
+		}
+		evening, _ := provider.HistoricalPrice(ETH, "usd", time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC))
+		if evening != 2300 {
+			t.Errorf("Expected the latest price before the time, got %f", evening)
+		}
+		if requests["/coins/ethereum/market_chart/range"] != 1 {
+			t.Errorf("Expected the day to be fetched once, got %d requests", requests["/coins/ethereum/market_chart/range"])
+		}
+		if _, err := provider.HistoricalPrice(usdc, "usd", time.Now()); err != ErrPriceNotFound {
+			t.Errorf("Expected ErrPriceNotFound, got %v", err)
+		}
+
+		// Tokens unknown on past days are not asked for again
+		past := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		for i := 0; i < 2; i++ {
+			if _, err := provider.HistoricalPrice(usdc, "usd", past); err != ErrPriceNotFound {
+				t.Errorf("Expected ErrPriceNotFound, got %v", err)
+			}
+		}
+		if path := "/coins/ethereum/contract/" + usdc + "/market_chart/range"; requests[path] != 2 {
+			t.Errorf("Expected one request for today and one for the past day, got %d", requests[path])
+		}
+	})
+}
+
+func TestStaticPrices(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "prices.json")
+	ioutil.WriteFile(filename, []byte(`{
+		"usd": {
+			"eth": {"spot": 3000, "history": {"2024-01-01": 2300, "2024-01-03T12:00:00Z": 2500}},
+			"0xA0b86991c6218b36c1d19d4a2e9eb0ce3606eB48": {"history": {"2024-01-01": 1.01, "2024-01-02": 0.99}}
+		}
+	}`), 0644)
+
+	provider, err := LoadStaticPrices(filename)
+	if err != nil {
+		t.Fatalf("LoadStaticPrices() returned an error: %v", err)
+	}
+
+	prices, _ := provider.SpotPrices([]string{"", usdc}, "usd")
+	if prices[ETH] != 3000 || prices[usdc] != 0.99 {
+		t.Errorf("Unexpected spot prices: %v", prices)
+	}
+
+	tests := []struct {
+		at       time.Time
+		expected float64
+		err      error
+	}{
+		{time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC), 0, ErrPriceNotFound},
+		{time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), 2300, nil},
+		{time.Date(2024, 1, 3, 13, 0, 0, 0, time.UTC), 2500, nil},
+	}
+	for _, test := range tests {
+		price, err := provider.HistoricalPrice(ETH, "usd", test.at)
+		if price != test.expected || err != test.err {
+			t.Errorf("HistoricalPrice at %s = %f (%v), want %f (%v)", test.at, price, err, test.expected, test.err)
+		}
+	}
+}
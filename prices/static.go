@@ -0,0 +1,89 @@
+package prices
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+/******************
+Static Prices
+******************/
+
+// Prices of a token in one currency as stored in a price file
+type staticToken struct {
+	Spot    *float64           `json:"spot"`
+	History map[string]float64 `json:"history"`
+}
+
+// Price provider reading a JSON file, for offline use. The file maps currency to token to prices,
+// with history keyed by RFC3339 time or YYYY-MM-DD date:
+//
+//	{"usd": {"eth": {"spot": 3000, "history": {"2024-01-01": 2300}}}}
+//
+// Historical prices hold until the next entry. Without a spot price the latest historical one is used.
+type StaticPrices struct {
+	filename string
+	spot     map[string]float64
+	history  map[string][]PricePoint
+}
+
+func LoadStaticPrices(filename string) (*StaticPrices, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var file map[string]map[string]staticToken
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	s := &StaticPrices{filename: filename, spot: make(map[string]float64), history: make(map[string][]PricePoint)}
+	for currency, tokens := range file {
+		for token, prices := range tokens {
+			key := TokenKey(token) + "/" + strings.ToLower(currency)
+			var points []PricePoint
+			for at, price := range prices.History {
+				parsed, err := time.Parse("2006-01-02", at)
+				if err != nil {
+					if parsed, err = time.Parse(time.RFC3339, at); err != nil {
+						return nil, err
+					}
+				}
+				points = append(points, PricePoint{Time: parsed.UTC(), Price: price})
+			}
+			sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+			s.history[key] = points
+
+			if prices.Spot != nil {
+				s.spot[key] = *prices.Spot
+			} else if len(points) > 0 {
+				s.spot[key] = points[len(points)-1].Price
+			}
+		}
+	}
+	return s, nil
+}
+
+func (s *StaticPrices) ID() string {
+	return "static:" + s.filename
+}
+
+func (s *StaticPrices) SpotPrices(tokens []string, currency string) (map[string]float64, error) {
+	prices := make(map[string]float64)
+	for _, token := range tokens {
+		if price, ok := s.spot[TokenKey(token)+"/"+strings.ToLower(currency)]; ok {
+			prices[TokenKey(token)] = price
+		}
+	}
+	return prices, nil
+}
+
+func (s *StaticPrices) HistoricalPrice(token, currency string, at time.Time) (float64, error) {
+	if price, ok := priceAt(s.history[TokenKey(token)+"/"+strings.ToLower(currency)], at); ok {
+		return price, nil
+	}
+	return 0, ErrPriceNotFound
+}
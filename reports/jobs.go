@@ -0,0 +1,311 @@
+package reports
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"ethereye/portfolio"
+	"ethereye/prices"
+	. "ethereye/transactions"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+/******************
+Report Jobs
+******************/
+
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Reports generated at the same time; the others wait for a slot
+const maxRunningJobs = 2
+
+// Finished jobs and their archives are deleted after this long
+const jobRetention = 24 * time.Hour
+
+// First year with Ethereum transactions
+const firstTaxYear = 2015
+
+type TaxReportRequest struct {
+	Address   string   `json:"address,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+	Group     string   `json:"group,omitempty"`
+	Year      int      `json:"year"`
+	Format    string   `json:"format"`
+	Method    string   `json:"method"`
+	Currency  string   `json:"currency"`
+}
+
+// Tax report generated in the background. The archive can be downloaded once the job is done.
+type Job struct {
+	ID          string                `json:"id"`
+	Status      string                `json:"status"`
+	Error       string                `json:"error,omitempty"`
+	Request     TaxReportRequest      `json:"request"`
+	Events      int                   `json:"events"`
+	Summary     *portfolio.TaxSummary `json:"summary,omitempty"`
+	CreatedAt   time.Time             `json:"createdAt"`
+	CompletedAt *time.Time            `json:"completedAt,omitempty"`
+}
+
+// Tax report jobs. Jobs are kept in memory and their archives written to the directory, both until
+// the retention has passed since the job finished.
+type Jobs struct {
+	dir       string
+	retention time.Duration
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	slots     chan struct{}
+	build     func(request TaxReportRequest, addresses []string) (portfolio.TaxReport, error)
+}
+
+// Archives left in the directory by an earlier run are deleted, as their jobs are gone
+func NewJobs(dir, apiKey string, provider prices.PriceProvider) *Jobs {
+	jobs := &Jobs{
+		dir:       dir,
+		retention: jobRetention,
+		jobs:      make(map[string]*Job),
+		slots:     make(chan struct{}, maxRunningJobs),
+		build: func(request TaxReportRequest, addresses []string) (portfolio.TaxReport, error) {
+			return portfolio.BuildTaxReport(apiKey, provider, addresses, request.Year, request.Currency, request.Method)
+		},
+	}
+	for _, pattern := range []string{"*.zip", "*.tmp"} {
+		leftovers, _ := filepath.Glob(filepath.Join(dir, pattern))
+		for _, leftover := range leftovers {
+			if err := os.Remove(leftover); err != nil {
+				log.Printf("Failed to remove stale tax report %s: %v", leftover, err)
+			}
+		}
+	}
+	return jobs
+}
+
+// Queue a report of the addresses
+func (j *Jobs) Submit(request TaxReportRequest, addresses []string) (Job, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Job{}, err
+	}
+	job := &Job{ID: hex.EncodeToString(id), Status: JobPending, Request: request, CreatedAt: time.Now().UTC()}
+
+	j.mu.Lock()
+	j.expire(time.Now())
+	j.jobs[job.ID] = job
+	snapshot := *job
+	j.mu.Unlock()
+
+	go j.run(job.ID, request, addresses)
+	return snapshot, nil
+}
+
+func (j *Jobs) Get(id string) (Job, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.expire(time.Now())
+	job, ok := j.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Delete the jobs finished longer than the retention ago with their archives. Callers hold the lock.
+func (j *Jobs) expire(now time.Time) {
+	for id, job := range j.jobs {
+		if job.CompletedAt == nil || now.Sub(*job.CompletedAt) < j.retention {
+			continue
+		}
+		delete(j.jobs, id)
+		if err := os.Remove(j.archive(id)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove tax report %s: %v", id, err)
+		}
+	}
+}
+
+// Path of the job's archive
+func (j *Jobs) archive(id string) string {
+	return filepath.Join(j.dir, id+".zip")
+}
+
+func (j *Jobs) run(id string, request TaxReportRequest, addresses []string) {
+	j.slots <- struct{}{}
+	defer func() { <-j.slots }()
+	j.update(id, func(job *Job) { job.Status = JobRunning })
+
+	report, err := j.build(request, addresses)
+	if err == nil {
+		err = j.write(id, report, request.Format)
+	}
+	j.update(id, func(job *Job) {
+		now := time.Now().UTC()
+		job.CompletedAt = &now
+		if err != nil {
+			log.Printf("Tax report %s failed: %v", id, err)
+			job.Status, job.Error = JobFailed, err.Error()
+			return
+		}
+		job.Status = JobDone
+		job.Events = len(report.Events)
+		job.Summary = &report.Summary
+	})
+}
+
+func (j *Jobs) update(id string, change func(job *Job)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	change(j.jobs[id])
+}
+
+// Write the archive to a temporary file first so a download never sees a partial archive
+func (j *Jobs) write(id string, report portfolio.TaxReport, format string) error {
+	if err := os.MkdirAll(j.dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(j.dir, id+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if err := WriteTaxReport(file, report, format); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), j.archive(id))
+}
+
+// Fill in defaults and resolve the addresses of the request
+func (request *TaxReportRequest) validate() ([]string, error) {
+	if request.Year < firstTaxYear || request.Year > time.Now().UTC().Year() {
+		return nil, fmt.Errorf("invalid year, expected %d to %d", firstTaxYear, time.Now().UTC().Year())
+	}
+	request.Format = strings.ToLower(request.Format)
+	if request.Format == "" {
+		request.Format = FormatGeneric
+	}
+	if !contains(TaxFormats, request.Format) {
+		return nil, fmt.Errorf("invalid format, expected %s", strings.Join(TaxFormats, ", "))
+	}
+	request.Method = strings.ToLower(request.Method)
+	if request.Method == "" {
+		request.Method = portfolio.MethodFIFO
+	}
+	if !contains(portfolio.TaxMethods, request.Method) {
+		return nil, fmt.Errorf("invalid method, expected %s", strings.Join(portfolio.TaxMethods, ", "))
+	}
+	request.Currency = strings.ToLower(request.Currency)
+	if request.Currency == "" {
+		request.Currency = prices.DefaultCurrency
+	}
+
+	query := url.Values{}
+	if request.Group != "" {
+		query.Set("group", request.Group)
+	}
+	for _, address := range append([]string{request.Address}, request.Addresses...) {
+		if address != "" {
+			query.Add("address", address)
+		}
+	}
+	addresses, err := RequestAddresses(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, errors.New("missing address or group")
+	}
+	return addresses, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// POST /api/v1/reports/tax          queue a tax report
+// GET  /api/v1/reports/tax?id={id}  job status
+func TaxReportHandler(jobs *Jobs, provider prices.PriceProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			job, ok := jobs.Get(r.URL.Query().Get("id"))
+			if !ok {
+				http.Error(w, "Report job not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(job)
+
+		case http.MethodPost:
+			if provider == nil {
+				http.Error(w, "price provider not configured", http.StatusServiceUnavailable)
+				return
+			}
+			var request TaxReportRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			addresses, err := request.validate()
+			if errors.Is(err, ErrUnknownGroup) {
+				http.Error(w, fmt.Sprintf("Unknown group %q", request.Group), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			job, err := jobs.Submit(request, addresses)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error queuing report: %s", err.Error()), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(job)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// GET /api/v1/reports/tax/download?id={id}
+func TaxReportDownloadHandler(jobs *Jobs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := jobs.Get(r.URL.Query().Get("id"))
+		if !ok {
+			http.Error(w, "Report job not found", http.StatusNotFound)
+			return
+		}
+		if job.Status != JobDone {
+			http.Error(w, fmt.Sprintf("Report is %s", job.Status), http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"tax-report-%d-%s.zip\"", job.Request.Year, job.Request.Format))
+		http.ServeFile(w, r, jobs.archive(job.ID))
+	}
+}
@@ -0,0 +1,165 @@
+package reports
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"ethereye/portfolio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Jobs building the sample report, or failing when fail is set
+func newTestJobs(t *testing.T, fail bool) *Jobs {
+	jobs := NewJobs(t.TempDir(), "", nil)
+	jobs.build = func(request TaxReportRequest, addresses []string) (portfolio.TaxReport, error) {
+		if fail {
+			return portfolio.TaxReport{}, errors.New("explorer unavailable")
+		}
+		return sampleReport(), nil
+	}
+	return jobs
+}
+
+// Poll the job until it leaves the queue
+func waitForJob(t *testing.T, jobs *Jobs, id string) Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, _ := jobs.Get(id); job.Status == JobDone || job.Status == JobFailed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not complete", id)
+	return Job{}
+}
+
+func TestTaxReportHandler(t *testing.T) {
+	jobs := newTestJobs(t, false)
+	handler := TaxReportHandler(jobs, fixedPrice{})
+	post := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/reports/tax", bytes.NewReader(data)))
+		return rr
+	}
+	address := "0x1111111111111111111111111111111111111111"
+
+	tests := []struct {
+		name     string
+		body     map[string]interface{}
+		expected int
+	}{
+		{"Test with missing address", map[string]interface{}{"year": 2023}, http.StatusBadRequest},
+		{"Test with invalid year", map[string]interface{}{"address": address, "year": 2010}, http.StatusBadRequest},
+		{"Test with invalid format", map[string]interface{}{"address": address, "year": 2023, "format": "turbotax"}, http.StatusBadRequest},
+		{"Test with average cost method", map[string]interface{}{"address": address, "year": 2023, "method": "average"}, http.StatusBadRequest},
+		{"Test with unknown group", map[string]interface{}{"group": "treasury", "year": 2023}, http.StatusNotFound},
+		{"Test with valid request", map[string]interface{}{"address": address, "year": 2023, "format": "koinly"}, http.StatusAccepted},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if rr := post(test.body); rr.Code != test.expected {
+				t.Errorf("Expected status code %d, got %d", test.expected, rr.Code)
+			}
+		})
+	}
+
+	rr := post(map[string]interface{}{"address": address, "year": 2023})
+	var job Job
+	json.NewDecoder(rr.Body).Decode(&job)
+	if job.Request.Format != FormatGeneric || job.Request.Method != portfolio.MethodFIFO || job.Request.Currency != "usd" {
+		t.Errorf("Expected defaults to be filled in, got %+v", job.Request)
+	}
+	job = waitForJob(t, jobs, job.ID)
+	if job.Status != JobDone || job.Events != 4 || job.Summary == nil || job.Summary.LongTermGain != 4000 {
+		t.Fatalf("Unexpected job %+v", job)
+	}
+
+	// Test status and download
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/reports/tax?id="+job.ID, nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	TaxReportDownloadHandler(jobs).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/reports/tax/download?id="+job.ID, nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("Expected a zip download, got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if files := readArchive(t, rr.Body.Bytes()); len(files) != 5 {
+		t.Errorf("Expected the generic layout's 5 files, got %d", len(files))
+	}
+}
+
+func TestTaxReportDownloadHandler(t *testing.T) {
+	jobs := newTestJobs(t, true)
+	job, _ := jobs.Submit(TaxReportRequest{Year: 2023, Format: FormatGeneric, Method: portfolio.MethodFIFO}, []string{"0x1111111111111111111111111111111111111111"})
+	job = waitForJob(t, jobs, job.ID)
+	if job.Status != JobFailed || job.Error != "explorer unavailable" {
+		t.Errorf("Unexpected job %+v", job)
+	}
+
+	tests := []struct {
+		name     string
+		id       string
+		expected int
+	}{
+		{"Test with unknown job", "missing", http.StatusNotFound},
+		{"Test with failed job", job.ID, http.StatusConflict},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			TaxReportDownloadHandler(jobs).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/reports/tax/download?id="+test.id, nil))
+			if rr.Code != test.expected {
+				t.Errorf("Expected status code %d, got %d", test.expected, rr.Code)
+			}
+		})
+	}
+}
+
+func TestJobsExpiry(t *testing.T) {
+	jobs := newTestJobs(t, false)
+	job, _ := jobs.Submit(TaxReportRequest{Year: 2023, Format: FormatGeneric, Method: portfolio.MethodFIFO}, []string{"0x1111111111111111111111111111111111111111"})
+	job = waitForJob(t, jobs, job.ID)
+	if _, err := os.Stat(jobs.archive(job.ID)); err != nil {
+		t.Fatalf("Expected the archive to be written: %v", err)
+	}
+
+	jobs.update(job.ID, func(job *Job) {
+		completed := job.CompletedAt.Add(-jobRetention)
+		job.CompletedAt = &completed
+	})
+	if _, ok := jobs.Get(job.ID); ok {
+		t.Errorf("Expected the job to expire")
+	}
+	if _, err := os.Stat(jobs.archive(job.ID)); !os.IsNotExist(err) {
+		t.Errorf("Expected the archive to be deleted, got %v", err)
+	}
+
+	t.Run("Test with archives of an earlier run", func(t *testing.T) {
+		dir := t.TempDir()
+		stale := filepath.Join(dir, "0123456789abcdef.zip")
+		os.WriteFile(stale, []byte("zip"), 0644)
+		NewJobs(dir, "", nil)
+		if _, err := os.Stat(stale); !os.IsNotExist(err) {
+			t.Errorf("Expected the stale archive to be deleted, got %v", err)
+		}
+	})
+}
+
+// Price provider that is only checked for being configured
+type fixedPrice struct{}
+
+func (fixedPrice) SpotPrices(tokens []string, currency string) (map[string]float64, error) {
+	return map[string]float64{}, nil
+}
+
+func (fixedPrice) HistoricalPrice(token, currency string, at time.Time) (float64, error) {
+	return 1, nil
+}
@@ -0,0 +1,198 @@
+package reports
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"ethereye/portfolio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/******************
+Tax Report Layouts
+******************/
+
+// Layouts of the exported CSV files
+const (
+	// Separate files of acquisitions, disposals, income and fees, with a summary
+	FormatGeneric = "generic"
+	// Koinly universal import format
+	FormatKoinly = "koinly"
+	// CoinTracking CSV import format
+	FormatCoinTracking = "cointracking"
+)
+
+var TaxFormats = []string{FormatGeneric, FormatKoinly, FormatCoinTracking}
+
+// Write the report's CSV files in the layout to a zip archive
+func WriteTaxReport(w io.Writer, report portfolio.TaxReport, format string) error {
+	archive := zip.NewWriter(w)
+	var files map[string][][]string
+	switch format {
+	case FormatKoinly:
+		files = map[string][][]string{"koinly.csv": koinlyRows(report)}
+	case FormatCoinTracking:
+		files = map[string][][]string{"cointracking.csv": coinTrackingRows(report)}
+	default:
+		files = genericFiles(report)
+	}
+
+	for _, name := range sortedNames(files) {
+		file, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		writer := csv.NewWriter(file)
+		if err := writer.WriteAll(files[name]); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func genericFiles(report portfolio.TaxReport) map[string][][]string {
+	currency := strings.ToUpper(report.Currency)
+	acquisitions := [][]string{{"Date", "Token", "Contract", "Amount", "Value", "Currency", "Transaction Hash", "Counterparty"}}
+	disposals := [][]string{{"Date", "Token", "Contract", "Amount", "Proceeds", "Cost Basis", "Gain", "Holding Period", "Acquired", "Currency", "Transaction Hash", "Counterparty"}}
+	income := [][]string{{"Date", "Kind", "Token", "Contract", "Amount", "Value", "Currency", "Transaction Hash", "Counterparty"}}
+	fees := [][]string{{"Date", "Token", "Amount", "Value", "Currency", "Transaction Hash"}}
+
+	for _, event := range report.Events {
+		date := event.Time.Format(time.RFC3339)
+		amount := formatAmount(event.Amount)
+		switch event.Type {
+		case portfolio.TaxAcquisition:
+			acquisitions = append(acquisitions, []string{date, event.Token.Symbol, event.Token.Contract, amount, formatValue(event.Value), currency, event.Hash, event.Counterparty})
+		case portfolio.TaxDisposal:
+			acquired := ""
+			if event.AcquiredAt != nil {
+				acquired = event.AcquiredAt.Format(time.RFC3339)
+			}
+			disposals = append(disposals, []string{date, event.Token.Symbol, event.Token.Contract, amount, formatValue(event.Value), formatValue(event.CostBasis), formatValue(event.Gain), event.HoldingPeriod, acquired, currency, event.Hash, event.Counterparty})
+		case portfolio.TaxIncome:
+			income = append(income, []string{date, event.IncomeKind, event.Token.Symbol, event.Token.Contract, amount, formatValue(event.Value), currency, event.Hash, event.Counterparty})
+		case portfolio.TaxFee:
+			fees = append(fees, []string{date, event.Token.Symbol, amount, formatValue(event.Value), currency, event.Hash})
+		}
+	}
+
+	summary := report.Summary
+	return map[string][][]string{
+		"acquisitions.csv": acquisitions,
+		"disposals.csv":    disposals,
+		"income.csv":       income,
+		"fees.csv":         fees,
+		"summary.csv": {
+			{"Year", "Method", "Currency", "Proceeds", "Cost Basis", "Short-Term Gain", "Long-Term Gain", "Income", "Fees", "Missing Prices", "Excluded Disposals"},
+			{strconv.Itoa(report.Year), report.Method, currency, formatMoney(summary.Proceeds), formatMoney(summary.CostBasis), formatMoney(summary.ShortTermGain), formatMoney(summary.LongTermGain), formatMoney(summary.Income), formatMoney(summary.Fees), strconv.Itoa(summary.MissingPrices), strconv.Itoa(summary.ExcludedDisposals)},
+		},
+	}
+}
+
+// One row per transfer. The importing tool computes the gains itself, so disposals split by
+// holding period are merged back.
+func koinlyRows(report portfolio.TaxReport) [][]string {
+	currency := strings.ToUpper(report.Currency)
+	rows := [][]string{{"Date", "Sent Amount", "Sent Currency", "Received Amount", "Received Currency", "Fee Amount", "Fee Currency", "Net Worth Amount", "Net Worth Currency", "Label", "Description", "TxHash"}}
+	for _, event := range mergeDisposals(report.Events) {
+		row := make([]string, 12)
+		row[0] = event.Time.UTC().Format("2006-01-02 15:04 UTC")
+		amount := formatAmount(event.Amount)
+		switch event.Type {
+		case portfolio.TaxAcquisition, portfolio.TaxIncome:
+			row[3], row[4] = amount, event.Token.Symbol
+		case portfolio.TaxDisposal:
+			row[1], row[2] = amount, event.Token.Symbol
+		case portfolio.TaxFee:
+			row[1], row[2] = amount, event.Token.Symbol
+			row[9], row[10] = "cost", "Gas fee"
+		}
+		switch event.IncomeKind {
+		case portfolio.IncomeAirdrop:
+			row[9] = "airdrop"
+		case portfolio.IncomeStaking:
+			row[9], row[10] = "reward", "Beacon chain withdrawal"
+		}
+		if event.Value != nil {
+			row[7], row[8] = formatValue(event.Value), currency
+		}
+		row[11] = event.Hash
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func coinTrackingRows(report portfolio.TaxReport) [][]string {
+	rows := [][]string{{"Type", "Buy Amount", "Buy Currency", "Sell Amount", "Sell Currency", "Fee", "Fee Currency", "Exchange", "Trade-Group", "Comment", "Date", "Tx-ID"}}
+	for _, event := range mergeDisposals(report.Events) {
+		row := make([]string, 12)
+		amount := formatAmount(event.Amount)
+		switch event.Type {
+		case portfolio.TaxAcquisition:
+			row[0], row[1], row[2] = "Deposit", amount, event.Token.Symbol
+		case portfolio.TaxIncome:
+			row[0], row[1], row[2] = "Income", amount, event.Token.Symbol
+			if event.IncomeKind == portfolio.IncomeAirdrop {
+				row[0] = "Airdrop"
+			} else if event.IncomeKind == portfolio.IncomeStaking {
+				row[0] = "Staking"
+			}
+		case portfolio.TaxDisposal:
+			row[0], row[3], row[4] = "Withdrawal", amount, event.Token.Symbol
+		case portfolio.TaxFee:
+			row[0], row[3], row[4] = "Other Fee", amount, event.Token.Symbol
+			row[9] = "Gas fee"
+		}
+		row[7] = "Ethereum"
+		row[10] = event.Time.UTC().Format("2006-01-02 15:04:05")
+		row[11] = event.Hash
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Merge consecutive disposal events of the same transfer
+func mergeDisposals(events []portfolio.TaxEvent) []portfolio.TaxEvent {
+	var merged []portfolio.TaxEvent
+	for _, event := range events {
+		if last := len(merged) - 1; last >= 0 && event.Type == portfolio.TaxDisposal && merged[last].Type == portfolio.TaxDisposal &&
+			merged[last].Hash == event.Hash && merged[last].Token.Contract == event.Token.Contract && merged[last].Time.Equal(event.Time) {
+			merged[last].Amount += event.Amount
+			if merged[last].Value != nil && event.Value != nil {
+				value := *merged[last].Value + *event.Value
+				merged[last].Value = &value
+			}
+			continue
+		}
+		merged = append(merged, event)
+	}
+	return merged
+}
+
+func formatAmount(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func formatMoney(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
+
+// Empty when unknown
+func formatValue(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return formatMoney(*value)
+}
+
+func sortedNames(files map[string][][]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
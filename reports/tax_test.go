@@ -0,0 +1,98 @@
+package reports
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"ethereye/portfolio"
+	"testing"
+	"time"
+)
+
+/************
+common
+************/
+
+func sampleReport() portfolio.TaxReport {
+	value := func(v float64) *float64 { return &v }
+	at := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	acquired := time.Date(2022, 1, 10, 12, 0, 0, 0, time.UTC)
+	eth := portfolio.Ether
+	usdc := portfolio.Token{Contract: "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", Symbol: "USDC", Decimals: 6}
+	return portfolio.TaxReport{
+		Year: 2023, Currency: "usd", Method: portfolio.MethodFIFO,
+		Events: []portfolio.TaxEvent{
+			{Time: at, Type: portfolio.TaxFee, Token: eth, Amount: 0.000021, Value: value(0.063), Hash: "0xc"},
+			{Time: at, Type: portfolio.TaxDisposal, Token: eth, Amount: 0.5, Value: value(1500), CostBasis: value(1500), Gain: value(0), HoldingPeriod: portfolio.HoldingShortTerm, Hash: "0xc"},
+			{Time: at, Type: portfolio.TaxDisposal, Token: eth, Amount: 2, Value: value(6000), CostBasis: value(2000), Gain: value(4000), HoldingPeriod: portfolio.HoldingLongTerm, AcquiredAt: &acquired, Hash: "0xc"},
+			{Time: at.AddDate(0, 1, 0), Type: portfolio.TaxIncome, IncomeKind: portfolio.IncomeAirdrop, Token: usdc, Amount: 100, Value: value(100), Hash: "0xd"},
+		},
+		Summary: portfolio.TaxSummary{Proceeds: 7500, CostBasis: 3500, LongTermGain: 4000, Income: 100, Fees: 0.063},
+	}
+}
+
+// CSV files of the archive by name
+func readArchive(t *testing.T, data []byte) map[string][][]string {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Invalid archive: %v", err)
+	}
+	files := make(map[string][][]string)
+	for _, file := range archive.File {
+		reader, _ := file.Open()
+		rows, err := csv.NewReader(reader).ReadAll()
+		reader.Close()
+		if err != nil {
+			t.Fatalf("Invalid CSV %s: %v", file.Name, err)
+		}
+		files[file.Name] = rows
+	}
+	return files
+}
+
+/************
+test body
+************/
+
+func TestWriteTaxReport(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		// Rows of each file, including the header
+		rows map[string]int
+	}{
+		{"Test with generic layout", FormatGeneric, map[string]int{"acquisitions.csv": 1, "disposals.csv": 3, "income.csv": 2, "fees.csv": 2, "summary.csv": 2}},
+		{"Test with koinly layout", FormatKoinly, map[string]int{"koinly.csv": 4}},
+		{"Test with cointracking layout", FormatCoinTracking, map[string]int{"cointracking.csv": 4}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := WriteTaxReport(&buffer, sampleReport(), test.format); err != nil {
+				t.Fatalf("WriteTaxReport returned error: %v", err)
+			}
+			files := readArchive(t, buffer.Bytes())
+			if len(files) != len(test.rows) {
+				t.Fatalf("Expected %d files, got %d", len(test.rows), len(files))
+			}
+			for name, count := range test.rows {
+				if len(files[name]) != count {
+					t.Errorf("Expected %d rows in %s, got %d", count, name, len(files[name]))
+				}
+			}
+		})
+	}
+
+	t.Run("Test with merged disposals", func(t *testing.T) {
+		var buffer bytes.Buffer
+		WriteTaxReport(&buffer, sampleReport(), FormatKoinly)
+		rows := readArchive(t, buffer.Bytes())["koinly.csv"]
+		disposal := rows[2]
+		if disposal[0] != "2023-06-01 12:00 UTC" || disposal[1] != "2.5" || disposal[2] != "ETH" || disposal[7] != "7500.00" {
+			t.Errorf("Unexpected disposal row %v", disposal)
+		}
+		if rows[1][9] != "cost" || rows[3][9] != "airdrop" {
+			t.Errorf("Unexpected labels %v %v", rows[1], rows[3])
+		}
+	})
+}
@@ -0,0 +1,377 @@
+package transactions
+
+import (
+	"errors"
+	. "ethereye/utils"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+/******************
+Aggregation
+******************/
+
+const (
+	AggregateByDay          = "day"
+	AggregateByWeek         = "week"
+	AggregateByMonth        = "month"
+	AggregateByCounterparty = "counterparty"
+	AggregateByToken        = "token"
+	AggregateByMethod       = "method"
+)
+
+var AggregateByFields = []string{AggregateByDay, AggregateByWeek, AggregateByMonth, AggregateByCounterparty, AggregateByToken, AggregateByMethod}
+
+// Key of ETH in token groups and of transactions without a method in method groups
+const (
+	etherGroupKey = "eth"
+	noMethodKey   = "none"
+)
+
+// Totals of a group. Amounts are formatted in the group's token, ETH unless grouped by token;
+// fees are always in ETH and counted for transactions sent by the wallets, each in one group only.
+type TransactionGroup struct {
+	Key      string `json:"key"`
+	Label    string `json:"label,omitempty"`
+	Count    int    `json:"count"`
+	ValueIn  string `json:"valueIn"`
+	ValueOut string `json:"valueOut"`
+	NetFlow  string `json:"netFlow"`
+	Fees     string `json:"fees"`
+}
+
+// Groups of the filtered transactions. Total covers every transaction once, with the ETH they moved,
+// and the fees of the groups add up to its fees.
+type TransactionAggregation struct {
+	GroupBy string             `json:"groupBy"`
+	Sort    string             `json:"sort"`
+	Groups  []TransactionGroup `json:"groups"`
+	Total   TransactionGroup   `json:"total"`
+}
+
+// Sums of a group while aggregating
+type groupTotals struct {
+	key, label string
+	decimals   int
+	count      int
+	in, out    *big.Int
+	fees       *big.Int
+}
+
+func newGroupTotals(key, label string, decimals int) *groupTotals {
+	return &groupTotals{key: key, label: label, decimals: decimals, in: new(big.Int), out: new(big.Int), fees: new(big.Int)}
+}
+
+func (g *groupTotals) group() TransactionGroup {
+	return TransactionGroup{
+		Key:      g.key,
+		Label:    g.label,
+		Count:    g.count,
+		ValueIn:  FormatUnits(g.in, g.decimals),
+		ValueOut: FormatUnits(g.out, g.decimals),
+		NetFlow:  FormatUnits(new(big.Int).Sub(g.in, g.out), g.decimals),
+		Fees:     FormatUnits(g.fees, EtherDecimals),
+	}
+}
+
+// Amount of one token a transaction moved in or out of the wallets
+type groupFlow struct {
+	key, label string
+	decimals   int
+	amount     *big.Int
+}
+
+// Group the transactions and sum their flows relative to the wallets. Failed transactions count with
+// their fee but move no value. Transfers are the wallets' token transfers, only used to group by
+// token: a transaction moving several tokens counts in each of their groups, with its fee in the ETH
+// group if it moved ETH and in the group of its first token otherwise. Transfers made by transactions
+// of others, such as incoming tokens and airdrops, count in their token's group and in the total.
+func AggregateTransactions(transactions []Transaction, transfers []TokenTransfer, wallets []string, groupBy string) TransactionAggregation {
+	aggregation := TransactionAggregation{GroupBy: groupBy, Groups: []TransactionGroup{}}
+	var hashes []string
+	transfersByHash := make(map[string][]TokenTransfer)
+	for _, transfer := range transfers {
+		hash := strings.ToLower(transfer.Hash)
+		if _, ok := transfersByHash[hash]; !ok {
+			hashes = append(hashes, hash)
+		}
+		transfersByHash[hash] = append(transfersByHash[hash], transfer)
+	}
+
+	groups := make(map[string]*groupTotals)
+	add := func(flows []groupFlow, fee *big.Int) {
+		for i, flow := range flows {
+			g, ok := groups[flow.key]
+			if !ok {
+				g = newGroupTotals(flow.key, flow.label, flow.decimals)
+				groups[flow.key] = g
+			}
+			g.count++
+			if i == 0 {
+				g.fees.Add(g.fees, fee)
+			}
+			addFlow(g, flow.amount)
+		}
+	}
+
+	total := newGroupTotals("total", "", EtherDecimals)
+	for _, tx := range transactions {
+		fee := new(big.Int)
+		if containsAddress(wallets, tx.FromAddress) {
+			fee.Mul(ParseBigInt(tx.GasUsed), ParseBigInt(tx.GasPrice))
+		}
+		ether := etherFlow(tx, wallets)
+		total.count++
+		total.fees.Add(total.fees, fee)
+		addFlow(total, ether.amount)
+
+		if groupBy != AggregateByToken {
+			ether.key, ether.label = groupKey(tx, wallets, groupBy)
+			add([]groupFlow{ether}, fee)
+			continue
+		}
+		hash := strings.ToLower(tx.ID)
+		flows := tokenFlows(transfersByHash[hash], wallets)
+		delete(transfersByHash, hash)
+		if ether.amount.Sign() != 0 || len(flows) == 0 {
+			flows = append([]groupFlow{ether}, flows...)
+		}
+		add(flows, fee)
+	}
+
+	if groupBy == AggregateByToken {
+		for _, hash := range hashes {
+			flows := tokenFlows(transfersByHash[hash], wallets)
+			if len(flows) == 0 {
+				continue
+			}
+			total.count++
+			add(flows, new(big.Int))
+		}
+	}
+
+	for _, g := range groups {
+		aggregation.Groups = append(aggregation.Groups, g.group())
+	}
+	aggregation.Total = total.group()
+	return aggregation
+}
+
+func addFlow(g *groupTotals, amount *big.Int) {
+	if amount.Sign() > 0 {
+		g.in.Add(g.in, amount)
+	} else {
+		g.out.Sub(g.out, amount)
+	}
+}
+
+// ETH the transaction moved into (positive) or out of (negative) the wallets
+func etherFlow(tx Transaction, wallets []string) groupFlow {
+	flow := groupFlow{key: etherGroupKey, label: "ETH", decimals: EtherDecimals, amount: new(big.Int)}
+	if tx.Status == "0" {
+		return flow
+	}
+	from, to := containsAddress(wallets, tx.FromAddress), containsAddress(wallets, tx.ToAddress)
+	if to && !from {
+		flow.amount = ParseBigInt(tx.Value)
+	} else if from && !to {
+		flow.amount.Neg(ParseBigInt(tx.Value))
+	}
+	return flow
+}
+
+// Net amount of every token the transfers moved into or out of the wallets
+func tokenFlows(transfers []TokenTransfer, wallets []string) []groupFlow {
+	var flows []groupFlow
+	index := make(map[string]int)
+	for _, transfer := range transfers {
+		from, to := containsAddress(wallets, transfer.From), containsAddress(wallets, transfer.To)
+		if from == to {
+			continue
+		}
+		amount := ParseBigInt(transfer.Value)
+		if from {
+			amount.Neg(amount)
+		}
+		key := strings.ToLower(transfer.ContractAddr)
+		if i, ok := index[key]; ok {
+			flows[i].amount.Add(flows[i].amount, amount)
+			continue
+		}
+		index[key] = len(flows)
+		flows = append(flows, groupFlow{key: key, label: transfer.TokenSymbol, decimals: transfer.TokenDecimal, amount: amount})
+	}
+	return flows
+}
+
+// Group of the transaction other than by token
+func groupKey(tx Transaction, wallets []string, groupBy string) (string, string) {
+	at := tx.Timestamp.UTC()
+	switch groupBy {
+	case AggregateByDay:
+		return at.Format("2006-01-02"), ""
+	case AggregateByWeek:
+		year, week := at.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week), ""
+	case AggregateByMonth:
+		return at.Format("2006-01"), ""
+	case AggregateByCounterparty:
+		if containsAddress(wallets, tx.FromAddress) {
+			return strings.ToLower(tx.ToAddress), ""
+		}
+		return strings.ToLower(tx.FromAddress), ""
+	}
+	name := tx.Method
+	if paren := strings.IndexByte(name, '('); paren >= 0 {
+		name = name[:paren]
+	}
+	if name != "" {
+		return name, ""
+	}
+	if tx.MethodID != "" && tx.MethodID != "0x" {
+		return strings.ToLower(tx.MethodID), ""
+	}
+	return noMethodKey, "No method"
+}
+
+/******************
+Sorting
+******************/
+
+// Sort fields of transaction listings and of groups. A leading "-" sorts in descending order.
+var (
+	transactionSortFields = []string{"time", "block", "value", "fee", "gasPrice"}
+	groupSortFields       = []string{"key", "count", "valueIn", "valueOut", "netFlow", "fees"}
+)
+
+// Field and direction of a sort parameter, or an error naming the valid fields
+func parseSort(value string, fields []string) (string, bool, error) {
+	descending := strings.HasPrefix(value, "-")
+	field := strings.TrimPrefix(value, "-")
+	for _, candidate := range fields {
+		if candidate == field {
+			return field, descending, nil
+		}
+	}
+	return "", false, fmt.Errorf("invalid sort %q, expected one of %s, optionally prefixed with -", value, strings.Join(fields, ", "))
+}
+
+func sortTransactions(transactions []Transaction, field string, descending bool) {
+	key := func(tx Transaction) *big.Int {
+		switch field {
+		case "block":
+			return new(big.Int).SetUint64(tx.BlockHeight)
+		case "value":
+			return ParseBigInt(tx.Value)
+		case "fee":
+			return new(big.Int).Mul(ParseBigInt(tx.GasUsed), ParseBigInt(tx.GasPrice))
+		case "gasPrice":
+			return ParseBigInt(tx.GasPrice)
+		}
+		return big.NewInt(tx.Timestamp.UnixNano())
+	}
+	sort.SliceStable(transactions, func(i, j int) bool {
+		cmp := key(transactions[i]).Cmp(key(transactions[j]))
+		if descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
+
+func sortGroups(groups []TransactionGroup, field string, descending bool) {
+	amount := func(value string) *big.Rat {
+		rat, ok := new(big.Rat).SetString(value)
+		if !ok {
+			return new(big.Rat)
+		}
+		return rat
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		var cmp int
+		switch field {
+		case "count":
+			cmp = a.Count - b.Count
+		case "valueIn":
+			cmp = amount(a.ValueIn).Cmp(amount(b.ValueIn))
+		case "valueOut":
+			cmp = amount(a.ValueOut).Cmp(amount(b.ValueOut))
+		case "netFlow":
+			cmp = amount(a.NetFlow).Cmp(amount(b.NetFlow))
+		case "fees":
+			cmp = amount(a.Fees).Cmp(amount(b.Fees))
+		}
+		if cmp == 0 {
+			cmp = strings.Compare(a.Key, b.Key)
+			if field != "key" {
+				// Ties stay in key order whatever the direction
+				return cmp < 0
+			}
+		}
+		if descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
+
+var errUnknownGroupBy = errors.New("invalid group_by, expected " + strings.Join(AggregateByFields, ", "))
+
+func validGroupBy(groupBy string) bool {
+	for _, candidate := range AggregateByFields {
+		if candidate == groupBy {
+			return true
+		}
+	}
+	return false
+}
+
+// Transfers to aggregate with the filtered transactions: those in the date range, except the transfers
+// of wallet transactions the filters left out. Transfers of other addresses' transactions, such as
+// airdrops, are matched against the filters on their own. The wallets' transactions are listed before
+// and after filtering.
+func selectTransfers(transfers []TokenTransfer, startDate, endDate *time.Time, listed, kept []Transaction, wallets []string, match predicate) []TokenTransfer {
+	dropped := make(map[string]bool)
+	for _, tx := range listed {
+		dropped[strings.ToLower(tx.ID)] = true
+	}
+	ownKept := make(map[string]bool)
+	for _, tx := range kept {
+		delete(dropped, strings.ToLower(tx.ID))
+		ownKept[strings.ToLower(tx.ID)] = true
+	}
+	var selected []TokenTransfer
+	for _, transfer := range transfers {
+		hash := strings.ToLower(transfer.Hash)
+		if dropped[hash] {
+			continue
+		}
+		if (startDate != nil && transfer.Timestamp < startDate.Unix()) || (endDate != nil && transfer.Timestamp > endDate.Unix()) {
+			continue
+		}
+		if !ownKept[hash] && !match(transferTransaction(transfer), wallets) {
+			continue
+		}
+		selected = append(selected, transfer)
+	}
+	return selected
+}
+
+// Transfer seen as a transaction from its sender to its recipient, so the filters can apply to it.
+// It moves no ETH, and Etherscan only lists transfers of successful transactions.
+func transferTransaction(transfer TokenTransfer) Transaction {
+	return Transaction{
+		ID:          transfer.Hash,
+		FromAddress: transfer.From,
+		ToAddress:   transfer.To,
+		Value:       "0",
+		BlockHeight: uint64(transfer.BlockNumber),
+		Status:      "1",
+		Timestamp:   time.Unix(transfer.Timestamp, 0).UTC(),
+		Flags:       transfer.Flags,
+	}
+}
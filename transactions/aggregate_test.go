@@ -0,0 +1,133 @@
+package transactions
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAggregateTransactions(t *testing.T) {
+	usdc := "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"
+	transactions := []Transaction{
+		{ID: "0xa", FromAddress: filterOther, ToAddress: filterWallet, Value: "2000000000000000000", GasUsed: "21000", GasPrice: "10000000000", Status: "1", Timestamp: time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)},
+		{ID: "0xb", FromAddress: filterWallet, ToAddress: usdc, Value: "0", GasUsed: "50000", GasPrice: "10000000000", MethodID: "0xa9059cbb", Method: "transfer(address to, uint256 amount)", Status: "1", Timestamp: time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)},
+		{ID: "0xc", FromAddress: filterWallet, ToAddress: filterOther, Value: "500000000000000000", GasUsed: "21000", GasPrice: "10000000000", Status: "1", Timestamp: time.Date(2024, 2, 5, 8, 0, 0, 0, time.UTC)},
+		// Failed: only the fee counts
+		{ID: "0xd", FromAddress: filterWallet, ToAddress: filterOther, Value: "1000000000000000000", GasUsed: "21000", GasPrice: "10000000000", Status: "0", Timestamp: time.Date(2024, 2, 6, 8, 0, 0, 0, time.UTC)},
+	}
+	transfers := []TokenTransfer{
+		{Hash: "0xb", From: filterWallet, To: filterOther, Value: "25000000", ContractAddr: usdc, TokenSymbol: "USDC", TokenDecimal: 6},
+	}
+	wallets := []string{filterWallet}
+
+	t.Run("Test with month", func(t *testing.T) {
+		aggregation := AggregateTransactions(transactions, nil, wallets, AggregateByMonth)
+		sortGroups(aggregation.Groups, "key", false)
+		if len(aggregation.Groups) != 2 {
+			t.Fatalf("Expected 2 groups, got %+v", aggregation.Groups)
+		}
+		january, february := aggregation.Groups[0], aggregation.Groups[1]
+		if january.Key != "2024-01" || january.Count != 2 || january.ValueIn != "2" || january.NetFlow != "2" || january.Fees != "0.0005" {
+			t.Errorf("Unexpected January group %+v", january)
+		}
+		if february.Key != "2024-02" || february.ValueOut != "0.5" || february.NetFlow != "-0.5" || february.Fees != "0.00042" {
+			t.Errorf("Unexpected February group %+v", february)
+		}
+		if aggregation.Total.Count != 4 || aggregation.Total.NetFlow != "1.5" || aggregation.Total.Fees != "0.00092" {
+			t.Errorf("Unexpected total %+v", aggregation.Total)
+		}
+	})
+
+	t.Run("Test with token", func(t *testing.T) {
+		// Received in a transaction of another address
+		airdrop := TokenTransfer{Hash: "0xe", From: filterOther, To: filterWallet, Value: "10000000", ContractAddr: usdc, TokenSymbol: "USDC", TokenDecimal: 6}
+		aggregation := AggregateTransactions(transactions, append(transfers, airdrop), wallets, AggregateByToken)
+		sortGroups(aggregation.Groups, "key", false)
+		if len(aggregation.Groups) != 2 || aggregation.Groups[1].Key != etherGroupKey || aggregation.Groups[1].Count != 3 {
+			t.Fatalf("Unexpected groups %+v", aggregation.Groups)
+		}
+		token, ether := aggregation.Groups[0], aggregation.Groups[1]
+		if token.Key != usdc || token.Label != "USDC" || token.Count != 2 || token.ValueIn != "10" || token.ValueOut != "25" || token.Fees != "0.0005" {
+			t.Errorf("Unexpected token group %+v", token)
+		}
+		// Every fee is in one group only
+		if ether.Fees != "0.00042" || aggregation.Total.Count != 5 || aggregation.Total.Fees != "0.00092" {
+			t.Errorf("Unexpected ETH group %+v or total %+v", ether, aggregation.Total)
+		}
+	})
+
+	t.Run("Test with filtered transfers", func(t *testing.T) {
+		start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+		all := []TokenTransfer{
+			{Hash: "0xb", Timestamp: transactions[1].Timestamp.Unix()},
+			{Hash: "0xe", Timestamp: time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC).Unix()},
+			{Hash: "0xf", Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Unix()},
+		}
+		selected := selectTransfers(all, &start, nil, transactions, transactions[2:], wallets, allOf(nil))
+		if len(selected) != 1 || selected[0].Hash != "0xe" {
+			t.Errorf("Expected only the transfer of another address in range, got %+v", selected)
+		}
+
+		// Transfers of other addresses' transactions are filtered too
+		all[1].From, all[1].To = filterOther, filterWallet
+		match, err := compileFilters(nil, "direction:out")
+		if err != nil {
+			t.Fatalf("compileFilters returned error: %v", err)
+		}
+		if selected := selectTransfers(all, &start, nil, transactions, transactions[2:], wallets, match); len(selected) != 0 {
+			t.Errorf("Expected the incoming transfer to be filtered out, got %+v", selected)
+		}
+	})
+
+	t.Run("Test with method and counterparty", func(t *testing.T) {
+		methods := AggregateTransactions(transactions, nil, wallets, AggregateByMethod)
+		sortGroups(methods.Groups, "key", false)
+		if len(methods.Groups) != 2 || methods.Groups[0].Key != noMethodKey || methods.Groups[1].Key != "transfer" {
+			t.Errorf("Unexpected method groups %+v", methods.Groups)
+		}
+		counterparties := AggregateTransactions(transactions, nil, wallets, AggregateByCounterparty)
+		sortGroups(counterparties.Groups, "netFlow", true)
+		if counterparties.Groups[0].Key != filterOther || counterparties.Groups[0].Count != 3 || counterparties.Groups[0].NetFlow != "1.5" {
+			t.Errorf("Unexpected counterparty groups %+v", counterparties.Groups)
+		}
+	})
+}
+
+func TestSortTransactions(t *testing.T) {
+	transactions := append([]Transaction(nil), filterTransactionsFixture...)
+	sortTransactions(transactions, "value", true)
+	if transactions[0].ID != "0xa" || transactions[1].ID != "0xc" {
+		t.Errorf("Unexpected order %s, %s", transactions[0].ID, transactions[1].ID)
+	}
+	sortTransactions(transactions, "gasPrice", false)
+	if transactions[0].ID != "0xa" || transactions[3].ID != "0xc" {
+		t.Errorf("Unexpected order %s, %s", transactions[0].ID, transactions[3].ID)
+	}
+}
+
+func TestFilteredTransactionsHandlerAggregationOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		body  map[string]interface{}
+	}{
+		{"Test with unknown group_by", "", map[string]interface{}{"group_by": "year"}},
+		{"Test with unknown sort", "", map[string]interface{}{"sort": "-nonce"}},
+		{"Test with group sort on listing", "", map[string]interface{}{"sort": "netFlow"}},
+		{"Test with aggregation as CSV", "?format=csv", map[string]interface{}{"group_by": "month"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.body["wallet_address"] = filterWallet
+			body, _ := json.Marshal(test.body)
+			rr := httptest.NewRecorder()
+			FilteredTransactionsHandler("").ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/filtered-transactions"+test.query, bytes.NewReader(body)))
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
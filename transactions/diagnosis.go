@@ -0,0 +1,90 @@
+package transactions
+
+import (
+	"ethereye/abi"
+	"ethereye/node"
+	"log"
+)
+
+/******************
+Failure Diagnosis
+******************/
+
+// Why a mined transaction failed
+type FailureDiagnosis struct {
+	Revert     *abi.Revert `json:"revert,omitempty"`
+	Reason     string      `json:"reason"`
+	OutOfGas   bool        `json:"outOfGas"`
+	GasUsed    uint64      `json:"gasUsed"`
+	GasLimit   uint64      `json:"gasLimit"`
+	RevertData string      `json:"revertData,omitempty"`
+}
+
+// Diagnose a failed transaction by replaying it at its parent block. Nil if the transaction did not fail.
+// When the node cannot replay it, e.g. without the historical state, the diagnosis only comes from the receipt.
+func DiagnoseFailure(client *node.Client, txID string) (*FailureDiagnosis, error) {
+	tx, err := client.TransactionByHash(txID)
+	if err != nil || tx == nil || tx.BlockNumber == nil {
+		return nil, err
+	}
+	receipt, err := client.TransactionReceipt(txID)
+	if err != nil || receipt == nil || node.ParseUint(receipt.Status) == 1 {
+		return nil, err
+	}
+
+	diagnosis := &FailureDiagnosis{
+		GasUsed:  node.ParseUint(receipt.GasUsed),
+		GasLimit: node.ParseUint(tx.Gas),
+	}
+	diagnosis.OutOfGas = diagnosis.GasLimit > 0 && diagnosis.GasUsed == diagnosis.GasLimit
+
+	revertData, err := replayTransaction(client, tx)
+	if err != nil {
+		// The receipt still tells whether the transaction ran out of gas
+		log.Printf("Failed to replay transaction %s: %v", txID, err)
+	}
+	if len(revertData) > 0 {
+		revert := abi.DecodeRevert(revertData)
+		diagnosis.Revert = &revert
+		diagnosis.RevertData = node.EncodeBytes(revertData)
+	}
+
+	switch {
+	case diagnosis.Revert != nil:
+		diagnosis.Reason = diagnosis.Revert.String()
+	case diagnosis.OutOfGas:
+		diagnosis.Reason = "out of gas"
+	case err != nil:
+		diagnosis.Reason = "unknown (state unavailable)"
+	default:
+		diagnosis.Reason = "reverted without data"
+	}
+	return diagnosis, nil
+}
+
+// Re-execute a mined transaction with eth_call on the state of its parent block and return the revert data
+func replayTransaction(client *node.Client, tx *node.Transaction) ([]byte, error) {
+	blockNumber := node.ParseUint(*tx.BlockNumber)
+	parent := "latest"
+	if blockNumber > 0 {
+		parent = node.EncodeUint(blockNumber - 1)
+	}
+	input, err := node.DecodeBytes(tx.Input)
+	if err != nil {
+		return nil, err
+	}
+	msg := node.CallMsg{
+		From:  tx.From,
+		To:    tx.To,
+		Value: node.ParseBig(tx.Value),
+		Data:  input,
+		Gas:   node.ParseUint(tx.Gas),
+	}
+
+	_, err = client.CallContract(msg, parent)
+	// Other node errors, e.g. "missing trie node" on a non-archive node, say nothing about the transaction
+	if rpcErr, ok := err.(*node.RPCError); ok && rpcErr.ExecutionFailed() {
+		return rpcErr.RevertData(), nil
+	}
+	return nil, err
+}
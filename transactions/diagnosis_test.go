@@ -0,0 +1,121 @@
+package transactions
+
+import (
+	"encoding/json"
+	"ethereye/abi"
+	"ethereye/internal/testutil"
+	"ethereye/node"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestDiagnoseFailure(t *testing.T) {
+	tx := map[string]interface{}{"hash": "0x1", "from": "0xabc", "to": "0xdef", "gas": "0x5208", "input": "0x", "blockNumber": "0x64"}
+
+	t.Run("Test with a panic", func(t *testing.T) {
+		var replayedAt string
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+			"eth_getTransactionByHash":  testutil.Result(tx),
+			"eth_getTransactionReceipt": testutil.Result(map[string]string{"status": "0x0", "gasUsed": "0x5000"}),
+			"eth_call": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+				json.Unmarshal(params[1], &replayedAt)
+				return nil, &node.RPCError{Code: 3, Message: "execution reverted", Data: "0x4e487b710000000000000000000000000000000000000000000000000000000000000012"}
+			},
+		})
+
+		diagnosis, err := DiagnoseFailure(client, "0x1")
+		if err != nil {
+			t.Fatalf("DiagnoseFailure() returned an error: %v", err)
+		}
+		if replayedAt != "0x63" {
+			t.Errorf("Expected the replay at the parent block 0x63, got %s", replayedAt)
+		}
+		if diagnosis.Revert == nil || diagnosis.Revert.Kind != abi.RevertPanic || diagnosis.OutOfGas {
+			t.Errorf("Unexpected diagnosis: %+v", diagnosis)
+		}
+	})
+
+	t.Run("Test with an out of gas failure", func(t *testing.T) {
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+			"eth_getTransactionByHash":  testutil.Result(tx),
+			"eth_getTransactionReceipt": testutil.Result(map[string]string{"status": "0x0", "gasUsed": "0x5208"}),
+			"eth_call": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+				return nil, &node.RPCError{Code: -32000, Message: "out of gas"}
+			},
+		})
+
+		diagnosis, err := DiagnoseFailure(client, "0x1")
+		if err != nil || !diagnosis.OutOfGas || diagnosis.Reason != "out of gas" {
+			t.Errorf("Expected an out of gas diagnosis, got %+v (%v)", diagnosis, err)
+		}
+	})
+
+	t.Run("Test with a node missing the state", func(t *testing.T) {
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+			"eth_getTransactionByHash":  testutil.Result(tx),
+			"eth_getTransactionReceipt": testutil.Result(map[string]string{"status": "0x0", "gasUsed": "0x5208"}),
+			"eth_call": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+				return nil, &node.RPCError{Code: -32000, Message: "missing trie node 1f2e (path ) state 0x1 is not available"}
+			},
+		})
+
+		// The receipt shows the gas ran out, whatever the replay would have said
+		diagnosis, err := DiagnoseFailure(client, "0x1")
+		if err != nil || diagnosis == nil || !diagnosis.OutOfGas || diagnosis.Reason != "out of gas" || diagnosis.GasUsed != 21000 {
+			t.Errorf("Expected a diagnosis from the receipt, got %+v (%v)", diagnosis, err)
+		}
+	})
+
+	t.Run("Test with a node missing the state of a revert", func(t *testing.T) {
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+			"eth_getTransactionByHash":  testutil.Result(tx),
+			"eth_getTransactionReceipt": testutil.Result(map[string]string{"status": "0x0", "gasUsed": "0x5000"}),
+			"eth_call": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+				return nil, &node.RPCError{Code: -32000, Message: "missing trie node 1f2e (path ) state 0x1 is not available"}
+			},
+		})
+
+		diagnosis, err := DiagnoseFailure(client, "0x1")
+		if err != nil || diagnosis == nil || diagnosis.OutOfGas || diagnosis.Reason != "unknown (state unavailable)" {
+			t.Errorf("Expected an unknown reason, got %+v (%v)", diagnosis, err)
+		}
+	})
+
+	t.Run("Test with a successful transaction", func(t *testing.T) {
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+			"eth_getTransactionByHash":  testutil.Result(tx),
+			"eth_getTransactionReceipt": testutil.Result(map[string]string{"status": "0x1"}),
+		})
+
+		diagnosis, err := DiagnoseFailure(client, "0x1")
+		if err != nil || diagnosis != nil {
+			t.Errorf("Expected no diagnosis, got %+v (%v)", diagnosis, err)
+		}
+	})
+}
+
+func TestTransactionDetailsHandlerDiagnosisError(t *testing.T) {
+	testutil.UseFakeEtherscan(t, func(query url.Values) interface{} {
+		return map[string]interface{}{"result": map[string]string{
+			"from": "0x1", "to": "0x2", "value": "0x0", "gas": "0x5208", "gasPrice": "0x1", "input": "0x",
+		}}
+	})
+	client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+		"eth_getTransactionByHash": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+			return nil, &node.RPCError{Code: -32000, Message: "header not found"}
+		},
+	})
+
+	rr := httptest.NewRecorder()
+	TransactionDetailsHandler("", client).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/transaction-details?txid=0x1", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	var details TransactionDetails
+	json.NewDecoder(rr.Body).Decode(&details)
+	if details.From != "0x1" || details.Diagnosis != nil {
+		t.Errorf("Unexpected details %+v", details)
+	}
+}
@@ -0,0 +1,117 @@
+package transactions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/******************
+Status Events
+******************/
+
+const EventTypeReorg = "reorg"
+
+// Change in the status of one or more transactions
+type StatusEvent struct {
+	Type  string      `json:"type"`
+	TxIDs []string    `json:"txids"`
+	Reorg *ReorgEvent `json:"reorg,omitempty"`
+	Time  time.Time   `json:"time"`
+}
+
+// Fans status events out to subscribers
+type StatusBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan StatusEvent]struct{}
+}
+
+// Broker used by the indexer and the status event stream
+var StatusEvents = NewStatusBroker()
+
+func NewStatusBroker() *StatusBroker {
+	return &StatusBroker{subscribers: make(map[chan StatusEvent]struct{})}
+}
+
+// Register a subscriber. The returned function unsubscribes and closes the channel.
+func (b *StatusBroker) Subscribe() (<-chan StatusEvent, func()) {
+	ch := make(chan StatusEvent, 16)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Deliver the event to every subscriber, dropping it for subscribers that are not keeping up
+func (b *StatusBroker) Publish(event StatusEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (e StatusEvent) concerns(txID string) bool {
+	for _, id := range e.TxIDs {
+		if id == txID {
+			return true
+		}
+	}
+	return false
+}
+
+// GET /api/v1/transaction-status/events?txid={optional}
+// Streams status events as server-sent events
+func TransactionStatusEventsHandler(broker *StatusBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		txID := r.URL.Query().Get("txid")
+
+		events, unsubscribe := broker.Subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if txID != "" && !event.concerns(txID) {
+					continue
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package transactions
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"ethereye/labels"
+	. "ethereye/utils"
+	"fmt"
+	"log"
+	"math/big"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/******************
+Transaction Export
+******************/
+
+const (
+	ExportJSON   = "json"
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+	ExportXLSX   = "xlsx"
+)
+
+var exportContentTypes = map[string]string{
+	ExportJSON:   "application/json",
+	ExportCSV:    "text/csv",
+	ExportNDJSON: "application/x-ndjson",
+	ExportXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// Media types accepted in the Accept header besides the content types above
+var exportMediaTypes = map[string]string{
+	"application/ndjson": ExportNDJSON,
+	"application/jsonl":  ExportNDJSON,
+}
+
+// Rows are flushed to the client in batches of this size
+const exportFlushRows = 500
+
+// Column of an export. Numeric columns are stored as numbers in workbooks.
+type exportColumn struct {
+	header  string
+	numeric bool
+	value   func(tx Transaction) string
+}
+
+var exportColumns = map[string]exportColumn{
+	"hash":      {"Transaction Hash", false, func(tx Transaction) string { return tx.ID }},
+	"time":      {"Date", false, func(tx Transaction) string { return tx.Timestamp.UTC().Format(time.RFC3339) }},
+	"block":     {"Block", true, func(tx Transaction) string { return strconv.FormatUint(tx.BlockHeight, 10) }},
+	"blockHash": {"Block Hash", false, func(tx Transaction) string { return tx.BlockHash }},
+	"from":      {"From", false, func(tx Transaction) string { return tx.FromAddress }},
+	"to":        {"To", false, func(tx Transaction) string { return tx.ToAddress }},
+	"value":     {"Value (ETH)", true, func(tx Transaction) string { return FormatUnits(ParseBigInt(tx.Value), EtherDecimals) }},
+	"valueWei":  {"Value (wei)", false, func(tx Transaction) string { return ParseBigInt(tx.Value).String() }},
+	"gasPrice":  {"Gas Price (gwei)", true, func(tx Transaction) string { return FormatUnits(ParseBigInt(tx.GasPrice), 9) }},
+	"gasUsed":   {"Gas Used", true, func(tx Transaction) string { return ParseBigInt(tx.GasUsed).String() }},
+	"fee": {"Fee (ETH)", true, func(tx Transaction) string {
+		return FormatUnits(new(big.Int).Mul(ParseBigInt(tx.GasUsed), ParseBigInt(tx.GasPrice)), EtherDecimals)
+	}},
+	"nonce":     {"Nonce", true, func(tx Transaction) string { return strconv.FormatUint(tx.Nonce, 10) }},
+	"method":    {"Method", false, func(tx Transaction) string { return tx.Method }},
+	"methodId":  {"Method ID", false, func(tx Transaction) string { return tx.MethodID }},
+	"tokenType": {"Token Type", false, func(tx Transaction) string { return tx.TokenType }},
+	"status":    {"Status", false, func(tx Transaction) string { return exportStatus(tx.Status) }},
+	"fromLabel": {"From Label", false, func(tx Transaction) string { return labelName(tx.FromLabel) }},
+	"toLabel":   {"To Label", false, func(tx Transaction) string { return labelName(tx.ToLabel) }},
+	"flags":     {"Risk Flags", false, exportFlags},
+}
+
+// Columns exported unless the 'columns' parameter is given
+var DefaultExportColumns = []string{"time", "hash", "from", "to", "value", "fee", "method", "status"}
+
+// Export format and columns of the request. The 'format' query parameter takes precedence over the
+// Accept header; JSON is the default. Columns are given as a comma separated 'columns' parameter.
+func ExportOptions(r *http.Request) (string, []string, error) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = acceptedFormat(r.Header.Get("Accept"))
+	}
+	if _, ok := exportContentTypes[format]; !ok {
+		return "", nil, fmt.Errorf("invalid format %q, expected json, csv, ndjson or xlsx", format)
+	}
+
+	columns := DefaultExportColumns
+	if value := r.URL.Query().Get("columns"); value != "" {
+		columns = nil
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := exportColumns[name]; !ok {
+				return "", nil, fmt.Errorf("unknown column %q, expected one of %s", name, strings.Join(ExportColumnNames(), ", "))
+			}
+			columns = append(columns, name)
+		}
+	}
+	return format, columns, nil
+}
+
+// Names of the columns that can be exported
+func ExportColumnNames() []string {
+	return []string{"hash", "time", "block", "blockHash", "from", "to", "value", "valueWei", "gasPrice", "gasUsed", "fee", "nonce", "method", "methodId", "tokenType", "status", "fromLabel", "toLabel", "flags"}
+}
+
+// First supported format of the Accept header, in the order given
+func acceptedFormat(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		for format, contentType := range exportContentTypes {
+			if mediaType == contentType {
+				return format
+			}
+		}
+		if format, ok := exportMediaTypes[mediaType]; ok {
+			return format
+		}
+	}
+	return ExportJSON
+}
+
+func labelName(label *labels.Label) string {
+	if label == nil {
+		return ""
+	}
+	return label.Name
+}
+
+// Kinds of the risk flags, separated by semicolons
+func exportFlags(tx Transaction) string {
+	kinds := make([]string, len(tx.Flags))
+	for i, flag := range tx.Flags {
+		kinds[i] = flag.Kind
+	}
+	return strings.Join(kinds, ";")
+}
+
+func exportStatus(status string) string {
+	switch status {
+	case "1":
+		return "success"
+	case "0":
+		return "failed"
+	}
+	return status
+}
+
+// Write the transactions in the format. JSON keeps the full transaction objects; the other formats
+// hold the selected columns with amounts in ETH and gwei, and are streamed as they are written.
+func WriteTransactions(w http.ResponseWriter, transactions []Transaction, format string, columns []string) {
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	if format == ExportJSON {
+		json.NewEncoder(w).Encode(transactions)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"transactions.%s\"", format))
+
+	selected := make([]exportColumn, len(columns))
+	header := make([]string, len(columns))
+	numeric := make([]bool, len(columns))
+	for i, name := range columns {
+		selected[i] = exportColumns[name]
+		header[i] = selected[i].header
+		numeric[i] = selected[i].numeric
+	}
+	row := func(tx Transaction) []string {
+		cells := make([]string, len(selected))
+		for i, column := range selected {
+			cells[i] = column.value(tx)
+		}
+		return cells
+	}
+	flush := func() {
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+
+	var err error
+	switch format {
+	case ExportCSV:
+		writer := csv.NewWriter(w)
+		writer.Write(header)
+		for i, tx := range transactions {
+			if err = writer.Write(row(tx)); err != nil {
+				break
+			}
+			if (i+1)%exportFlushRows == 0 {
+				writer.Flush()
+				flush()
+			}
+		}
+		writer.Flush()
+		if err == nil {
+			err = writer.Error()
+		}
+
+	case ExportNDJSON:
+		encoder := json.NewEncoder(w)
+		for i, tx := range transactions {
+			object := make(map[string]string, len(columns))
+			for j, cell := range row(tx) {
+				object[columns[j]] = cell
+			}
+			if err = encoder.Encode(object); err != nil {
+				break
+			}
+			if (i+1)%exportFlushRows == 0 {
+				flush()
+			}
+		}
+
+	case ExportXLSX:
+		var workbook *XLSXWriter
+		if workbook, err = NewXLSXWriter(w, "Transactions"); err != nil {
+			break
+		}
+		workbook.WriteRow(header, nil)
+		for _, tx := range transactions {
+			if err = workbook.WriteRow(row(tx), numeric); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = workbook.Close()
+		}
+	}
+	// The status is already sent, so a failure can only be logged
+	if err != nil {
+		log.Printf("Failed to export transactions: %v", err)
+	}
+}
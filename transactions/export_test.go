@@ -0,0 +1,111 @@
+package transactions
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		accept  string
+		format  string
+		columns int
+		err     bool
+	}{
+		{"Test with defaults", "", "", ExportJSON, len(DefaultExportColumns), false},
+		{"Test with Accept header", "", "text/html, text/csv;q=0.9", ExportCSV, len(DefaultExportColumns), false},
+		{"Test with ndjson media type", "", "application/ndjson", ExportNDJSON, len(DefaultExportColumns), false},
+		{"Test with format over Accept header", "?format=XLSX", "text/csv", ExportXLSX, len(DefaultExportColumns), false},
+		{"Test with columns", "?format=csv&columns=hash,value", "", ExportCSV, 2, false},
+		{"Test with unknown format", "?format=pdf", "", "", 0, true},
+		{"Test with unknown column", "?columns=hash,amount", "", "", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/transactions"+test.query, nil)
+			r.Header.Set("Accept", test.accept)
+			format, columns, err := ExportOptions(r)
+			if (err != nil) != test.err {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if format != test.format || len(columns) != test.columns {
+				t.Errorf("Expected %s with %d columns, got %s with %v", test.format, test.columns, format, columns)
+			}
+		})
+	}
+}
+
+func TestWriteTransactions(t *testing.T) {
+	transactions := []Transaction{
+		{ID: "0xa", FromAddress: "0x1", ToAddress: "0x2", Value: "1500000000000000000", GasPrice: "20000000000", GasUsed: "21000", Method: "transfer(address to, uint256 amount)", Status: "1", Timestamp: time.Unix(1700000000, 0)},
+		{ID: "0xb", FromAddress: "0x2", ToAddress: "0x1", Value: "0", GasPrice: "1000000000", GasUsed: "50000", Status: "0", Timestamp: time.Unix(1700000100, 0)},
+	}
+	columns := []string{"hash", "value", "gasPrice", "fee", "method", "status"}
+	write := func(format string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		WriteTransactions(rr, transactions, format, columns)
+		return rr
+	}
+
+	t.Run("Test with CSV", func(t *testing.T) {
+		rr := write(ExportCSV)
+		rows, err := csv.NewReader(rr.Body).ReadAll()
+		if err != nil || len(rows) != 3 {
+			t.Fatalf("Expected a header and 2 rows, got %v %v", rows, err)
+		}
+		expected := []string{"0xa", "1.5", "20", "0.00042", "transfer(address to, uint256 amount)", "success"}
+		for i, cell := range rows[1] {
+			if cell != expected[i] {
+				t.Errorf("Expected %q in column %d, got %q", expected[i], i, cell)
+			}
+		}
+		if rr.Header().Get("Content-Type") != "text/csv" || !strings.Contains(rr.Header().Get("Content-Disposition"), "transactions.csv") {
+			t.Errorf("Unexpected headers %v", rr.Header())
+		}
+	})
+
+	t.Run("Test with NDJSON", func(t *testing.T) {
+		scanner := bufio.NewScanner(write(ExportNDJSON).Body)
+		var lines []map[string]string
+		for scanner.Scan() {
+			var line map[string]string
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Fatalf("Invalid line %s: %v", scanner.Text(), err)
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) != 2 || lines[1]["status"] != "failed" || lines[1]["fee"] != "0.00005" {
+			t.Errorf("Unexpected lines %v", lines)
+		}
+	})
+
+	t.Run("Test with XLSX", func(t *testing.T) {
+		data := write(ExportXLSX).Body.Bytes()
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("Invalid workbook: %v", err)
+		}
+		var sheet string
+		for _, file := range archive.File {
+			if file.Name == "xl/worksheets/sheet1.xml" {
+				reader, _ := file.Open()
+				content, _ := ioutil.ReadAll(reader)
+				sheet = string(content)
+			}
+		}
+		if !strings.Contains(sheet, `<c r="B2"><v>1.5</v></c>`) || !strings.Contains(sheet, `<t xml:space="preserve">Transaction Hash</t>`) || strings.Count(sheet, "<row") != 3 {
+			t.Errorf("Unexpected sheet %s", sheet)
+		}
+	})
+}
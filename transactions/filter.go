@@ -0,0 +1,620 @@
+package transactions
+
+import (
+	"encoding/json"
+	. "ethereye/utils"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+/******************
+Transaction Filters
+******************/
+
+// Filter tree. A node is either a composition (and, or, not) or a condition on a field, e.g.
+//
+//	{"and": [{"field": "direction", "op": "eq", "value": "out"}, {"field": "value", "op": "gte", "value": 1.5}]}
+type Filter struct {
+	And   []Filter    `json:"and,omitempty"`
+	Or    []Filter    `json:"or,omitempty"`
+	Not   *Filter     `json:"not,omitempty"`
+	Field string      `json:"field,omitempty"`
+	Op    string      `json:"op,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Invalid filter. Path locates the node in the filter tree; Position is the 1-based character of a
+// query, or zero for filter trees.
+type FilterError struct {
+	Path     string
+	Position int
+	Message  string
+}
+
+func (e *FilterError) Error() string {
+	if e.Position > 0 {
+		return fmt.Sprintf("%s at position %d: %s", e.Path, e.Position, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Whether the transaction matches, given the addresses of the wallets it was fetched for
+type predicate func(tx Transaction, wallets []string) bool
+
+const (
+	opEq       = "eq"
+	opNe       = "ne"
+	opGt       = "gt"
+	opGte      = "gte"
+	opLt       = "lt"
+	opLte      = "lte"
+	opContains = "contains"
+)
+
+var (
+	equalityOps   = []string{opEq, opNe}
+	textOps       = []string{opEq, opNe, opContains}
+	comparisonOps = []string{opEq, opNe, opGt, opGte, opLt, opLte}
+)
+
+// Operators of the query syntax, longest first
+var queryOps = []struct{ symbol, op string }{
+	{"!=", opNe}, {">=", opGte}, {"<=", opLte}, {":", opEq}, {"=", opEq}, {">", opGt}, {"<", opLt}, {"~", opContains},
+}
+
+type filterField struct {
+	ops     []string
+	compile func(op, value string) (predicate, error)
+}
+
+var filterFields = map[string]filterField{
+	"direction": {equalityOps, compileDirection},
+	"counterparty": {equalityOps, addressCondition(func(tx Transaction, wallets []string) string {
+		if containsAddress(wallets, tx.FromAddress) {
+			return tx.ToAddress
+		}
+		return tx.FromAddress
+	})},
+	"from":      {equalityOps, addressCondition(func(tx Transaction, wallets []string) string { return tx.FromAddress })},
+	"to":        {equalityOps, addressCondition(func(tx Transaction, wallets []string) string { return tx.ToAddress })},
+	"contract":  {equalityOps, compileContract},
+	"value":     {comparisonOps, unitsCondition(EtherDecimals, func(tx Transaction) string { return tx.Value })},
+	"gasPrice":  {comparisonOps, unitsCondition(9, func(tx Transaction) string { return tx.GasPrice })},
+	"block":     {comparisonOps, compileBlock},
+	"time":      {comparisonOps, compileTime},
+	"status":    {equalityOps, compileStatus},
+	"method":    {textOps, compileMethod},
+	"tokenType": {equalityOps, compileTokenType},
+	"flag":      {equalityOps, compileFlag},
+}
+
+// Compile the filter tree and the query into a single predicate; either may be empty
+func compileFilters(tree *Filter, query string) (predicate, error) {
+	var predicates []predicate
+	if tree != nil {
+		match, err := tree.compile("filter")
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, match)
+	}
+	if strings.TrimSpace(query) != "" {
+		match, err := parseQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, match)
+	}
+	return allOf(predicates), nil
+}
+
+func applyFilter(transactions []Transaction, wallets []string, match predicate) []Transaction {
+	filtered := make([]Transaction, 0, len(transactions))
+	for _, tx := range transactions {
+		if match(tx, wallets) {
+			filtered = append(filtered, tx)
+		}
+	}
+	return filtered
+}
+
+func (f Filter) compile(path string) (predicate, error) {
+	kinds := 0
+	for _, set := range []bool{f.And != nil, f.Or != nil, f.Not != nil, f.Field != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return nil, &FilterError{Path: path, Message: "expected exactly one of and, or, not or field"}
+	}
+
+	compileAll := func(name string, filters []Filter) ([]predicate, error) {
+		if len(filters) == 0 {
+			return nil, &FilterError{Path: path + "." + name, Message: "expected at least one filter"}
+		}
+		predicates := make([]predicate, len(filters))
+		for i, filter := range filters {
+			match, err := filter.compile(fmt.Sprintf("%s.%s[%d]", path, name, i))
+			if err != nil {
+				return nil, err
+			}
+			predicates[i] = match
+		}
+		return predicates, nil
+	}
+
+	switch {
+	case f.And != nil:
+		predicates, err := compileAll("and", f.And)
+		if err != nil {
+			return nil, err
+		}
+		return allOf(predicates), nil
+	case f.Or != nil:
+		predicates, err := compileAll("or", f.Or)
+		if err != nil {
+			return nil, err
+		}
+		return anyOf(predicates), nil
+	case f.Not != nil:
+		match, err := f.Not.compile(path + ".not")
+		if err != nil {
+			return nil, err
+		}
+		return not(match), nil
+	}
+
+	var value string
+	switch v := f.Value.(type) {
+	case string:
+		value = v
+	case float64:
+		value = strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		value = v.String()
+	case nil:
+		return nil, &FilterError{Path: path + ".value", Message: "missing value"}
+	default:
+		return nil, &FilterError{Path: path + ".value", Message: "expected a string or number"}
+	}
+	op := strings.ToLower(f.Op)
+	if op == "" {
+		op = opEq
+	}
+	match, err := compileCondition(f.Field, op, value)
+	if err != nil {
+		return nil, &FilterError{Path: path, Message: err.Error()}
+	}
+	return match, nil
+}
+
+// Compile a condition, checking the field supports the operator and the value is valid for the field
+func compileCondition(field, op, value string) (predicate, error) {
+	spec, ok := filterFields[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(FilterFieldNames(), ", "))
+	}
+	supported := false
+	for _, candidate := range spec.ops {
+		supported = supported || candidate == op
+	}
+	if !supported {
+		return nil, fmt.Errorf("operator %q is not supported by %s, expected one of %s", op, field, strings.Join(spec.ops, ", "))
+	}
+	match, err := spec.compile(op, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", field, err.Error())
+	}
+	return match, nil
+}
+
+// Fields conditions can be given on
+func FilterFieldNames() []string {
+	return []string{"direction", "counterparty", "from", "to", "contract", "value", "gasPrice", "block", "time", "status", "method", "tokenType", "flag"}
+}
+
+func allOf(predicates []predicate) predicate {
+	return func(tx Transaction, wallets []string) bool {
+		for _, match := range predicates {
+			if !match(tx, wallets) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func anyOf(predicates []predicate) predicate {
+	return func(tx Transaction, wallets []string) bool {
+		for _, match := range predicates {
+			if match(tx, wallets) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func not(match predicate) predicate {
+	return func(tx Transaction, wallets []string) bool { return !match(tx, wallets) }
+}
+
+// Negate the predicate for the ne operator
+func withOp(op string, match predicate) predicate {
+	if op == opNe {
+		return not(match)
+	}
+	return match
+}
+
+func compare(op string, cmp int) bool {
+	switch op {
+	case opEq:
+		return cmp == 0
+	case opNe:
+		return cmp != 0
+	case opGt:
+		return cmp > 0
+	case opGte:
+		return cmp >= 0
+	case opLt:
+		return cmp < 0
+	}
+	return cmp <= 0
+}
+
+/******************
+Fields
+******************/
+
+func compileDirection(op, value string) (predicate, error) {
+	value = strings.ToLower(value)
+	if value != "in" && value != "out" && value != "self" {
+		return nil, fmt.Errorf("expected in, out or self, got %q", value)
+	}
+	return withOp(op, func(tx Transaction, wallets []string) bool {
+		from, to := containsAddress(wallets, tx.FromAddress), containsAddress(wallets, tx.ToAddress)
+		switch value {
+		case "self":
+			return from && to
+		case "out":
+			return from && !to
+		}
+		return to && !from
+	}), nil
+}
+
+func addressCondition(address func(tx Transaction, wallets []string) string) func(op, value string) (predicate, error) {
+	return func(op, value string) (predicate, error) {
+		if !IsAddress(value) {
+			return nil, fmt.Errorf("expected an address, got %q", value)
+		}
+		return withOp(op, func(tx Transaction, wallets []string) bool {
+			return strings.EqualFold(address(tx, wallets), value)
+		}), nil
+	}
+}
+
+// Calls of the contract, i.e. transactions to it with input data
+func compileContract(op, value string) (predicate, error) {
+	if !IsAddress(value) {
+		return nil, fmt.Errorf("expected an address, got %q", value)
+	}
+	return withOp(op, func(tx Transaction, wallets []string) bool {
+		return tx.MethodID != "" && tx.MethodID != "0x" && strings.EqualFold(tx.ToAddress, value)
+	}), nil
+}
+
+// Amounts given in ETH or gwei and compared in wei
+func unitsCondition(decimals int, amount func(tx Transaction) string) func(op, value string) (predicate, error) {
+	return func(op, value string) (predicate, error) {
+		expected, err := ParseUnits(value, decimals)
+		if err != nil {
+			return nil, err
+		}
+		return func(tx Transaction, wallets []string) bool {
+			return compare(op, ParseBigInt(amount(tx)).Cmp(expected))
+		}, nil
+	}
+}
+
+func compileBlock(op, value string) (predicate, error) {
+	expected, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("expected a block number, got %q", value)
+	}
+	return func(tx Transaction, wallets []string) bool {
+		return compare(op, new(big.Int).SetUint64(tx.BlockHeight).Cmp(new(big.Int).SetUint64(expected)))
+	}, nil
+}
+
+// A plain date covers the whole day, so time<=2024-01-31 includes that day
+func compileTime(op, value string) (predicate, error) {
+	start, err := ParseDate(value)
+	if err != nil {
+		return nil, fmt.Errorf("expected a YYYY-MM-DD or RFC3339 date, got %q", value)
+	}
+	end := start
+	if len(value) == len("2006-01-02") {
+		end = start.Add(24*time.Hour - time.Nanosecond)
+	}
+	return func(tx Transaction, wallets []string) bool {
+		switch op {
+		case opEq, opNe:
+			within := !tx.Timestamp.Before(start) && !tx.Timestamp.After(end)
+			return within == (op == opEq)
+		case opGt:
+			return tx.Timestamp.After(end)
+		case opGte:
+			return !tx.Timestamp.Before(start)
+		case opLt:
+			return tx.Timestamp.Before(start)
+		}
+		return !tx.Timestamp.After(end)
+	}, nil
+}
+
+func compileStatus(op, value string) (predicate, error) {
+	var status string
+	switch strings.ToLower(value) {
+	case "success":
+		status = "1"
+	case "failed":
+		status = "0"
+	default:
+		return nil, fmt.Errorf("expected success or failed, got %q", value)
+	}
+	return withOp(op, func(tx Transaction, wallets []string) bool { return tx.Status == status }), nil
+}
+
+// A 4-byte selector such as 0xa9059cbb is matched against the method ID, anything else against the
+// function name, e.g. "transfer" matches "transfer(address to, uint256 amount)"
+func compileMethod(op, value string) (predicate, error) {
+	if value == "" {
+		return nil, fmt.Errorf("expected a selector or function name")
+	}
+	lower := strings.ToLower(value)
+	if op == opContains {
+		return func(tx Transaction, wallets []string) bool {
+			return strings.Contains(strings.ToLower(tx.Method), lower)
+		}, nil
+	}
+	if len(value) == 10 && strings.HasPrefix(lower, "0x") && isHex(lower[2:]) {
+		return withOp(op, func(tx Transaction, wallets []string) bool { return strings.EqualFold(tx.MethodID, value) }), nil
+	}
+	return withOp(op, func(tx Transaction, wallets []string) bool {
+		name := tx.Method
+		if paren := strings.IndexByte(name, '('); paren >= 0 {
+			name = name[:paren]
+		}
+		return strings.EqualFold(name, value)
+	}), nil
+}
+
+func compileTokenType(op, value string) (predicate, error) {
+	return withOp(op, func(tx Transaction, wallets []string) bool { return tx.TokenType == value }), nil
+}
+
+// Risk flags of the transaction: a flag kind, or "any" for transactions with any flag
+func compileFlag(op, value string) (predicate, error) {
+	value = strings.ToLower(value)
+	if value == "any" {
+		return withOp(op, func(tx Transaction, wallets []string) bool { return len(tx.Flags) > 0 }), nil
+	}
+	for _, kind := range RiskFlagKinds {
+		if kind == value {
+			return withOp(op, func(tx Transaction, wallets []string) bool { return hasFlag(tx.Flags, value) }), nil
+		}
+	}
+	return nil, fmt.Errorf("expected any, %s, got %q", strings.Join(RiskFlagKinds, ", "), value)
+}
+
+func isHex(value string) bool {
+	for _, c := range value {
+		if !strings.ContainsRune("0123456789abcdef", unicode.ToLower(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+/******************
+Query Syntax
+******************/
+
+// Compact filter syntax, e.g.
+//
+//	direction:out AND value>=1.5 AND (status:failed OR method:transfer) AND NOT counterparty:0xabc...
+//
+// Conditions are a field, an operator (: = != > >= < <= ~) and a value, quoted when it has spaces.
+// Adjacent conditions are combined with AND, which binds tighter than OR.
+type queryParser struct {
+	query string
+	pos   int
+}
+
+func parseQuery(query string) (predicate, error) {
+	p := &queryParser{query: query}
+	match, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.query) {
+		return nil, p.errorf("unexpected %q", p.query[p.pos:p.pos+1])
+	}
+	return match, nil
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return &FilterError{Path: "query", Position: p.pos + 1, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.query) && unicode.IsSpace(rune(p.query[p.pos])) {
+		p.pos++
+	}
+}
+
+// Consume the keyword when it is next, followed by a space, a parenthesis or the end
+func (p *queryParser) keyword(word string) bool {
+	p.skipSpace()
+	end := p.pos + len(word)
+	if end > len(p.query) || !strings.EqualFold(p.query[p.pos:end], word) {
+		return false
+	}
+	if end < len(p.query) && !unicode.IsSpace(rune(p.query[end])) && p.query[end] != '(' {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *queryParser) parseOr() (predicate, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	predicates := []predicate{first}
+	for p.keyword("OR") {
+		next, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, next)
+	}
+	if len(predicates) == 1 {
+		return first, nil
+	}
+	return anyOf(predicates), nil
+}
+
+func (p *queryParser) parseAnd() (predicate, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	predicates := []predicate{first}
+	for {
+		explicit := p.keyword("AND")
+		p.skipSpace()
+		if !explicit {
+			// Adjacent conditions, unless the group or the query ends or OR follows
+			if p.pos >= len(p.query) || p.query[p.pos] == ')' {
+				break
+			}
+			start := p.pos
+			if p.keyword("OR") {
+				p.pos = start
+				break
+			}
+		}
+		next, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, next)
+	}
+	if len(predicates) == 1 {
+		return first, nil
+	}
+	return allOf(predicates), nil
+}
+
+func (p *queryParser) parseUnary() (predicate, error) {
+	if p.keyword("NOT") {
+		match, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return not(match), nil
+	}
+	p.skipSpace()
+	if p.pos >= len(p.query) {
+		return nil, p.errorf("unexpected end of query, expected a condition")
+	}
+	if p.query[p.pos] == '(' {
+		p.pos++
+		match, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.query) || p.query[p.pos] != ')' {
+			return nil, p.errorf("expected \")\"")
+		}
+		p.pos++
+		return match, nil
+	}
+	return p.parseCondition()
+}
+
+func (p *queryParser) parseCondition() (predicate, error) {
+	start := p.pos
+	for p.pos < len(p.query) && (unicode.IsLetter(rune(p.query[p.pos])) || unicode.IsDigit(rune(p.query[p.pos]))) {
+		p.pos++
+	}
+	field := p.query[start:p.pos]
+	if field == "" {
+		return nil, p.errorf("expected a field name, got %q", p.query[p.pos:p.pos+1])
+	}
+
+	op := ""
+	for _, candidate := range queryOps {
+		if strings.HasPrefix(p.query[p.pos:], candidate.symbol) {
+			op = candidate.op
+			p.pos += len(candidate.symbol)
+			break
+		}
+	}
+	if op == "" {
+		return nil, p.errorf("expected an operator after %q", field)
+	}
+
+	valueStart := p.pos
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos == valueStart {
+		return nil, p.errorf("expected a value after %q", p.query[start:p.pos])
+	}
+	match, err := compileCondition(field, op, value)
+	if err != nil {
+		return nil, &FilterError{Path: "query", Position: start + 1, Message: err.Error()}
+	}
+	return match, nil
+}
+
+// Bare value up to a space or closing parenthesis, or a double-quoted value with \" escapes
+func (p *queryParser) parseValue() (string, error) {
+	if p.pos < len(p.query) && p.query[p.pos] == '"' {
+		start := p.pos
+		var value strings.Builder
+		for p.pos++; p.pos < len(p.query); p.pos++ {
+			c := p.query[p.pos]
+			if c == '\\' && p.pos+1 < len(p.query) {
+				p.pos++
+				value.WriteByte(p.query[p.pos])
+				continue
+			}
+			if c == '"' {
+				p.pos++
+				return value.String(), nil
+			}
+			value.WriteByte(c)
+		}
+		p.pos = start
+		return "", p.errorf("unterminated quoted value")
+	}
+	start := p.pos
+	for p.pos < len(p.query) && !unicode.IsSpace(rune(p.query[p.pos])) && p.query[p.pos] != ')' && p.query[p.pos] != '(' {
+		p.pos++
+	}
+	return p.query[start:p.pos], nil
+}
@@ -0,0 +1,147 @@
+package transactions
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+/************
+common
+************/
+
+const (
+	filterWallet = "0x1111111111111111111111111111111111111111"
+	filterOther  = "0x2222222222222222222222222222222222222222"
+	filterToken  = "0x3333333333333333333333333333333333333333"
+)
+
+var filterTransactionsFixture = []Transaction{
+	{ID: "0xa", FromAddress: "0x2222222222222222222222222222222222222222", ToAddress: filterWallet, Value: "2000000000000000000", GasPrice: "10000000000", BlockHeight: 100, Status: "1", Timestamp: time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)},
+	{ID: "0xb", FromAddress: filterWallet, ToAddress: filterToken, Value: "0", GasPrice: "30000000000", BlockHeight: 200, MethodID: "0xa9059cbb", Method: "transfer(address to, uint256 amount)", Status: "1", Timestamp: time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC)},
+	{ID: "0xc", FromAddress: filterWallet, ToAddress: filterOther, Value: "500000000000000000", GasPrice: "50000000000", BlockHeight: 300, Status: "0", Timestamp: time.Date(2024, 2, 5, 8, 0, 0, 0, time.UTC)},
+	{ID: "0xd", FromAddress: filterWallet, ToAddress: filterWallet, Value: "0", GasPrice: "20000000000", BlockHeight: 400, Status: "1", Timestamp: time.Date(2024, 2, 6, 8, 0, 0, 0, time.UTC)},
+}
+
+func matchedHashes(t *testing.T, tree *Filter, query string) string {
+	match, err := compileFilters(tree, query)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var hashes []string
+	for _, tx := range applyFilter(filterTransactionsFixture, []string{filterWallet}, match) {
+		hashes = append(hashes, tx.ID)
+	}
+	return strings.Join(hashes, ",")
+}
+
+/************
+test body
+************/
+
+func TestFilterQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{"Test with direction", "direction:out", "0xb,0xc"},
+		{"Test with self transfers", "direction=self", "0xd"},
+		{"Test with counterparty", "counterparty:" + filterOther, "0xa,0xc"},
+		{"Test with value range", "value>=0.5 value<2", "0xc"},
+		{"Test with status", "status:failed", "0xc"},
+		{"Test with method name", "method:TRANSFER", "0xb"},
+		{"Test with method selector", "method:0xa9059cbb", "0xb"},
+		{"Test with quoted method", `method~"uint256 amount"`, "0xb"},
+		{"Test with contract", "contract:" + filterToken, "0xb"},
+		{"Test with block range", "block>100 AND block<=300", "0xb,0xc"},
+		{"Test with gas price range", "gasPrice>=20 gasPrice<50", "0xb,0xd"},
+		{"Test with end date covering the day", "time<=2024-01-31", "0xa,0xb"},
+		{"Test with OR and grouping", "(status:failed OR direction:in) AND value>0", "0xa,0xc"},
+		{"Test with AND binding tighter than OR", "direction:in OR direction:out AND value>0", "0xa,0xc"},
+		{"Test with NOT", "NOT direction:out", "0xa,0xd"},
+		{"Test with lowercase keywords", "not (status:success or value=0)", "0xc"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if hashes := matchedHashes(t, nil, test.query); hashes != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, hashes)
+			}
+		})
+	}
+}
+
+func TestFilterTree(t *testing.T) {
+	var tree Filter
+	json.Unmarshal([]byte(`{"or": [
+		{"and": [{"field": "direction", "value": "out"}, {"field": "value", "op": "gt", "value": 0.1}]},
+		{"not": {"field": "time", "op": "lt", "value": "2024-02-06"}}
+	]}`), &tree)
+	// Combined with a query using AND
+	if hashes := matchedHashes(t, &tree, "status:success"); hashes != "0xd" {
+		t.Errorf("Expected 0xd, got %s", hashes)
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		tree     string
+		query    string
+		expected string
+	}{
+		{"Test with unknown field", "", "direction:out AND valu>1", `query at position 19: unknown field "valu"`},
+		{"Test with missing operator", "", "status", `query at position 7: expected an operator after "status"`},
+		{"Test with missing value", "", "value>= AND status:failed", `query at position 8: expected a value after "value>="`},
+		{"Test with unsupported operator", "", "status>success", `query at position 1: operator "gt" is not supported by status`},
+		{"Test with invalid amount", "", "value>1.2.3", `query at position 1: invalid value: invalid amount "1.2.3"`},
+		{"Test with unclosed group", "", "(status:failed OR value>1", `query at position 26: expected ")"`},
+		{"Test with unterminated quote", "", `method:"transfer`, `query at position 8: unterminated quoted value`},
+		{"Test with dangling AND", "", "status:failed AND", `query at position 18: unexpected end of query`},
+		{"Test with invalid tree node", `{"and": [{"field": "status", "value": "ok"}]}`, "", `filter.and[0]: invalid status: expected success or failed, got "ok"`},
+		{"Test with ambiguous tree node", `{"or": [{"field": "block", "value": 1, "not": {"field": "block", "value": 2}}]}`, "", `filter.or[0]: expected exactly one of and, or, not or field`},
+		{"Test with empty composition", `{"not": {"and": []}}`, "", `filter.not.and: expected at least one filter`},
+		{"Test with missing tree value", `{"field": "block", "op": "gte"}`, "", `filter.value: missing value`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var tree *Filter
+			if test.tree != "" {
+				tree = &Filter{}
+				if err := json.Unmarshal([]byte(test.tree), tree); err != nil {
+					t.Fatalf("Invalid test tree: %v", err)
+				}
+			}
+			_, err := compileFilters(tree, test.query)
+			if err == nil || !strings.HasPrefix(err.Error(), test.expected) {
+				t.Errorf("Expected error %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestFilterTransactionsDateBounds(t *testing.T) {
+	start := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	if filtered := filterTransactions(filterTransactionsFixture, &start, nil, ""); len(filtered) != 2 {
+		t.Errorf("Expected 2 transactions after the start date, got %d", len(filtered))
+	}
+	if filtered := filterTransactions(filterTransactionsFixture, nil, &start, ""); len(filtered) != 2 {
+		t.Errorf("Expected 2 transactions before the end date, got %d", len(filtered))
+	}
+}
+
+func TestFilteredTransactionsHandlerInvalidFilter(t *testing.T) {
+	body, _ := json.Marshal(map[string]interface{}{"wallet_address": filterWallet, "query": "direction:sideways"})
+	rr := httptest.NewRecorder()
+	FilteredTransactionsHandler("").ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/filtered-transactions", bytes.NewReader(body)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `invalid direction: expected in, out or self, got "sideways"`) {
+		t.Errorf("Unexpected error message %q", rr.Body.String())
+	}
+}
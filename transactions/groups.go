@@ -0,0 +1,164 @@
+package transactions
+
+import (
+	"errors"
+	. "ethereye/utils"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+/******************
+Wallet Groups
+******************/
+
+// Resolves wallet group IDs to the addresses of their members
+type GroupSource interface {
+	GroupAddresses(id string) ([]string, bool)
+}
+
+var ErrUnknownGroup = errors.New("unknown group")
+
+var activeGroups GroupSource
+
+// Let endpoints accept a 'group' parameter in place of addresses
+func UseGroups(groups GroupSource) {
+	activeGroups = groups
+}
+
+// Addresses requested through a 'group' query parameter, or repeated or comma separated 'address' parameters
+func RequestAddresses(query url.Values) ([]string, error) {
+	if id := query.Get("group"); id != "" {
+		return GroupAddresses(id)
+	}
+	return parseAddresses(query["address"])
+}
+
+// Addresses of the request's 'group' or 'address' parameters. Writes the error response and returns false when invalid.
+func RequireAddresses(w http.ResponseWriter, query url.Values) ([]string, bool) {
+	addresses, err := RequestAddresses(query)
+	if errors.Is(err, ErrUnknownGroup) {
+		http.Error(w, fmt.Sprintf("Unknown group %q", query.Get("group")), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid 'address' query parameter: %s", err.Error()), http.StatusBadRequest)
+		return nil, false
+	}
+	if len(addresses) == 0 {
+		http.Error(w, "Missing 'address' or 'group' query parameter", http.StatusBadRequest)
+		return nil, false
+	}
+	return addresses, true
+}
+
+// Lowercase member addresses of the group
+func GroupAddresses(id string) ([]string, error) {
+	if activeGroups == nil {
+		return nil, ErrUnknownGroup
+	}
+	members, ok := activeGroups.GroupAddresses(id)
+	if !ok {
+		return nil, ErrUnknownGroup
+	}
+	return parseAddresses(members)
+}
+
+func parseAddresses(values []string) ([]string, error) {
+	addresses := []string{}
+	seen := make(map[string]bool)
+	for _, value := range values {
+		for _, address := range strings.Split(value, ",") {
+			address = strings.ToLower(strings.TrimSpace(address))
+			if !IsAddress(address) {
+				return nil, fmt.Errorf("invalid address %q", address)
+			}
+			if !seen[address] {
+				seen[address] = true
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses, nil
+}
+
+// Transactions of all the addresses, oldest first. A transaction between two of them is listed once.
+func FetchGroupTransactions(apiKey string, addresses []string) ([]Transaction, error) {
+	var result []Transaction
+	seen := make(map[string]bool)
+	for _, address := range addresses {
+		transactions, err := FetchTransactions(apiKey, address)
+		if errors.Is(err, ErrNoTransactions) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range transactions {
+			if !seen[tx.ID] {
+				seen[tx.ID] = true
+				result = append(result, tx)
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Timestamp.Before(result[j].Timestamp) })
+	return result, nil
+}
+
+// Token transfers of all the addresses. A transfer between two of them is listed once.
+func FetchGroupTokenTransfers(apiKey string, addresses []string) ([]TokenTransfer, error) {
+	var transfers []TokenTransfer
+	for i, address := range addresses {
+		fetched, err := FetchTokenTransfers(apiKey, address)
+		if err != nil {
+			return nil, err
+		}
+		for _, transfer := range fetched {
+			// Already listed for an earlier address
+			if containsAddress(addresses[:i], transfer.From) || containsAddress(addresses[:i], transfer.To) {
+				continue
+			}
+			transfers = append(transfers, transfer)
+		}
+	}
+	return transfers, nil
+}
+
+// Internal ETH transfers of all the addresses. A transfer between two of them is listed once.
+func FetchGroupInternalTransactions(apiKey string, addresses []string) ([]InternalTransaction, error) {
+	var internals []InternalTransaction
+	for i, address := range addresses {
+		fetched, err := FetchInternalTransactions(apiKey, address)
+		if err != nil {
+			return nil, err
+		}
+		for _, internal := range fetched {
+			if containsAddress(addresses[:i], internal.From) || containsAddress(addresses[:i], internal.To) {
+				continue
+			}
+			internals = append(internals, internal)
+		}
+	}
+	return internals, nil
+}
+
+// Whether the transaction moves value between two of the addresses
+func IsInternalTransfer(from, to string, addresses []string) bool {
+	return containsAddress(addresses, from) && containsAddress(addresses, to)
+}
+
+// Whether the address is one of the addresses
+func IsGroupMember(address string, addresses []string) bool {
+	return containsAddress(addresses, address)
+}
+
+func containsAddress(addresses []string, address string) bool {
+	for _, candidate := range addresses {
+		if strings.EqualFold(candidate, address) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package transactions
+
+import (
+	"encoding/json"
+	"errors"
+	"ethereye/internal/testutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type fakeGroups map[string][]string
+
+func (g fakeGroups) GroupAddresses(id string) ([]string, bool) {
+	addresses, ok := g[id]
+	return addresses, ok
+}
+
+func TestRequestAddresses(t *testing.T) {
+	first := "0x1111111111111111111111111111111111111111"
+	second := "0x2222222222222222222222222222222222222222"
+	UseGroups(fakeGroups{"treasury": {first, strings.ToUpper(second[:4]) + second[4:]}})
+	defer UseGroups(nil)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+		err      bool
+	}{
+		{"Test with group", "group=treasury", []string{first, second}, false},
+		{"Test with group over addresses", "group=treasury&address=0x3333333333333333333333333333333333333333", []string{first, second}, false},
+		{"Test with comma separated addresses", "address=" + first + "," + second + "&address=" + first, []string{first, second}, false},
+		{"Test with no addresses", "", []string{}, false},
+		{"Test with invalid address", "address=0x123", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(test.query)
+			addresses, err := RequestAddresses(query)
+			if (err != nil) != test.err {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if len(addresses) != len(test.expected) {
+				t.Fatalf("Expected %v, got %v", test.expected, addresses)
+			}
+			for i := range addresses {
+				if addresses[i] != test.expected[i] {
+					t.Errorf("Expected %v, got %v", test.expected, addresses)
+				}
+			}
+		})
+	}
+
+	query, _ := url.ParseQuery("group=unknown")
+	if _, err := RequestAddresses(query); !errors.Is(err, ErrUnknownGroup) {
+		t.Errorf("Expected ErrUnknownGroup, got %v", err)
+	}
+}
+
+func TestIsInternalTransfer(t *testing.T) {
+	group := []string{"0x1111111111111111111111111111111111111111", "0x2222222222222222222222222222222222222222"}
+	if !IsInternalTransfer("0x1111111111111111111111111111111111111111", "0x2222222222222222222222222222222222222222", group) {
+		t.Errorf("Expected a transfer between members to be internal")
+	}
+	if IsInternalTransfer("0x1111111111111111111111111111111111111111", "0x3333333333333333333333333333333333333333", group) {
+		t.Errorf("Expected a transfer to an outsider not to be internal")
+	}
+}
+
+// Fake Etherscan failing every request, e.g. when rate limited
+func useFailingEtherscan(t *testing.T) {
+	testutil.UseFakeEtherscan(t, func(query url.Values) interface{} {
+		return map[string]string{"status": "0", "message": "NOTOK", "result": "Max rate limit reached"}
+	})
+}
+
+func TestFilteredTransactionsHandlerGroupError(t *testing.T) {
+	useFailingEtherscan(t)
+	UseGroups(fakeGroups{"treasury": {"0x1111111111111111111111111111111111111111"}})
+	defer UseGroups(nil)
+
+	rr := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/filtered-transactions", strings.NewReader(`{"group": "treasury"}`))
+	FilteredTransactionsHandler("").ServeHTTP(rr, request)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
+
+func TestTransactionsHandlerGroupError(t *testing.T) {
+	useFailingEtherscan(t)
+	UseGroups(fakeGroups{"treasury": {"0x1111111111111111111111111111111111111111"}})
+	defer UseGroups(nil)
+
+	rr := httptest.NewRecorder()
+	TransactionsHandler("").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/transactions?group=treasury&format=csv", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
+
+func TestStuckTransactionsHandlerGroup(t *testing.T) {
+	first := "0x1111111111111111111111111111111111111111"
+	second := "0x2222222222222222222222222222222222222222"
+	UseGroups(fakeGroups{"treasury": {first, second}})
+	defer UseGroups(nil)
+	client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+		"eth_getTransactionCount": testutil.Result("0x1"),
+		"eth_getBlockByNumber":    testutil.Result(map[string]string{"baseFeePerGas": "0x3b9aca00"}),
+	})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"Test with missing address", "", http.StatusBadRequest},
+		{"Test with unknown group", "?group=missing", http.StatusNotFound},
+		{"Test with group", "?group=treasury", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			StuckTransactionsHandler("", client).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/stuck-transactions"+test.query, nil))
+			if rr.Code != test.expected {
+				t.Fatalf("Expected status code %d, got %d", test.expected, rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var reports []StuckReport
+			json.NewDecoder(rr.Body).Decode(&reports)
+			if len(reports) != 2 || reports[0].Address != first || reports[1].Address != second {
+				t.Errorf("Expected one report per member, got %+v", reports)
+			}
+		})
+	}
+}
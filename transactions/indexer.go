@@ -0,0 +1,437 @@
+package transactions
+
+import (
+	"encoding/json"
+	"errors"
+	. "ethereye/utils"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Blocks below the chain head that are still re-fetched on every sync, so a
+// reorganization near the head replaces the transactions it touched.
+const DefaultConfirmations = 12
+
+// Etherscan returns at most this many records per txlist call
+const etherscanPageSize = 10000
+
+/******************
+Transaction Store
+******************/
+
+// Synced transaction history of a single address
+type AddressIndex struct {
+	Transactions []Transaction `json:"transactions"`
+	SafeBlock    uint64        `json:"safeBlock"`
+	Backfilled   bool          `json:"backfilled"`
+	LastSynced   time.Time     `json:"lastSynced"`
+}
+
+// Local store of indexed transactions, persisted as one JSON file per address in a directory.
+// Only addresses whose transactions changed since the last save are written again.
+type TransactionStore struct {
+	dir       string
+	mu        sync.RWMutex
+	addresses map[string]*AddressIndex
+	changed   map[string]bool
+}
+
+func NewTransactionStore(dir string) *TransactionStore {
+	return &TransactionStore{dir: dir, addresses: make(map[string]*AddressIndex), changed: make(map[string]bool)}
+}
+
+func (s *TransactionStore) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, file.Name()))
+		if err != nil {
+			return err
+		}
+		var index AddressIndex
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("error loading %s: %w", file.Name(), err)
+		}
+		s.addresses[strings.TrimSuffix(file.Name(), ".json")] = &index
+	}
+	return nil
+}
+
+// Write the addresses changed since the last save
+func (s *TransactionStore) Save() error {
+	s.mu.Lock()
+	pending := make(map[string][]byte, len(s.changed))
+	for address := range s.changed {
+		data, err := json.Marshal(s.addresses[address])
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		pending[address] = data
+	}
+	s.changed = make(map[string]bool)
+	s.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		s.markChanged(pending)
+		return err
+	}
+	for address, data := range pending {
+		// Write to a temporary file first so a crash never leaves a truncated index
+		filename := filepath.Join(s.dir, address+".json")
+		tmp := filename + ".tmp"
+		if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+			s.markChanged(pending)
+			return err
+		}
+		if err := os.Rename(tmp, filename); err != nil {
+			s.markChanged(pending)
+			return err
+		}
+		delete(pending, address)
+	}
+	return nil
+}
+
+// Flag addresses that failed to save so the next save writes them again
+func (s *TransactionStore) markChanged(pending map[string][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for address := range pending {
+		s.changed[address] = true
+	}
+}
+
+// Copy of the stored index for the address
+func (s *TransactionStore) Get(address string) (AddressIndex, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index, ok := s.addresses[normalizeAddress(address)]
+	if !ok {
+		return AddressIndex{}, false
+	}
+	copied := *index
+	copied.Transactions = append([]Transaction(nil), index.Transactions...)
+	return copied, true
+}
+
+// Replace the index of the address. It is saved again only if its transactions changed: a newer
+// safe block or sync time alone is kept in memory, and a stale one on disk only means re-fetching
+// a few more blocks after a restart.
+func (s *TransactionStore) Put(address string, index AddressIndex) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	address = normalizeAddress(address)
+	if previous, ok := s.addresses[address]; !ok || previous.Backfilled != index.Backfilled || !sameTransactions(previous.Transactions, index.Transactions) {
+		s.changed[address] = true
+	}
+	s.addresses[address] = &index
+}
+
+// Whether the lists hold the same transactions in the same blocks with the same status
+func sameTransactions(a, b []Transaction) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].BlockHash != b[i].BlockHash || a[i].Status != b[i].Status {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeAddress(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+/******************
+Indexer
+******************/
+
+// Background indexer that backfills and then tails tracked addresses into a TransactionStore
+type Indexer struct {
+	apiKey        string
+	store         *TransactionStore
+	interval      time.Duration
+	confirmations uint64
+	reorgs        *ReorgDetector
+
+	mu      sync.Mutex
+	tracked map[string]bool
+	sources []func() []string
+	stop    chan struct{}
+}
+
+// The indexer FetchTransactions consults before calling Etherscan
+var activeIndexer *Indexer
+
+// Make FetchTransactions and FetchFilteredTransactions read from the indexer's store when in sync
+func UseIndexer(ix *Indexer) {
+	activeIndexer = ix
+}
+
+func NewIndexer(apiKey string, store *TransactionStore, interval time.Duration) *Indexer {
+	return &Indexer{
+		apiKey:        apiKey,
+		store:         store,
+		interval:      interval,
+		confirmations: DefaultConfirmations,
+		reorgs:        NewReorgDetector(apiKey, DefaultConfirmations, StatusEvents),
+		tracked:       make(map[string]bool),
+	}
+}
+
+// Add an address to the set kept in sync
+func (ix *Indexer) Track(address string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.tracked[normalizeAddress(address)] = true
+}
+
+// Register a function returning addresses to track, re-read on every sync round
+func (ix *Indexer) TrackSource(source func() []string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.sources = append(ix.sources, source)
+}
+
+func (ix *Indexer) trackedAddresses() []string {
+	ix.mu.Lock()
+	for _, source := range ix.sources {
+		for _, address := range source() {
+			ix.tracked[normalizeAddress(address)] = true
+		}
+	}
+	addresses := make([]string, 0, len(ix.tracked))
+	for address := range ix.tracked {
+		addresses = append(addresses, address)
+	}
+	ix.mu.Unlock()
+	return addresses
+}
+
+// Run sync rounds in the background until Stop is called
+func (ix *Indexer) Start() {
+	ix.mu.Lock()
+	if ix.stop != nil {
+		ix.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	ix.stop = stop
+	ix.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(ix.interval)
+		defer ticker.Stop()
+		for {
+			ix.SyncAll()
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (ix *Indexer) Stop() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.stop != nil {
+		close(ix.stop)
+		ix.stop = nil
+	}
+}
+
+// Sync every tracked address once against a single chain head and persist the addresses that changed
+func (ix *Indexer) SyncAll() {
+	head, err := ix.checkHead()
+	if err != nil {
+		log.Printf("indexer: failed to check chain head: %v", err)
+		return
+	}
+	for _, address := range ix.trackedAddresses() {
+		if err := ix.syncAt(address, head); err != nil {
+			log.Printf("indexer: failed to sync %s: %v", address, err)
+		}
+	}
+	if err := ix.store.Save(); err != nil {
+		log.Printf("indexer: failed to save store: %v", err)
+	}
+}
+
+// Backfill the address if it has never been indexed, otherwise fetch the blocks after its safe block
+func (ix *Indexer) Sync(address string) error {
+	head, err := ix.checkHead()
+	if err != nil {
+		return err
+	}
+	return ix.syncAt(address, head)
+}
+
+// Fetch the chain head and look for reorganizations of recently seen blocks
+func (ix *Indexer) checkHead() (uint64, error) {
+	head, err := fetchBlockNumber(ix.apiKey)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := ix.reorgs.Check(head); err != nil {
+		log.Printf("indexer: failed to check for reorgs: %v", err)
+	}
+	return head, nil
+}
+
+func (ix *Indexer) syncAt(address string, head uint64) error {
+	safeBlock := uint64(0)
+	if head > ix.confirmations {
+		safeBlock = head - ix.confirmations
+	}
+
+	index, _ := ix.store.Get(address)
+	startBlock := uint64(0)
+	kept := make([]Transaction, 0, len(index.Transactions))
+	if index.Backfilled {
+		// Everything above the safe block may have been reorganized, so it is fetched again
+		startBlock = index.SafeBlock + 1
+		for _, tx := range index.Transactions {
+			if tx.BlockHeight <= index.SafeBlock {
+				kept = append(kept, tx)
+			}
+		}
+	}
+
+	fetched, err := ix.fetchAll(address, startBlock, head)
+	if err != nil {
+		return err
+	}
+
+	// Etherscan may still report transactions from an orphaned block
+	for i := range fetched {
+		if ix.reorgs.isOrphaned(fetched[i].BlockHash) {
+			fetched[i].Status = StatusReorged
+		}
+	}
+	ix.reorgs.Observe(head, fetched)
+
+	// Reorged transactions that were not included again stay visible as reorged
+	if index.Backfilled {
+		for _, tx := range index.Transactions {
+			if tx.BlockHeight > index.SafeBlock && ix.reorgs.IsReorged(tx.ID) && !containsTransaction(fetched, tx.ID) {
+				tx.Status = StatusReorged
+				kept = append(kept, tx)
+			}
+		}
+	}
+
+	// Kept reorged transactions may come after fetched ones from earlier blocks
+	merged := append(kept, fetched...)
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].BlockHeight < merged[j].BlockHeight })
+
+	if safeBlock < index.SafeBlock {
+		safeBlock = index.SafeBlock
+	}
+	ix.store.Put(address, AddressIndex{
+		Transactions: merged,
+		SafeBlock:    safeBlock,
+		Backfilled:   true,
+		LastSynced:   time.Now(),
+	})
+	return nil
+}
+
+// Page through txlist results between two blocks
+func (ix *Indexer) fetchAll(address string, startBlock, endBlock uint64) ([]Transaction, error) {
+	var result []Transaction
+	for startBlock <= endBlock {
+		page, err := fetchTransactionRange(ix.apiKey, address, startBlock, endBlock)
+		if errors.Is(err, ErrNoTransactions) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(page) < etherscanPageSize {
+			result = append(result, page...)
+			break
+		}
+
+		// The last block of a full page may be cut off, so it is fetched again with the next page
+		lastBlock := page[len(page)-1].BlockHeight
+		if lastBlock == startBlock {
+			return nil, fmt.Errorf("more than %d transactions in block %d", etherscanPageSize, lastBlock)
+		}
+		for _, tx := range page {
+			if tx.BlockHeight < lastBlock {
+				result = append(result, tx)
+			}
+		}
+		startBlock = lastBlock
+	}
+	return result, nil
+}
+
+// Whether the address has been backfilled and synced recently
+func (ix *Indexer) InSync(address string) bool {
+	index, ok := ix.store.Get(address)
+	return ok && index.Backfilled && time.Since(index.LastSynced) <= 2*ix.interval
+}
+
+func (ix *Indexer) isReorged(txID string) bool {
+	return ix != nil && ix.reorgs.IsReorged(txID)
+}
+
+func (ix *Indexer) cachedTransactions(address string) ([]Transaction, bool) {
+	if ix == nil || !ix.InSync(address) {
+		return nil, false
+	}
+	index, _ := ix.store.Get(address)
+	return index.Transactions, true
+}
+
+func containsTransaction(transactions []Transaction, txID string) bool {
+	for _, tx := range transactions {
+		if tx.ID == txID {
+			return true
+		}
+	}
+	return false
+}
+
+func fetchBlockNumber(apiKey string) (uint64, error) {
+	data, err := FetchEtherscan(map[string]string{"module": "proxy", "action": "eth_blockNumber"}, apiKey)
+	if err != nil {
+		return 0, err
+	}
+
+	result, ok := data["result"].(string)
+	if !ok || !strings.HasPrefix(result, "0x") {
+		return 0, fmt.Errorf("error fetching block number: %v", data["result"])
+	}
+	return strconv.ParseUint(strings.TrimPrefix(result, "0x"), 16, 64)
+}
@@ -0,0 +1,286 @@
+package transactions
+
+import (
+	"ethereye/internal/testutil"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+/************
+common
+************/
+
+// Fake Etherscan API serving a mutable chain of transactions for a single address
+type fakeEtherscan struct {
+	mu     sync.Mutex
+	head   uint64
+	txs    []map[string]string
+	hashes map[uint64]string
+	calls  int
+	heads  int
+}
+
+func newFakeEtherscan(t *testing.T) *fakeEtherscan {
+	f := &fakeEtherscan{hashes: make(map[uint64]string)}
+	testutil.UseFakeEtherscan(t, f.respond)
+	return f
+}
+
+func (f *fakeEtherscan) addTx(hash string, block uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.txs = append(f.txs, map[string]string{
+		"hash":             hash,
+		"blockNumber":      strconv.FormatUint(block, 10),
+		"blockHash":        f.blockHash(block),
+		"timeStamp":        strconv.FormatUint(1700000000+block*12, 10),
+		"from":             "0xfrom",
+		"to":               "0xto",
+		"value":            "1000",
+		"gas":              "21000",
+		"gasPrice":         "10",
+		"gasUsed":          "21000",
+		"nonce":            "0",
+		"input":            "0x",
+		"methodId":         "0x",
+		"functionName":     "",
+		"isError":          "0",
+		"txreceipt_status": "1",
+	})
+}
+
+func (f *fakeEtherscan) blockHash(block uint64) string {
+	if hash, ok := f.hashes[block]; ok {
+		return hash
+	}
+	return fmt.Sprintf("0xblock%d", block)
+}
+
+func (f *fakeEtherscan) respond(query url.Values) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+
+	switch query.Get("action") {
+	case "eth_blockNumber":
+		f.heads++
+		return map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": fmt.Sprintf("0x%x", f.head)}
+	case "eth_getBlockByNumber":
+		block, _ := strconv.ParseUint(query.Get("tag")[2:], 16, 64)
+		return map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": map[string]string{"hash": f.blockHash(block)}}
+	case "txlist":
+		start, _ := strconv.ParseUint(query.Get("startblock"), 10, 64)
+		end, _ := strconv.ParseUint(query.Get("endblock"), 10, 64)
+		result := make([]map[string]string, 0)
+		for _, tx := range f.txs {
+			block, _ := strconv.ParseUint(tx["blockNumber"], 10, 64)
+			if block >= start && block <= end {
+				result = append(result, tx)
+			}
+		}
+		return testutil.ListResponse(result)
+	default:
+		return map[string]string{"status": "0", "message": "NOTOK", "result": "unsupported action"}
+	}
+}
+
+/************
+test body
+************/
+
+func TestIndexerBackfillAndTail(t *testing.T) {
+	f := newFakeEtherscan(t)
+	f.head = 100
+	f.addTx("0x1", 10)
+	f.addTx("0x2", 95)
+
+	store := NewTransactionStore("test_transactions")
+	defer os.RemoveAll("test_transactions")
+	ix := NewIndexer("key", store, time.Minute)
+
+	if err := ix.Sync("0xABC"); err != nil {
+		t.Fatalf("Sync() returned an error: %v", err)
+	}
+	index, _ := store.Get("0xabc")
+	if !index.Backfilled || len(index.Transactions) != 2 || index.SafeBlock != 100-DefaultConfirmations {
+		t.Fatalf("Unexpected index after backfill: %+v", index)
+	}
+
+	// Block 95 is reorganized away and replaced by a transaction in block 97
+	f.mu.Lock()
+	f.txs = f.txs[:1]
+	f.head = 105
+	f.mu.Unlock()
+	f.addTx("0x3", 97)
+
+	if err := ix.Sync("0xabc"); err != nil {
+		t.Fatalf("Sync() returned an error: %v", err)
+	}
+	index, _ = store.Get("0xabc")
+	if len(index.Transactions) != 2 || index.Transactions[0].ID != "0x1" || index.Transactions[1].ID != "0x3" {
+		t.Errorf("Unexpected transactions after tail: %+v", index.Transactions)
+	}
+}
+
+func TestFetchTransactionsUsesIndex(t *testing.T) {
+	f := newFakeEtherscan(t)
+	f.head = 50
+	f.addTx("0x1", 10)
+
+	store := NewTransactionStore("test_transactions")
+	defer os.RemoveAll("test_transactions")
+	ix := NewIndexer("key", store, time.Minute)
+	ix.Track("0xabc")
+	ix.SyncAll()
+
+	UseIndexer(ix)
+	defer UseIndexer(nil)
+
+	calls := f.calls
+	transactions, err := FetchTransactions("key", "0xABC")
+	if err != nil {
+		t.Fatalf("FetchTransactions() returned an error: %v", err)
+	}
+	if len(transactions) != 1 || f.calls != calls {
+		t.Errorf("Expected 1 transaction from the local store without calling Etherscan, got %d (%d calls)", len(transactions), f.calls-calls)
+	}
+
+	// Once reloaded from disk the store serves the same history
+	reloaded := NewTransactionStore("test_transactions")
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	if index, ok := reloaded.Get("0xabc"); !ok || len(index.Transactions) != 1 {
+		t.Errorf("Unexpected index after reload: %+v", index)
+	}
+}
+
+func TestIndexerSyncRound(t *testing.T) {
+	f := newFakeEtherscan(t)
+	f.head = 50
+	f.addTx("0x1", 10)
+
+	store := NewTransactionStore("test_transactions")
+	defer os.RemoveAll("test_transactions")
+	ix := NewIndexer("key", store, time.Minute)
+	ix.Track("0xabc")
+	ix.Track("0xdef")
+	ix.SyncAll()
+
+	if f.heads != 1 {
+		t.Errorf("Expected the chain head to be fetched once per round, got %d calls", f.heads)
+	}
+	for _, address := range []string{"0xabc", "0xdef"} {
+		if _, err := os.Stat("test_transactions/" + address + ".json"); err != nil {
+			t.Errorf("Expected %s to be saved: %v", address, err)
+		}
+	}
+
+	// A round without new transactions writes nothing
+	os.Remove("test_transactions/0xabc.json")
+	f.head = 60
+	ix.SyncAll()
+	if _, err := os.Stat("test_transactions/0xabc.json"); !os.IsNotExist(err) {
+		t.Errorf("Expected an unchanged address not to be saved again, got %v", err)
+	}
+
+	f.addTx("0x2", 55)
+	ix.SyncAll()
+	reloaded := NewTransactionStore("test_transactions")
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	if index, ok := reloaded.Get("0xabc"); !ok || len(index.Transactions) != 2 {
+		t.Errorf("Expected the changed address to be saved, got %+v", index)
+	}
+}
+
+func TestIndexerDetectsReorg(t *testing.T) {
+	f := newFakeEtherscan(t)
+	f.head = 100
+	f.addTx("0x1", 95)
+
+	store := NewTransactionStore("test_transactions")
+	defer os.RemoveAll("test_transactions")
+	ix := NewIndexer("key", store, time.Minute)
+	if err := ix.Sync("0xabc"); err != nil {
+		t.Fatalf("Sync() returned an error: %v", err)
+	}
+
+	events, unsubscribe := StatusEvents.Subscribe()
+	defer unsubscribe()
+
+	// Block 95 is replaced and the transaction is not included again
+	f.mu.Lock()
+	f.hashes[95] = "0xother"
+	f.txs = nil
+	f.head = 101
+	f.mu.Unlock()
+
+	if err := ix.Sync("0xabc"); err != nil {
+		t.Fatalf("Sync() returned an error: %v", err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != EventTypeReorg || event.Reorg.BlockHeight != 95 || event.Reorg.NewHash != "0xother" || !event.concerns("0x1") {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+	default:
+		t.Fatal("Expected a reorg event")
+	}
+
+	index, _ := store.Get("0xabc")
+	if len(index.Transactions) != 1 || index.Transactions[0].Status != StatusReorged {
+		t.Errorf("Expected the transaction to be marked as reorged, got %+v", index.Transactions)
+	}
+
+	// A transaction mined in an earlier block is listed before the reorged one
+	f.addTx("0x2", 94)
+	if err := ix.Sync("0xabc"); err != nil {
+		t.Fatalf("Sync() returned an error: %v", err)
+	}
+	index, _ = store.Get("0xabc")
+	if len(index.Transactions) != 2 || index.Transactions[0].ID != "0x2" || index.Transactions[1].ID != "0x1" {
+		t.Errorf("Expected the transactions in block order, got %+v", index.Transactions)
+	}
+
+	// Included again in the new block, it is no longer reorged
+	f.addTx("0x1", 95)
+	if err := ix.Sync("0xabc"); err != nil {
+		t.Fatalf("Sync() returned an error: %v", err)
+	}
+	index, _ = store.Get("0xabc")
+	if len(index.Transactions) != 2 || index.Transactions[1].Status != "1" || ix.isReorged("0x1") {
+		t.Errorf("Expected the transaction to be included again, got %+v", index.Transactions)
+	}
+}
+
+func TestReorgDetectorPrunes(t *testing.T) {
+	f := newFakeEtherscan(t)
+	f.hashes[95] = "0xother"
+	detector := NewReorgDetector("key", 12, nil)
+	detector.Observe(100, []Transaction{{ID: "0x1", BlockHeight: 95, BlockHash: "0xblock95"}})
+
+	if _, err := detector.Check(100); err != nil {
+		t.Fatalf("Check() returned an error: %v", err)
+	}
+	if !detector.IsReorged("0x1") || !detector.isOrphaned("0xblock95") {
+		t.Fatal("Expected the transaction to be reorged")
+	}
+
+	// Still within depth of the head
+	detector.Check(107)
+	if !detector.IsReorged("0x1") {
+		t.Errorf("Expected the reorg to be remembered within depth")
+	}
+	detector.Check(108)
+	if detector.IsReorged("0x1") || detector.isOrphaned("0xblock95") || len(detector.reorged) != 0 || len(detector.orphaned) != 0 {
+		t.Errorf("Expected the reorg to be forgotten past depth, got %v and %v", detector.reorged, detector.orphaned)
+	}
+}
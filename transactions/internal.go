@@ -0,0 +1,49 @@
+package transactions
+
+import (
+	"strconv"
+)
+
+/******************
+Internal Transactions
+******************/
+
+// ETH moved by a contract call. Value is in wei.
+type InternalTransaction struct {
+	BlockNumber int64  `json:"blockNumber"`
+	Timestamp   int64  `json:"timeStamp"`
+	Hash        string `json:"hash"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Value       string `json:"value"`
+	IsError     bool   `json:"isError"`
+}
+
+// All internal ETH transfers to or from the address, oldest first
+func FetchInternalTransactions(apiKey, address string) ([]InternalTransaction, error) {
+	return FetchInternalTransactionsFrom(apiKey, address, 0)
+}
+
+// Internal ETH transfers to or from the address from the start block on, oldest first
+func FetchInternalTransactionsFrom(apiKey, address string, startBlock uint64) ([]InternalTransaction, error) {
+	records, err := fetchAccountRecords(apiKey, "txlistinternal", address, startBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	internals := make([]InternalTransaction, 0, len(records))
+	for _, record := range records {
+		blockNumber, _ := strconv.ParseInt(record["blockNumber"], 10, 64)
+		timestamp, _ := strconv.ParseInt(record["timeStamp"], 10, 64)
+		internals = append(internals, InternalTransaction{
+			BlockNumber: blockNumber,
+			Timestamp:   timestamp,
+			Hash:        record["hash"],
+			From:        record["from"],
+			To:          record["to"],
+			Value:       record["value"],
+			IsError:     record["isError"] == "1",
+		})
+	}
+	return internals, nil
+}
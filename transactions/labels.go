@@ -0,0 +1,99 @@
+package transactions
+
+import (
+	"encoding/json"
+	"ethereye/labels"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+/******************
+Address Labels
+******************/
+
+// Registry annotating addresses in responses, if any
+var activeLabels *labels.Registry
+
+func UseLabels(registry *labels.Registry) {
+	activeLabels = registry
+}
+
+func lookupLabel(address string) *labels.Label {
+	if address == "" {
+		return nil
+	}
+	if label, ok := activeLabels.Lookup(address); ok {
+		return &label
+	}
+	return nil
+}
+
+// Copy of the transactions with their addresses labeled. The copy keeps cached histories unlabeled.
+func LabelTransactions(transactions []Transaction) []Transaction {
+	labeled := make([]Transaction, len(transactions))
+	for i, tx := range transactions {
+		tx.FromLabel = lookupLabel(tx.FromAddress)
+		tx.ToLabel = lookupLabel(tx.ToAddress)
+		labeled[i] = tx
+	}
+	return labeled
+}
+
+// Copy of the transfers with their addresses and token contracts labeled
+func LabelTokenTransfers(transfers []TokenTransfer) []TokenTransfer {
+	labeled := make([]TokenTransfer, len(transfers))
+	for i, transfer := range transfers {
+		transfer.FromLabel = lookupLabel(transfer.From)
+		transfer.ToLabel = lookupLabel(transfer.To)
+		transfer.ContractLabel = lookupLabel(transfer.ContractAddr)
+		labeled[i] = transfer
+	}
+	return labeled
+}
+
+// GET /api/v1/token-transfers?address={address}&exclude_flagged={true|false}
+// GET /api/v1/token-transfers?group={id}
+func TokenTransfersHandler(apiKey string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		addresses, err := RequestAddresses(r.URL.Query())
+		if err == ErrUnknownGroup {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(addresses) == 0 {
+			http.Error(w, "Missing 'address' or 'group' query parameter", http.StatusBadRequest)
+			return
+		}
+
+		transfers, err := FetchGroupTokenTransfers(apiKey, addresses)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error fetching token transfers: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		// Poisoning look-alikes are matched against every address the wallets paid in ETH or tokens. The
+		// flags are left out when the transactions cannot be fetched, unless flagged transfers are excluded.
+		excludeFlagged := r.URL.Query().Get("exclude_flagged") == "true"
+		history, err := FetchGroupTransactions(apiKey, addresses)
+		if err != nil && excludeFlagged {
+			http.Error(w, fmt.Sprintf("Error fetching transactions: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to fetch transactions to flag token transfers: %v", err)
+		} else {
+			transfers = FlagTokenTransfers(transfers, addresses, RealCounterparties(history, transfers, addresses))
+		}
+		if excludeFlagged {
+			transfers = withoutFlaggedTransfers(transfers)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LabelTokenTransfers(transfers))
+	}
+}
@@ -0,0 +1,111 @@
+package transactions
+
+import (
+	"encoding/json"
+	"ethereye/internal/testutil"
+	"ethereye/labels"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+/************
+common
+************/
+
+const usdcAddress = "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"
+
+type fakeFavorites map[string]string
+
+func (f fakeFavorites) Label(address string) string {
+	return f[address]
+}
+
+func (f fakeFavorites) Labels() map[string]string {
+	return f
+}
+
+func useTestLabels(t *testing.T) {
+	registry := labels.NewRegistry(labels.DefaultLabels)
+	registry.UseFavorites(fakeFavorites{filterOther: "Alice"})
+	UseLabels(registry)
+	t.Cleanup(func() { UseLabels(nil) })
+}
+
+/************
+test body
+************/
+
+func TestLabelTransactions(t *testing.T) {
+	useTestLabels(t)
+	transactions := []Transaction{
+		{ID: "0xa", FromAddress: filterOther, ToAddress: usdcAddress},
+		{ID: "0xb", FromAddress: filterWallet, ToAddress: ""},
+	}
+
+	labeled := LabelTransactions(transactions)
+	if label := labeled[0].FromLabel; label == nil || label.Name != "Alice" || label.Category != labels.CategoryFavorite {
+		t.Errorf("Unexpected from label %+v", label)
+	}
+	if label := labeled[0].ToLabel; label == nil || label.Name != "USDC" || label.Category != labels.CategoryToken {
+		t.Errorf("Unexpected to label %+v", label)
+	}
+	if labeled[1].FromLabel != nil || labeled[1].ToLabel != nil {
+		t.Errorf("Expected unknown addresses to stay unlabeled, got %+v", labeled[1])
+	}
+	if transactions[0].FromLabel != nil {
+		t.Errorf("Expected the original transactions to stay unlabeled")
+	}
+}
+
+func TestTokenTransfersHandler(t *testing.T) {
+	useTestLabels(t)
+	testutil.UseFakeEtherscan(t, func(query url.Values) interface{} {
+		if query.Get("action") != "tokentx" {
+			return testutil.ListResponse(nil)
+		}
+		return testutil.ListResponse([]map[string]string{{
+			"blockNumber":     "1",
+			"timeStamp":       "1700000000",
+			"hash":            "0xa",
+			"from":            filterOther,
+			"to":              filterWallet,
+			"value":           "1000000",
+			"contractAddress": usdcAddress,
+			"tokenName":       "USD Coin",
+			"tokenSymbol":     "USDC",
+			"tokenDecimal":    "6",
+		}})
+	})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{"Test with missing address", "", http.StatusBadRequest},
+		{"Test with unknown group", "?group=missing", http.StatusNotFound},
+		{"Test with address", "?address=" + filterWallet, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			TokenTransfersHandler("").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/token-transfers"+test.query, nil))
+			if rr.Code != test.expected {
+				t.Fatalf("Expected status code %d, got %d", test.expected, rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var transfers []TokenTransfer
+			json.NewDecoder(rr.Body).Decode(&transfers)
+			if len(transfers) != 1 || transfers[0].FromLabel == nil || transfers[0].FromLabel.Name != "Alice" {
+				t.Fatalf("Unexpected transfers %+v", transfers)
+			}
+			if label := transfers[0].ContractLabel; label == nil || label.Name != "USDC" {
+				t.Errorf("Unexpected contract label %+v", label)
+			}
+		})
+	}
+}
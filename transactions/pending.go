@@ -0,0 +1,233 @@
+package transactions
+
+import (
+	"ethereye/abi"
+	"ethereye/gas"
+	"ethereye/node"
+	"strings"
+	"sync"
+	"time"
+)
+
+/******************
+Pending Transactions
+******************/
+
+// Lifecycle states reported by LookupTransactionState
+const (
+	StateNotFound = "not_found"
+	StatePending  = "pending"
+	StateMined    = "mined"
+	StateSuccess  = "success"
+	StateReverted = "reverted"
+	StateDropped  = "dropped"
+	StateReplaced = "replaced"
+)
+
+// Pending transaction observed through the node
+type PendingTransaction struct {
+	Hash                 string    `json:"hash"`
+	From                 string    `json:"from"`
+	Nonce                uint64    `json:"nonce"`
+	GasPrice             string    `json:"gasPrice,omitempty"`
+	MaxFeePerGas         string    `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas string    `json:"maxPriorityFeePerGas,omitempty"`
+	FirstSeen            time.Time `json:"firstSeen"`
+}
+
+// Remembers pending transactions so they can be reported as dropped or replaced once they leave the mempool
+type PendingTracker struct {
+	mu           sync.Mutex
+	transactions map[string]PendingTransaction
+}
+
+// Tracker shared by the status and stuck transaction handlers
+var PendingTransactions = NewPendingTracker()
+
+func NewPendingTracker() *PendingTracker {
+	return &PendingTracker{transactions: make(map[string]PendingTransaction)}
+}
+
+// Record a pending transaction, keeping the time it was first seen
+func (p *PendingTracker) Remember(tx *node.Transaction) PendingTransaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hash := strings.ToLower(tx.Hash)
+	pending := PendingTransaction{
+		Hash:                 hash,
+		From:                 strings.ToLower(tx.From),
+		Nonce:                node.ParseUint(tx.Nonce),
+		GasPrice:             tx.GasPrice,
+		MaxFeePerGas:         tx.MaxFeePerGas,
+		MaxPriorityFeePerGas: tx.MaxPriorityFeePerGas,
+		FirstSeen:            time.Now(),
+	}
+	if seen, ok := p.transactions[hash]; ok {
+		pending.FirstSeen = seen.FirstSeen
+	}
+	p.transactions[hash] = pending
+	return pending
+}
+
+func (p *PendingTracker) Get(hash string) (PendingTransaction, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pending, ok := p.transactions[strings.ToLower(hash)]
+	return pending, ok
+}
+
+// Pending transactions seen from the address
+func (p *PendingTracker) From(address string) []PendingTransaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	address = strings.ToLower(address)
+	var result []PendingTransaction
+	for _, pending := range p.transactions {
+		if pending.From == address {
+			result = append(result, pending)
+		}
+	}
+	return result
+}
+
+func (p *PendingTracker) Forget(hash string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.transactions, strings.ToLower(hash))
+}
+
+// Another transaction known to use the same sender and nonce
+func (p *PendingTracker) replacementOf(pending PendingTransaction) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, other := range p.transactions {
+		if other.From == pending.From && other.Nonce == pending.Nonce && other.Hash != pending.Hash {
+			return other.Hash
+		}
+	}
+	return ""
+}
+
+// Look up the lifecycle state of a transaction through the node backend
+func LookupTransactionState(client *node.Client, tracker *PendingTracker, txID string) (TransactionStatus, error) {
+	status := TransactionStatus{TxID: txID}
+
+	tx, err := client.TransactionByHash(txID)
+	if err != nil {
+		return status, err
+	}
+
+	// Until it is mined again, a transaction whose block was orphaned keeps no valid receipt
+	if activeIndexer.isReorged(txID) {
+		status.Status = StatusReorged
+	}
+
+	if tx == nil {
+		pending, ok := tracker.Get(txID)
+		if !ok {
+			status.State = StateNotFound
+			return status, nil
+		}
+
+		// The transaction left the mempool. If its nonce was used, another transaction replaced it.
+		nonce, err := client.TransactionCount(pending.From, "latest")
+		if err != nil {
+			return status, err
+		}
+		if nonce > pending.Nonce {
+			status.State = StateReplaced
+			status.ReplacedBy = findReplacement(tracker, pending)
+		} else {
+			status.State = StateDropped
+		}
+		// Like the stuck transaction report, forget it once it is reported gone
+		tracker.Forget(txID)
+		return status, nil
+	}
+
+	if tx.BlockNumber == nil {
+		tracker.Remember(tx)
+		status.State = StatePending
+		return status, nil
+	}
+	tracker.Forget(txID)
+	// Mined again, its receipt below is the valid one
+	status.Status = ""
+
+	status.BlockNumber = node.ParseUint(*tx.BlockNumber)
+	head, err := client.BlockNumber()
+	if err != nil {
+		return status, err
+	}
+	if head >= status.BlockNumber {
+		status.Confirmations = head - status.BlockNumber + 1
+	}
+
+	receipt, err := client.TransactionReceipt(txID)
+	if err != nil {
+		return status, err
+	}
+	if receipt == nil {
+		status.State = StateMined
+		return status, nil
+	}
+
+	if node.ParseUint(receipt.Status) == 1 {
+		status.State = StateSuccess
+		status.Status = "1"
+		return status, nil
+	}
+
+	status.State = StateReverted
+	status.Status = "0"
+	if revertData, err := replayTransaction(client, tx); err == nil && len(revertData) > 0 {
+		status.RevertReason = abi.DecodeRevert(revertData).String()
+	}
+	return status, nil
+}
+
+// Transaction from the same sender and nonce that got mined instead
+func findReplacement(tracker *PendingTracker, pending PendingTransaction) string {
+	if hash := tracker.replacementOf(pending); hash != "" {
+		return hash
+	}
+	if index, ok := activeIndexerStore(pending.From); ok {
+		for _, tx := range index.Transactions {
+			if strings.EqualFold(tx.FromAddress, pending.From) && tx.Nonce == pending.Nonce && !strings.EqualFold(tx.ID, pending.Hash) {
+				return tx.ID
+			}
+		}
+	}
+	return ""
+}
+
+func activeIndexerStore(address string) (AddressIndex, bool) {
+	if activeIndexer == nil {
+		return AddressIndex{}, false
+	}
+	return activeIndexer.store.Get(address)
+}
+
+// Expected wait of a pending transaction from its fees. Nil if it cannot be estimated.
+func estimatePendingWait(model *gas.InclusionModel, tracker *PendingTracker, txID string) *gas.WaitEstimate {
+	pending, ok := tracker.Get(txID)
+	if !ok {
+		return nil
+	}
+
+	// Legacy transactions pay their gas price as both fee cap and tip
+	maxFee := gas.WeiToGwei(node.ParseBig(pending.GasPrice))
+	tip := maxFee
+	if pending.MaxFeePerGas != "" {
+		maxFee = gas.WeiToGwei(node.ParseBig(pending.MaxFeePerGas))
+		tip = gas.WeiToGwei(node.ParseBig(pending.MaxPriorityFeePerGas))
+	}
+
+	estimate, err := model.Estimate(maxFee, tip)
+	if err != nil {
+		return nil
+	}
+	return &estimate
+}
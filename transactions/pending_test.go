@@ -0,0 +1,131 @@
+package transactions
+
+import (
+	"encoding/json"
+	"ethereye/gas"
+	"ethereye/internal/testutil"
+	"ethereye/node"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+/************
+test body
+************/
+
+func TestLookupTransactionState(t *testing.T) {
+	block := "0x64"
+	revertData := "0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000004" +
+		"6f6f707300000000000000000000000000000000000000000000000000000000"
+
+	t.Run("Test with an unknown transaction", func(t *testing.T) {
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{"eth_getTransactionByHash": testutil.Result(nil)})
+		status, err := LookupTransactionState(client, NewPendingTracker(), "0x1")
+		if err != nil || status.State != StateNotFound {
+			t.Errorf("Expected not_found, got %+v (%v)", status, err)
+		}
+	})
+
+	t.Run("Test with a pending transaction that is replaced", func(t *testing.T) {
+		tracker := NewPendingTracker()
+		pending := map[string]interface{}{"hash": "0x1", "from": "0xabc", "nonce": "0x5"}
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{"eth_getTransactionByHash": testutil.Result(pending)})
+		status, err := LookupTransactionState(client, tracker, "0x1")
+		if err != nil || status.State != StatePending {
+			t.Fatalf("Expected pending, got %+v (%v)", status, err)
+		}
+
+		// A speed-up with the same nonce is seen, then the original disappears after the nonce is used
+		tracker.Remember(&node.Transaction{Hash: "0x2", From: "0xabc", Nonce: "0x5"})
+		client = testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+			"eth_getTransactionByHash": testutil.Result(nil),
+			"eth_getTransactionCount":  testutil.Result("0x6"),
+		})
+		status, err = LookupTransactionState(client, tracker, "0x1")
+		if err != nil || status.State != StateReplaced || status.ReplacedBy != "0x2" {
+			t.Errorf("Expected replaced by 0x2, got %+v (%v)", status, err)
+		}
+		if _, ok := tracker.Get("0x1"); ok {
+			t.Errorf("Expected the replaced transaction to be forgotten")
+		}
+	})
+
+	t.Run("Test with a reorged transaction", func(t *testing.T) {
+		ix := NewIndexer("key", NewTransactionStore("test_transactions"), time.Minute)
+		ix.reorgs.reorged["0x1"] = 100
+		UseIndexer(ix)
+		defer UseIndexer(nil)
+
+		// Back in the mempool after its block was orphaned
+		pending := map[string]interface{}{"hash": "0x1", "from": "0xabc", "nonce": "0x5"}
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{"eth_getTransactionByHash": testutil.Result(pending)})
+		status, err := LookupTransactionState(client, NewPendingTracker(), "0x1")
+		if err != nil || status.State != StatePending || status.Status != StatusReorged {
+			t.Errorf("Expected pending and reorged, got %+v (%v)", status, err)
+		}
+	})
+
+	t.Run("Test with a dropped transaction", func(t *testing.T) {
+		tracker := NewPendingTracker()
+		tracker.Remember(&node.Transaction{Hash: "0x1", From: "0xabc", Nonce: "0x5"})
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+			"eth_getTransactionByHash": testutil.Result(nil),
+			"eth_getTransactionCount":  testutil.Result("0x5"),
+		})
+		status, err := LookupTransactionState(client, tracker, "0x1")
+		if err != nil || status.State != StateDropped {
+			t.Errorf("Expected dropped, got %+v (%v)", status, err)
+		}
+		if _, ok := tracker.Get("0x1"); ok {
+			t.Errorf("Expected the dropped transaction to be forgotten")
+		}
+	})
+
+	t.Run("Test with a reverted transaction", func(t *testing.T) {
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+			"eth_getTransactionByHash":  testutil.Result(map[string]interface{}{"hash": "0x1", "from": "0xabc", "to": "0xdef", "input": "0x", "blockNumber": block}),
+			"eth_blockNumber":           testutil.Result("0x66"),
+			"eth_getTransactionReceipt": testutil.Result(map[string]interface{}{"status": "0x0", "blockNumber": block}),
+			"eth_call": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+				return nil, &node.RPCError{Code: 3, Message: "execution reverted", Data: revertData}
+			},
+		})
+		status, err := LookupTransactionState(client, NewPendingTracker(), "0x1")
+		if err != nil || status.State != StateReverted || status.Confirmations != 3 || status.RevertReason != "oops" {
+			t.Errorf("Expected reverted with reason, got %+v (%v)", status, err)
+		}
+	})
+}
+
+func TestTransactionStatusHandlerETA(t *testing.T) {
+	previous := PendingTransactions
+	PendingTransactions = NewPendingTracker()
+	t.Cleanup(func() { PendingTransactions = previous })
+	client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+		"eth_getTransactionByHash": testutil.Result(map[string]interface{}{
+			"hash": "0x1", "from": "0xabc", "nonce": "0x1", "maxFeePerGas": "0x4a817c800", "maxPriorityFeePerGas": "0x3b9aca00",
+		}),
+		"eth_feeHistory": testutil.Result(map[string]interface{}{
+			"oldestBlock":   "0x1",
+			"baseFeePerGas": []string{"0x2540be400", "0x2540be400"},
+			"gasUsedRatio":  []float64{0.5},
+			"reward":        [][]string{{"0x3b9aca00"}},
+		}),
+	})
+	handler := TransactionStatusHandler("key", client, gas.NewInclusionModel(client, 1))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/transaction-status?txid=0x1", nil))
+
+	var status TransactionStatus
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode response JSON: %v", err)
+	}
+	if status.State != StatePending || status.ETA == nil || *status.ETA.P50Blocks != 1 {
+		t.Errorf("Expected a pending transaction with an ETA, got %+v", status)
+	}
+}
@@ -0,0 +1,178 @@
+package transactions
+
+import (
+	. "ethereye/utils"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+/******************
+Reorg Detection
+******************/
+
+// Status of a transaction whose block was orphaned by a chain reorganization
+const StatusReorged = "reorged"
+
+// Block at a given height replaced by a different one
+type ReorgEvent struct {
+	BlockHeight uint64   `json:"blockHeight"`
+	OldHash     string   `json:"oldHash"`
+	NewHash     string   `json:"newHash"`
+	TxIDs       []string `json:"txids"`
+}
+
+// Tracks block hashes of recently seen transactions and detects when the canonical block at their height changes.
+// Orphaned blocks and reorged transactions are remembered with their height until they are deeper than depth.
+type ReorgDetector struct {
+	apiKey string
+	depth  uint64
+	broker *StatusBroker
+
+	mu       sync.Mutex
+	blocks   map[uint64]string
+	txIDs    map[uint64][]string
+	orphaned map[string]uint64
+	reorged  map[string]uint64
+}
+
+func NewReorgDetector(apiKey string, depth uint64, broker *StatusBroker) *ReorgDetector {
+	return &ReorgDetector{
+		apiKey:   apiKey,
+		depth:    depth,
+		broker:   broker,
+		blocks:   make(map[uint64]string),
+		txIDs:    make(map[uint64][]string),
+		orphaned: make(map[string]uint64),
+		reorged:  make(map[string]uint64),
+	}
+}
+
+// Record the blocks of transactions within depth of the head.
+// A transaction seen again in a canonical block is no longer considered reorged.
+func (d *ReorgDetector) Observe(head uint64, transactions []Transaction) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, tx := range transactions {
+		if _, orphaned := d.orphaned[tx.BlockHash]; tx.BlockHash == "" || orphaned || tx.BlockHeight+d.depth < head {
+			continue
+		}
+		if d.blocks[tx.BlockHeight] != tx.BlockHash {
+			d.blocks[tx.BlockHeight] = tx.BlockHash
+			d.txIDs[tx.BlockHeight] = nil
+		}
+		if !contains(d.txIDs[tx.BlockHeight], tx.ID) {
+			d.txIDs[tx.BlockHeight] = append(d.txIDs[tx.BlockHeight], tx.ID)
+		}
+		delete(d.reorged, tx.ID)
+	}
+}
+
+// Compare the recorded hashes against the canonical chain and publish an event for every replaced block
+func (d *ReorgDetector) Check(head uint64) ([]ReorgEvent, error) {
+	d.mu.Lock()
+	heights := make([]uint64, 0, len(d.blocks))
+	for height := range d.blocks {
+		if height+d.depth < head {
+			delete(d.blocks, height)
+			delete(d.txIDs, height)
+			continue
+		}
+		heights = append(heights, height)
+	}
+	d.prune(head)
+	d.mu.Unlock()
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+	var events []ReorgEvent
+	for _, height := range heights {
+		canonical, err := fetchBlockHash(d.apiKey, height)
+		if err != nil {
+			return events, err
+		}
+
+		d.mu.Lock()
+		recorded := d.blocks[height]
+		if recorded == "" || recorded == canonical {
+			d.mu.Unlock()
+			continue
+		}
+		event := ReorgEvent{BlockHeight: height, OldHash: recorded, NewHash: canonical, TxIDs: d.txIDs[height]}
+		d.orphaned[recorded] = height
+		for _, id := range event.TxIDs {
+			d.reorged[id] = height
+		}
+		delete(d.blocks, height)
+		delete(d.txIDs, height)
+		d.mu.Unlock()
+
+		events = append(events, event)
+		if d.broker != nil {
+			reorg := event
+			d.broker.Publish(StatusEvent{Type: EventTypeReorg, TxIDs: event.TxIDs, Reorg: &reorg, Time: time.Now()})
+		}
+	}
+	return events, nil
+}
+
+// Forget orphaned blocks and reorged transactions deeper than depth below the head. Must be called with the lock held.
+func (d *ReorgDetector) prune(head uint64) {
+	for hash, height := range d.orphaned {
+		if height+d.depth < head {
+			delete(d.orphaned, hash)
+		}
+	}
+	for id, height := range d.reorged {
+		if height+d.depth < head {
+			delete(d.reorged, id)
+		}
+	}
+}
+
+// Whether the transaction was last seen in an orphaned block
+func (d *ReorgDetector) IsReorged(txID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.reorged[txID]
+	return ok
+}
+
+func (d *ReorgDetector) isOrphaned(blockHash string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.orphaned[blockHash]
+	return ok
+}
+
+func fetchBlockHash(apiKey string, height uint64) (string, error) {
+	data, err := FetchEtherscan(map[string]string{
+		"module":  "proxy",
+		"action":  "eth_getBlockByNumber",
+		"tag":     fmt.Sprintf("0x%x", height),
+		"boolean": "false",
+	}, apiKey)
+	if err != nil {
+		return "", err
+	}
+
+	block, ok := data["result"].(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("error fetching block %d: %v", height, data["result"])
+	}
+	hash, ok := block["hash"].(string)
+	if !ok {
+		return "", fmt.Errorf("block %d has no hash", height)
+	}
+	return hash, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
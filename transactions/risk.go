@@ -0,0 +1,218 @@
+package transactions
+
+import (
+	. "ethereye/utils"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+/******************
+Risk Flags
+******************/
+
+const (
+	FlagAddressPoisoning = "address_poisoning"
+	FlagSuspiciousToken  = "suspicious_token"
+	FlagBlocklisted      = "blocklisted"
+)
+
+var RiskFlagKinds = []string{FlagAddressPoisoning, FlagSuspiciousToken, FlagBlocklisted}
+
+// Heuristic warning about a transaction or transfer
+type RiskFlag struct {
+	Kind   string `json:"kind"`
+	Reason string `json:"reason"`
+}
+
+// Hex digits a look-alike address shares with the address it imitates, at each end
+const lookalikeDigits = 4
+
+// Token names luring holders to a website or a fake claim. Only explicit links count, as real
+// tokens are often named after their domain, such as yearn.finance.
+var (
+	tokenURLPattern  = regexp.MustCompile(`(?i)(https?://|www\.)`)
+	tokenBaitPattern = regexp.MustCompile(`(?i)\b(claim|visit|reward|rewards|voucher|airdrop|free|bonus)\b`)
+)
+
+// Whether the addresses differ but share their first and last hex digits
+func isLookalike(address, other string) bool {
+	a, b := strings.ToLower(address), strings.ToLower(other)
+	if a == b || !IsAddress(a) || !IsAddress(b) {
+		return false
+	}
+	return a[2:2+lookalikeDigits] == b[2:2+lookalikeDigits] && a[len(a)-lookalikeDigits:] == b[len(b)-lookalikeDigits:]
+}
+
+// Counterparty the address imitates, if any
+func imitatedAddress(address string, counterparties []string) (string, bool) {
+	for _, counterparty := range counterparties {
+		if isLookalike(address, counterparty) {
+			return counterparty, true
+		}
+	}
+	return "", false
+}
+
+// Addresses the wallets sent a non-zero amount of ETH or tokens to in the given history. These are the
+// addresses poisoning attacks imitate, hoping the victim copies a look-alike from the history.
+func RealCounterparties(transactions []Transaction, transfers []TokenTransfer, wallets []string) []string {
+	var counterparties []string
+	seen := make(map[string]bool)
+	add := func(from, to, value string) {
+		to = strings.ToLower(to)
+		if containsAddress(wallets, from) && !containsAddress(wallets, to) && ParseBigInt(value).Sign() > 0 && !seen[to] {
+			seen[to] = true
+			counterparties = append(counterparties, to)
+		}
+	}
+	for _, tx := range transactions {
+		if tx.Status != "0" {
+			add(tx.FromAddress, tx.ToAddress, tx.Value)
+		}
+	}
+	for _, transfer := range transfers {
+		add(transfer.From, transfer.To, transfer.Value)
+	}
+	return counterparties
+}
+
+// The other side of a transfer of the wallets
+func otherParty(from, to string, wallets []string) string {
+	if containsAddress(wallets, from) {
+		return to
+	}
+	return from
+}
+
+func poisoningFlag(from, to, value string, wallets, counterparties []string) []RiskFlag {
+	if ParseBigInt(value).Sign() != 0 {
+		return nil
+	}
+	other := otherParty(from, to, wallets)
+	imitated, ok := imitatedAddress(other, counterparties)
+	if !ok {
+		return nil
+	}
+	return []RiskFlag{{
+		Kind:   FlagAddressPoisoning,
+		Reason: fmt.Sprintf("Zero-value transfer with %s, which looks like %s the wallet sent funds to", other, imitated),
+	}}
+}
+
+// Flags of the addresses labeled with risk flags, such as scams and sanctioned addresses
+func blocklistFlags(addresses ...string) []RiskFlag {
+	var flags []RiskFlag
+	for _, address := range addresses {
+		label, ok := activeLabels.Known(address)
+		if !ok || len(label.Risk) == 0 {
+			continue
+		}
+		flags = append(flags, RiskFlag{
+			Kind:   FlagBlocklisted,
+			Reason: fmt.Sprintf("Interaction with %s (%s), flagged as %s", strings.ToLower(address), label.Name, strings.Join(label.Risk, ", ")),
+		})
+	}
+	return flags
+}
+
+// Whether a word mixes Latin letters with Greek or Cyrillic ones that look the same, such as "UЅDT".
+// Names written entirely in another script are fine.
+func mixesScripts(text string) bool {
+	for _, word := range strings.Fields(text) {
+		latin, lookalike := false, false
+		for _, r := range word {
+			switch {
+			case r <= unicode.MaxASCII && unicode.IsLetter(r):
+				latin = true
+			case unicode.In(r, unicode.Greek, unicode.Cyrillic):
+				lookalike = true
+			}
+		}
+		if latin && lookalike {
+			return true
+		}
+	}
+	return false
+}
+
+// Reason the name or symbol of a token is suspicious, or "" if it is not. Known tokens are trusted.
+func suspiciousToken(contract, name, symbol string) string {
+	if _, ok := activeLabels.Known(contract); ok {
+		return ""
+	}
+	for _, text := range []string{name, symbol} {
+		if tokenURLPattern.MatchString(text) {
+			return fmt.Sprintf("Unknown token %q advertises a website", text)
+		}
+		if tokenBaitPattern.MatchString(text) {
+			return fmt.Sprintf("Unknown token %q baits holders into a claim", text)
+		}
+		if mixesScripts(text) {
+			return fmt.Sprintf("Unknown token %q uses look-alike characters", text)
+		}
+	}
+	if strings.EqualFold(symbol, "ETH") {
+		return "Unknown token uses the symbol of ETH"
+	}
+	if known, ok := activeLabels.Token(symbol); ok {
+		return fmt.Sprintf("Unknown token uses the symbol of %s at %s", known.Name, known.Address)
+	}
+	return ""
+}
+
+// Copy of the transactions with their risk flags. Look-alikes are matched against the real
+// counterparties of the wallets, which should come from their whole history.
+func FlagTransactions(transactions []Transaction, wallets, counterparties []string) []Transaction {
+	flagged := make([]Transaction, len(transactions))
+	for i, tx := range transactions {
+		tx.Flags = append(poisoningFlag(tx.FromAddress, tx.ToAddress, tx.Value, wallets, counterparties), blocklistFlags(tx.FromAddress, tx.ToAddress)...)
+		flagged[i] = tx
+	}
+	return flagged
+}
+
+// Copy of the transfers with their risk flags. Look-alikes are matched against the real
+// counterparties of the wallets, which should come from their whole history.
+func FlagTokenTransfers(transfers []TokenTransfer, wallets, counterparties []string) []TokenTransfer {
+	flagged := make([]TokenTransfer, len(transfers))
+	for i, transfer := range transfers {
+		transfer.Flags = poisoningFlag(transfer.From, transfer.To, transfer.Value, wallets, counterparties)
+		if reason := suspiciousToken(transfer.ContractAddr, transfer.TokenName, transfer.TokenSymbol); reason != "" {
+			transfer.Flags = append(transfer.Flags, RiskFlag{Kind: FlagSuspiciousToken, Reason: reason})
+		}
+		transfer.Flags = append(transfer.Flags, blocklistFlags(transfer.From, transfer.To, transfer.ContractAddr)...)
+		flagged[i] = transfer
+	}
+	return flagged
+}
+
+func withoutFlaggedTransactions(transactions []Transaction) []Transaction {
+	kept := make([]Transaction, 0, len(transactions))
+	for _, tx := range transactions {
+		if len(tx.Flags) == 0 {
+			kept = append(kept, tx)
+		}
+	}
+	return kept
+}
+
+func withoutFlaggedTransfers(transfers []TokenTransfer) []TokenTransfer {
+	kept := make([]TokenTransfer, 0, len(transfers))
+	for _, transfer := range transfers {
+		if len(transfer.Flags) == 0 {
+			kept = append(kept, transfer)
+		}
+	}
+	return kept
+}
+
+func hasFlag(flags []RiskFlag, kind string) bool {
+	for _, flag := range flags {
+		if flag.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
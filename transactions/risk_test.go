@@ -0,0 +1,189 @@
+package transactions
+
+import (
+	"ethereye/internal/testutil"
+	"ethereye/labels"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+/************
+common
+************/
+
+const (
+	// Recipient of the wallet's payments, and an address made to look like it
+	riskRecipient = "0xabcd000000000000000000000000000000001234"
+	riskLookalike = "0xabcdffffffffffffffffffffffffffffffff1234"
+	riskScammer   = "0x6666666666666666666666666666666666666666"
+	ethRecipient  = "0xbeef000000000000000000000000000000005678"
+	ethLookalike  = "0xbeefffffffffffffffffffffffffffffffff5678"
+)
+
+func useRiskLabels(t *testing.T) {
+	entries := append([]labels.Label{{Address: riskScammer, Name: "Fake_Phishing1", Category: labels.CategoryScam}}, labels.DefaultLabels...)
+	UseLabels(labels.NewRegistry(entries))
+	t.Cleanup(func() { UseLabels(nil) })
+}
+
+func flagKinds(flags []RiskFlag) []string {
+	kinds := make([]string, len(flags))
+	for i, flag := range flags {
+		kinds[i] = flag.Kind
+	}
+	return kinds
+}
+
+/************
+test body
+************/
+
+func TestIsLookalike(t *testing.T) {
+	tests := []struct {
+		name     string
+		address  string
+		expected bool
+	}{
+		{"Test with look-alike", riskLookalike, true},
+		{"Test with same address", "0xABCD000000000000000000000000000000001234", false},
+		{"Test with different suffix", "0xabcdffffffffffffffffffffffffffffffff1235", false},
+		{"Test with different prefix", "0xabceffffffffffffffffffffffffffffffff1234", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if isLookalike(test.address, riskRecipient) != test.expected {
+				t.Errorf("Expected %v for %s", test.expected, test.address)
+			}
+		})
+	}
+}
+
+func TestFlagTransactions(t *testing.T) {
+	useRiskLabels(t)
+	wallets := []string{filterWallet}
+	transactions := []Transaction{
+		{ID: "0xa", FromAddress: filterWallet, ToAddress: riskRecipient, Value: "1000000000000000000", Status: "1"},
+		{ID: "0xb", FromAddress: riskLookalike, ToAddress: filterWallet, Value: "0", Status: "1"},
+		{ID: "0xc", FromAddress: riskScammer, ToAddress: filterWallet, Value: "1", Status: "1"},
+		// Look-alike, but moving value
+		{ID: "0xd", FromAddress: riskLookalike, ToAddress: filterWallet, Value: "1", Status: "1"},
+	}
+
+	flagged := FlagTransactions(transactions, wallets, RealCounterparties(transactions, nil, wallets))
+	expected := [][]string{{}, {FlagAddressPoisoning}, {FlagBlocklisted}, {}}
+	for i, kinds := range expected {
+		if got := flagKinds(flagged[i].Flags); len(got) != len(kinds) || (len(kinds) > 0 && got[0] != kinds[0]) {
+			t.Errorf("Expected flags %v for %s, got %+v", kinds, flagged[i].ID, flagged[i].Flags)
+		}
+	}
+	if transactions[1].Flags != nil {
+		t.Errorf("Expected the original transactions to stay unflagged")
+	}
+
+	t.Run("Test with flag filters", func(t *testing.T) {
+		tests := []struct {
+			query    string
+			expected int
+		}{
+			{"flag:address_poisoning", 1},
+			{"flag:any", 2},
+			{"NOT flag:any", 2},
+			{"flag!=blocklisted", 3},
+		}
+		for _, test := range tests {
+			match, err := compileFilters(nil, test.query)
+			if err != nil {
+				t.Fatalf("Failed to compile %q: %v", test.query, err)
+			}
+			if filtered := applyFilter(flagged, wallets, match); len(filtered) != test.expected {
+				t.Errorf("Expected %d transactions for %q, got %d", test.expected, test.query, len(filtered))
+			}
+		}
+		if _, err := compileFilters(nil, "flag:spam"); err == nil {
+			t.Errorf("Expected an error for an unknown flag")
+		}
+		if kept := withoutFlaggedTransactions(flagged); len(kept) != 2 {
+			t.Errorf("Expected 2 unflagged transactions, got %d", len(kept))
+		}
+	})
+}
+
+func TestFlagTokenTransfers(t *testing.T) {
+	useRiskLabels(t)
+	const fakeToken = "0x7777777777777777777777777777777777777777"
+	transfers := []TokenTransfer{
+		{Hash: "0xa", From: filterWallet, To: riskRecipient, Value: "5000000", ContractAddr: usdcAddress, TokenName: "USD Coin", TokenSymbol: "USDC"},
+		// Fake transferFrom(wallet, look-alike, 0) on the real token
+		{Hash: "0xb", From: filterWallet, To: riskLookalike, Value: "0", ContractAddr: usdcAddress, TokenName: "USD Coin", TokenSymbol: "USDC"},
+		{Hash: "0xc", From: riskLookalike, To: filterWallet, Value: "5000000", ContractAddr: fakeToken, TokenName: "USD Coin", TokenSymbol: "USDC"},
+		{Hash: "0xd", From: filterOther, To: filterWallet, Value: "1", ContractAddr: fakeToken, TokenName: "Visit rewards-eth.xyz to claim", TokenSymbol: "RWD"},
+		{Hash: "0xe", From: filterOther, To: filterWallet, Value: "1", ContractAddr: fakeToken, TokenName: "Tether", TokenSymbol: "UЅDT"},
+		{Hash: "0xf", From: filterOther, To: filterWallet, Value: "1", ContractAddr: fakeToken, TokenName: "Some Token", TokenSymbol: "SOME"},
+		// Named after their website, or written in another script
+		{Hash: "0x10", From: filterOther, To: filterWallet, Value: "1", ContractAddr: fakeToken, TokenName: "yearn.finance", TokenSymbol: "YFI"},
+		{Hash: "0x11", From: filterOther, To: filterWallet, Value: "1", ContractAddr: fakeToken, TokenName: "Harvest.Finance", TokenSymbol: "FARM"},
+		{Hash: "0x12", From: filterOther, To: filterWallet, Value: "1", ContractAddr: fakeToken, TokenName: "Рубль", TokenSymbol: "РУБ"},
+		{Hash: "0x13", From: filterOther, To: filterWallet, Value: "1", ContractAddr: fakeToken, TokenName: "Free money at https://fake.site", TokenSymbol: "FAKE"},
+		// Look-alike of an address the wallet only paid in ETH
+		{Hash: "0x14", From: filterWallet, To: ethLookalike, Value: "0", ContractAddr: usdcAddress, TokenName: "USD Coin", TokenSymbol: "USDC"},
+	}
+	history := []Transaction{{ID: "0x1", FromAddress: filterWallet, ToAddress: ethRecipient, Value: "1000000000000000000", Status: "1"}}
+
+	flagged := FlagTokenTransfers(transfers, []string{filterWallet}, RealCounterparties(history, transfers, []string{filterWallet}))
+	expected := [][]string{{}, {FlagAddressPoisoning}, {FlagSuspiciousToken}, {FlagSuspiciousToken}, {FlagSuspiciousToken}, {}, {}, {}, {}, {FlagSuspiciousToken}, {FlagAddressPoisoning}}
+	for i, kinds := range expected {
+		if got := flagKinds(flagged[i].Flags); len(got) != len(kinds) || (len(kinds) > 0 && got[0] != kinds[0]) {
+			t.Errorf("Expected flags %v for %s, got %+v", kinds, flagged[i].Hash, flagged[i].Flags)
+		}
+	}
+	if kept := withoutFlaggedTransfers(flagged); len(kept) != 5 {
+		t.Errorf("Expected 5 unflagged transfers, got %d", len(kept))
+	}
+}
+
+func TestFlagsWithoutHistory(t *testing.T) {
+	// Etherscan answers one of the lists and is rate limited on the other
+	var failing string
+	testutil.UseFakeEtherscan(t, func(query url.Values) interface{} {
+		if query.Get("action") == failing {
+			return map[string]string{"status": "0", "message": "NOTOK", "result": "Max rate limit reached"}
+		}
+		if query.Get("action") == "tokentx" {
+			return testutil.ListResponse([]map[string]string{
+				{"blockNumber": "1", "timeStamp": "1700000000", "hash": "0xa", "from": riskLookalike, "to": filterWallet, "value": "1", "contractAddress": usdcAddress, "tokenName": "USD Coin", "tokenSymbol": "USDC", "tokenDecimal": "6"},
+			})
+		}
+		return testutil.ListResponse([]map[string]string{
+			{"hash": "0xb", "from": riskLookalike, "to": filterWallet, "value": "0", "gasPrice": "1", "gasUsed": "21000", "blockNumber": "1", "timeStamp": "1700000000", "txreceipt_status": "1"},
+		})
+	})
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		failing  string
+		query    string
+		expected int
+	}{
+		{"Test with transactions without transfers", TransactionsHandler(""), "tokentx", "", http.StatusOK},
+		{"Test with transactions without transfers excluding flagged", TransactionsHandler(""), "tokentx", "&exclude_flagged=true", http.StatusInternalServerError},
+		{"Test with transfers without transactions", TokenTransfersHandler(""), "txlist", "", http.StatusOK},
+		{"Test with transfers without transactions excluding flagged", TokenTransfersHandler(""), "txlist", "&exclude_flagged=true", http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			failing = test.failing
+			rr := httptest.NewRecorder()
+			test.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/?address="+filterWallet+test.query, nil))
+			if rr.Code != test.expected {
+				t.Fatalf("Expected status code %d, got %d", test.expected, rr.Code)
+			}
+			if rr.Code == http.StatusOK && strings.Contains(rr.Body.String(), `"flags"`) {
+				t.Errorf("Expected unflagged results, got %s", rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package transactions
+
+import (
+	"encoding/json"
+	"ethereye/abi"
+	"ethereye/gas"
+	"ethereye/node"
+	. "ethereye/utils"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+/******************
+Simulation
+******************/
+
+// Urgency used to price a simulated transaction unless the request gives one
+const DefaultSimulationUrgency = "5min"
+
+// Transaction to simulate. Value is in wei, decimal or 0x-prefixed hex.
+// Outputs lists the ABI types of the return data, e.g. ["uint256", "bool"].
+type SimulationRequest struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Value   string   `json:"value"`
+	Data    string   `json:"data"`
+	Outputs []string `json:"outputs"`
+	Urgency string   `json:"urgency"`
+	Block   string   `json:"block"`
+}
+
+// What a transaction would do if sent now
+type SimulationResult struct {
+	Success     bool                `json:"success"`
+	GasEstimate uint64              `json:"gasEstimate,omitempty"`
+	Cost        *gas.Recommendation `json:"cost,omitempty"`
+	Revert      *abi.Revert         `json:"revert,omitempty"`
+	Reason      string              `json:"reason,omitempty"`
+	RevertData  string              `json:"revertData,omitempty"`
+	ReturnData  string              `json:"returnData,omitempty"`
+	Decoded     []string            `json:"decoded,omitempty"`
+	DecodeError string              `json:"decodeError,omitempty"`
+}
+
+// Run the transaction with eth_call and, if it succeeds, estimate its gas and price it with the recommender
+func SimulateTransaction(client *node.Client, recommender *gas.Recommender, request SimulationRequest) (SimulationResult, error) {
+	var result SimulationResult
+	msg, err := request.callMsg()
+	if err != nil {
+		return result, err
+	}
+	block := request.Block
+	if block == "" {
+		block = "latest"
+	}
+
+	output, err := client.CallContract(msg, block)
+	if rpcErr, ok := simulationFailure(err); ok {
+		// The call reverted or the sender cannot pay for it
+		result.Reason = rpcErr.Message
+		if data := rpcErr.RevertData(); len(data) > 0 {
+			revert := abi.DecodeRevert(data)
+			result.Revert = &revert
+			result.Reason = revert.String()
+			result.RevertData = node.EncodeBytes(data)
+		}
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Success = true
+	result.ReturnData = node.EncodeBytes(output)
+	if len(request.Outputs) > 0 {
+		decoded, err := abi.DecodeValues(output, request.Outputs)
+		if err != nil {
+			result.DecodeError = err.Error()
+		} else {
+			result.Decoded = decoded
+		}
+	}
+
+	estimate, err := client.EstimateGas(msg)
+	if rpcErr, ok := simulationFailure(err); ok {
+		// eth_call passed but the transaction could still not be sent, e.g. it cannot pay for gas
+		result.Success = false
+		result.Reason = rpcErr.Message
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	result.GasEstimate = estimate
+
+	if recommender != nil {
+		urgency := request.Urgency
+		if urgency == "" {
+			urgency = DefaultSimulationUrgency
+		}
+		cost, err := recommender.Recommend(urgency, estimate)
+		if err != nil {
+			return result, err
+		}
+		result.Cost = &cost
+	}
+	return result, nil
+}
+
+// Node errors saying the transaction would fail: an EVM error, or a sender without the funds for the
+// value and gas. Other errors, such as an unknown block or missing state, are not about the transaction.
+func simulationFailure(err error) (*node.RPCError, bool) {
+	rpcErr, ok := err.(*node.RPCError)
+	if !ok {
+		return nil, false
+	}
+	return rpcErr, rpcErr.ExecutionFailed() || strings.Contains(strings.ToLower(rpcErr.Message), "insufficient funds")
+}
+
+// Block tags accepted besides 0x-prefixed hex block numbers
+var simulationBlockTags = []string{"latest", "pending", "safe", "finalized", "earliest"}
+
+func validSimulationBlock(block string) bool {
+	for _, tag := range simulationBlockTags {
+		if block == tag {
+			return true
+		}
+	}
+	return strings.HasPrefix(block, "0x") && len(block) > 2 && isHex(block[2:])
+}
+
+func (request SimulationRequest) callMsg() (node.CallMsg, error) {
+	msg := node.CallMsg{From: request.From, To: request.To}
+	if request.Block != "" && !validSimulationBlock(request.Block) {
+		return msg, fmt.Errorf("invalid 'block', expected %s or a 0x-prefixed block number", strings.Join(simulationBlockTags, ", "))
+	}
+	if request.From != "" && !IsAddress(request.From) {
+		return msg, fmt.Errorf("invalid 'from' address")
+	}
+	if request.To != "" && !IsAddress(request.To) {
+		return msg, fmt.Errorf("invalid 'to' address")
+	}
+	if request.Value != "" {
+		value, ok := new(big.Int).SetString(request.Value, 0)
+		if !ok || value.Sign() < 0 {
+			return msg, fmt.Errorf("invalid 'value'")
+		}
+		msg.Value = value
+	}
+	if request.Data != "" {
+		data, err := node.DecodeBytes(request.Data)
+		if err != nil || !strings.HasPrefix(request.Data, "0x") {
+			return msg, fmt.Errorf("invalid 'data', expected 0x-prefixed hex")
+		}
+		msg.Data = data
+	}
+	if msg.To == "" && len(msg.Data) == 0 {
+		return msg, fmt.Errorf("missing 'to' address")
+	}
+	return msg, nil
+}
+
+// POST /api/v1/simulate
+func SimulateHandler(client *node.Client, recommender *gas.Recommender) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if client == nil {
+			http.Error(w, "node backend not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		var request SimulationRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if _, err := request.callMsg(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.Urgency != "" {
+			if _, ok := gas.FindUrgency(request.Urgency); !ok {
+				http.Error(w, "Invalid urgency, expected 1block, 5min or 1hour", http.StatusBadRequest)
+				return
+			}
+		}
+
+		result, err := SimulateTransaction(client, recommender, request)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error simulating transaction: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
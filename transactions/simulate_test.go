@@ -0,0 +1,129 @@
+package transactions
+
+import (
+	"bytes"
+	"encoding/json"
+	"ethereye/abi"
+	"ethereye/gas"
+	"ethereye/internal/testutil"
+	"ethereye/node"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSimulateTransaction(t *testing.T) {
+	request := SimulationRequest{
+		From:    "0x1111111111111111111111111111111111111111",
+		To:      "0x2222222222222222222222222222222222222222",
+		Value:   "0",
+		Data:    "0x70a08231",
+		Outputs: []string{"uint256", "bool"},
+	}
+
+	t.Run("Test with a successful call", func(t *testing.T) {
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+			"eth_call": testutil.Result("0x" +
+				"000000000000000000000000000000000000000000000000000000000000002a" +
+				"0000000000000000000000000000000000000000000000000000000000000001"),
+			"eth_estimateGas": testutil.Result("0xc350"),
+			"eth_feeHistory": testutil.Result(map[string]interface{}{
+				"oldestBlock":   "0x1",
+				"baseFeePerGas": []string{"0x3b9aca00", "0x3b9aca00"},
+				"gasUsedRatio":  []float64{0.5},
+				"reward":        [][]string{{"0x3b9aca00", "0x3b9aca00", "0x3b9aca00"}},
+			}),
+		})
+
+		simulation, err := SimulateTransaction(client, gas.NewRecommender(client), request)
+		if err != nil {
+			t.Fatalf("SimulateTransaction() returned an error: %v", err)
+		}
+		if !simulation.Success || simulation.GasEstimate != 50000 {
+			t.Errorf("Unexpected simulation: %+v", simulation)
+		}
+		if len(simulation.Decoded) != 2 || simulation.Decoded[0] != "42" || simulation.Decoded[1] != "true" {
+			t.Errorf("Unexpected decoded return data: %v", simulation.Decoded)
+		}
+		if simulation.Cost == nil || simulation.Cost.GasLimit != 50000 || simulation.Cost.Urgency != DefaultSimulationUrgency {
+			t.Errorf("Unexpected cost: %+v", simulation.Cost)
+		}
+	})
+
+	t.Run("Test with a revert", func(t *testing.T) {
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+			"eth_call": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+				return nil, &node.RPCError{Code: 3, Message: "execution reverted", Data: "0x08c379a0" +
+					"0000000000000000000000000000000000000000000000000000000000000020" +
+					"0000000000000000000000000000000000000000000000000000000000000004" +
+					"6f6f707300000000000000000000000000000000000000000000000000000000"}
+			},
+		})
+
+		simulation, err := SimulateTransaction(client, nil, request)
+		if err != nil {
+			t.Fatalf("SimulateTransaction() returned an error: %v", err)
+		}
+		if simulation.Success || simulation.Revert == nil || simulation.Revert.Kind != abi.RevertError || simulation.Reason != "oops" {
+			t.Errorf("Unexpected simulation: %+v", simulation)
+		}
+	})
+
+	t.Run("Test with a transaction that cannot pay for gas", func(t *testing.T) {
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+			"eth_call": testutil.Result("0x"),
+			"eth_estimateGas": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+				return nil, &node.RPCError{Code: -32000, Message: "insufficient funds for transfer"}
+			},
+		})
+
+		simulation, err := SimulateTransaction(client, nil, request)
+		if err != nil || simulation.Success || simulation.Reason != "insufficient funds for transfer" {
+			t.Errorf("Unexpected simulation: %+v (%v)", simulation, err)
+		}
+	})
+
+	t.Run("Test with a node error", func(t *testing.T) {
+		client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+			"eth_call": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+				return nil, &node.RPCError{Code: -32000, Message: "header not found"}
+			},
+		})
+
+		if _, err := SimulateTransaction(client, nil, request); err == nil {
+			t.Errorf("Expected an error for a block the node does not know")
+		}
+	})
+}
+
+func TestSimulateHandler(t *testing.T) {
+	client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+		"eth_call":        testutil.Result("0x"),
+		"eth_estimateGas": testutil.Result("0x5208"),
+	})
+
+	tests := []struct {
+		name     string
+		client   *node.Client
+		method   string
+		body     string
+		expected int
+	}{
+		{"Test with GET", client, http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"Test without node backend", nil, http.MethodPost, `{"to":"0x2222222222222222222222222222222222222222"}`, http.StatusServiceUnavailable},
+		{"Test with invalid address", client, http.MethodPost, `{"to":"0x22"}`, http.StatusBadRequest},
+		{"Test with invalid value", client, http.MethodPost, `{"to":"0x2222222222222222222222222222222222222222","value":"abc"}`, http.StatusBadRequest},
+		{"Test with invalid block", client, http.MethodPost, `{"to":"0x2222222222222222222222222222222222222222","block":"yesterday"}`, http.StatusBadRequest},
+		{"Test with invalid urgency", client, http.MethodPost, `{"to":"0x2222222222222222222222222222222222222222","urgency":"now"}`, http.StatusBadRequest},
+		{"Test with valid request", client, http.MethodPost, `{"to":"0x2222222222222222222222222222222222222222","value":"0xde0b6b3a7640000"}`, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			SimulateHandler(test.client, nil).ServeHTTP(rr, httptest.NewRequest(test.method, "/api/v1/simulate", bytes.NewBufferString(test.body)))
+			if rr.Code != test.expected {
+				t.Errorf("Expected status code %d, got %d", test.expected, rr.Code)
+			}
+		})
+	}
+}
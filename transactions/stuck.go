@@ -0,0 +1,274 @@
+package transactions
+
+import (
+	"encoding/json"
+	"ethereye/node"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+/******************
+Stuck Transactions
+******************/
+
+// Pending transactions older than this are reported as stuck unless the request overrides it
+const DefaultStuckThreshold = 10 * time.Minute
+
+// Nodes reject replacements that do not raise both fee fields by at least 10%
+const replacementBumpPercent = 10
+
+// Lowest priority fee suggested for a replacement, in wei
+var minReplacementTip = big.NewInt(1e9)
+
+// Fees that should get a stuck transaction replaced and mined
+type ReplacementFee struct {
+	MaxFeePerGas         string `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas"`
+}
+
+type StuckTransaction struct {
+	PendingTransaction
+	AgeSeconds     int64          `json:"ageSeconds"`
+	Reason         string         `json:"reason"`
+	SuggestedFee   ReplacementFee `json:"suggestedFee"`
+	BlockedByNonce *uint64        `json:"blockedByNonce,omitempty"`
+}
+
+// Pending transaction whose nonce was used by another transaction. Kind is "speed_up" or "cancel"
+// when the replacement is known, and "unknown" when only the nonce is known to be used.
+type ReplacedTransaction struct {
+	Hash       string `json:"hash"`
+	Nonce      uint64 `json:"nonce"`
+	ReplacedBy string `json:"replacedBy,omitempty"`
+	Kind       string `json:"kind"`
+}
+
+type StuckReport struct {
+	Address      string                `json:"address"`
+	LatestNonce  uint64                `json:"latestNonce"`
+	PendingNonce uint64                `json:"pendingNonce"`
+	BaseFee      string                `json:"baseFee"`
+	NonceGaps    []uint64              `json:"nonceGaps"`
+	Stuck        []StuckTransaction    `json:"stuck"`
+	Replaced     []ReplacedTransaction `json:"replaced"`
+	// Left the pool without being mined, so their nonce is still free
+	Dropped []PendingTransaction `json:"dropped"`
+}
+
+// Compare the account's pending and latest nonce against the transactions seen from it
+func DetectStuckTransactions(apiKey string, client *node.Client, tracker *PendingTracker, address string, threshold time.Duration) (StuckReport, error) {
+	address = strings.ToLower(address)
+	report := StuckReport{Address: address, NonceGaps: []uint64{}, Stuck: []StuckTransaction{}, Replaced: []ReplacedTransaction{}, Dropped: []PendingTransaction{}}
+
+	latestNonce, err := client.TransactionCount(address, "latest")
+	if err != nil {
+		return report, err
+	}
+	pendingNonce, err := client.TransactionCount(address, "pending")
+	if err != nil {
+		return report, err
+	}
+	report.LatestNonce = latestNonce
+	report.PendingNonce = pendingNonce
+
+	latestBlock, err := client.BlockByNumber("latest")
+	if err != nil {
+		return report, err
+	}
+	baseFee := new(big.Int)
+	if latestBlock != nil {
+		baseFee = node.ParseBig(latestBlock.BaseFeePerGas)
+	}
+	report.BaseFee = baseFee.String()
+
+	// The pool content is optional: not every node exposes the txpool namespace
+	if content, err := client.TxPoolContentFrom(address); err == nil {
+		for _, pool := range content {
+			for _, tx := range pool {
+				if tx != nil {
+					tracker.Remember(tx)
+				}
+			}
+		}
+	}
+
+	// Re-check every known transaction from the address
+	pendingByNonce := make(map[uint64][]PendingTransaction)
+	var gone []PendingTransaction
+	for _, seen := range tracker.From(address) {
+		tx, err := client.TransactionByHash(seen.Hash)
+		if err != nil {
+			return report, err
+		}
+		switch {
+		case tx == nil:
+			gone = append(gone, seen)
+		case tx.BlockNumber != nil:
+			tracker.Forget(seen.Hash)
+		default:
+			pendingByNonce[seen.Nonce] = append(pendingByNonce[seen.Nonce], seen)
+		}
+	}
+
+	var mined []Transaction
+	fetched := false
+	for _, seen := range gone {
+		// Unknown to the node with an unused nonce: evicted from the pool
+		if seen.Nonce >= latestNonce {
+			report.Dropped = append(report.Dropped, seen)
+			tracker.Forget(seen.Hash)
+			continue
+		}
+		if !fetched {
+			if mined, err = FetchTransactions(apiKey, address); err != nil && err != ErrNoTransactions {
+				return report, err
+			}
+			fetched = true
+		}
+		replaced := ReplacedTransaction{Hash: seen.Hash, Nonce: seen.Nonce, Kind: "unknown"}
+		for _, tx := range mined {
+			if tx.Nonce == seen.Nonce && strings.EqualFold(tx.FromAddress, address) && !strings.EqualFold(tx.ID, seen.Hash) {
+				replaced.ReplacedBy = tx.ID
+				replaced.Kind = "speed_up"
+				// A cancellation sends nothing to oneself
+				if strings.EqualFold(tx.ToAddress, address) && (tx.Value == "0" || tx.Value == "") {
+					replaced.Kind = "cancel"
+				}
+				break
+			}
+		}
+		if replaced.ReplacedBy == "" {
+			if replaced.ReplacedBy = tracker.replacementOf(seen); replaced.ReplacedBy != "" {
+				replaced.Kind = "speed_up"
+			}
+		}
+		report.Replaced = append(report.Replaced, replaced)
+		tracker.Forget(seen.Hash)
+	}
+
+	// Nonces up to the highest pending one that no transaction uses. The node holds a transaction
+	// for every nonce below its pending nonce, even the ones the tracker has not seen.
+	nonces := make([]uint64, 0, len(pendingByNonce))
+	for nonce := range pendingByNonce {
+		if nonce >= latestNonce {
+			nonces = append(nonces, nonce)
+		}
+	}
+	sort.Slice(nonces, func(i, j int) bool { return nonces[i] < nonces[j] })
+	var firstGap *uint64
+	if len(nonces) > 0 {
+		start := latestNonce
+		if pendingNonce > start {
+			start = pendingNonce
+		}
+		for nonce := start; nonce < nonces[len(nonces)-1]; nonce++ {
+			if _, ok := pendingByNonce[nonce]; !ok {
+				report.NonceGaps = append(report.NonceGaps, nonce)
+				if firstGap == nil {
+					gap := nonce
+					firstGap = &gap
+				}
+			}
+		}
+	}
+
+	for _, nonce := range nonces {
+		for _, seen := range pendingByNonce[nonce] {
+			age := time.Since(seen.FirstSeen)
+			stuck := StuckTransaction{
+				PendingTransaction: seen,
+				AgeSeconds:         int64(age.Seconds()),
+				SuggestedFee:       suggestReplacementFee(seen, baseFee),
+			}
+			switch {
+			case firstGap != nil && nonce > *firstGap:
+				stuck.Reason = "nonce_gap"
+				stuck.BlockedByNonce = firstGap
+			case age >= threshold:
+				stuck.Reason = "pending_too_long"
+			default:
+				continue
+			}
+			report.Stuck = append(report.Stuck, stuck)
+		}
+	}
+
+	return report, nil
+}
+
+// Fees for a replacement: at least 10% above the original, and enough to cover twice the current base fee
+func suggestReplacementFee(pending PendingTransaction, baseFee *big.Int) ReplacementFee {
+	oldMaxFee := node.ParseBig(pending.MaxFeePerGas)
+	oldTip := node.ParseBig(pending.MaxPriorityFeePerGas)
+	if pending.MaxFeePerGas == "" {
+		// Legacy transactions pay their gas price as both fee cap and tip
+		oldMaxFee = node.ParseBig(pending.GasPrice)
+		oldTip = new(big.Int).Set(oldMaxFee)
+	}
+
+	tip := bump(oldTip)
+	if tip.Cmp(minReplacementTip) < 0 {
+		tip = new(big.Int).Set(minReplacementTip)
+	}
+	maxFee := new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), tip)
+	if bumped := bump(oldMaxFee); maxFee.Cmp(bumped) < 0 {
+		maxFee = bumped
+	}
+
+	return ReplacementFee{MaxFeePerGas: maxFee.String(), MaxPriorityFeePerGas: tip.String()}
+}
+
+// Raise the value by the minimum replacement bump, rounding up
+func bump(value *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(value, big.NewInt(100+replacementBumpPercent))
+	bumped.Add(bumped, big.NewInt(99))
+	return bumped.Div(bumped, big.NewInt(100))
+}
+
+// GET /api/v1/stuck-transactions?address={address}&threshold={duration}
+// GET /api/v1/stuck-transactions?group={id}&threshold={duration}
+// Nonces are per account, so several addresses get a list with one report each.
+func StuckTransactionsHandler(apiKey string, client *node.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if client == nil {
+			http.Error(w, "node backend not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		addresses, ok := RequireAddresses(w, r.URL.Query())
+		if !ok {
+			return
+		}
+
+		threshold := DefaultStuckThreshold
+		if value := r.URL.Query().Get("threshold"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "Invalid threshold", http.StatusBadRequest)
+				return
+			}
+			threshold = parsed
+		}
+
+		reports := make([]StuckReport, 0, len(addresses))
+		for _, address := range addresses {
+			report, err := DetectStuckTransactions(apiKey, client, PendingTransactions, address, threshold)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error detecting stuck transactions: %s", err.Error()), http.StatusInternalServerError)
+				return
+			}
+			reports = append(reports, report)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(reports) == 1 {
+			json.NewEncoder(w).Encode(reports[0])
+			return
+		}
+		json.NewEncoder(w).Encode(reports)
+	}
+}
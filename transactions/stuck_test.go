@@ -0,0 +1,99 @@
+package transactions
+
+import (
+	"encoding/json"
+	"ethereye/internal/testutil"
+	"ethereye/node"
+	"testing"
+	"time"
+)
+
+func TestDetectStuckTransactions(t *testing.T) {
+	f := newFakeEtherscan(t)
+	f.addTx("0xspeedup", 90)
+	f.txs[0]["from"] = "0xabc"
+	f.txs[0]["to"] = "0xdef"
+	f.txs[0]["nonce"] = "4"
+
+	newTracker := func() *PendingTracker {
+		tracker := NewPendingTracker()
+		tracker.Remember(&node.Transaction{Hash: "0xreplaced", From: "0xabc", Nonce: "0x4", GasPrice: "0x3b9aca00"})
+		tracker.Remember(&node.Transaction{Hash: "0xold", From: "0xabc", Nonce: "0x5", MaxFeePerGas: "0x2540be400", MaxPriorityFeePerGas: "0x3b9aca00"})
+		tracker.Remember(&node.Transaction{Hash: "0xblocked", From: "0xabc", Nonce: "0x7", MaxFeePerGas: "0x2540be400", MaxPriorityFeePerGas: "0x3b9aca00"})
+		// Gone without a known replacement, and evicted from the pool
+		tracker.Remember(&node.Transaction{Hash: "0xlost", From: "0xabc", Nonce: "0x3", GasPrice: "0x3b9aca00"})
+		tracker.Remember(&node.Transaction{Hash: "0xdropped", From: "0xabc", Nonce: "0x9", GasPrice: "0x3b9aca00"})
+		old := tracker.transactions["0xold"]
+		old.FirstSeen = time.Now().Add(-time.Hour)
+		tracker.transactions["0xold"] = old
+		return tracker
+	}
+
+	pendingNonce := "0x6"
+	client := testutil.NewFakeNode(t, map[string]testutil.RPCHandler{
+		"eth_getTransactionCount": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+			if string(params[1]) == `"pending"` {
+				return pendingNonce, nil
+			}
+			return "0x5", nil
+		},
+		"eth_getBlockByNumber": testutil.Result(map[string]string{"baseFeePerGas": "0x4a817c800"}),
+		"eth_getTransactionByHash": func(params []json.RawMessage) (interface{}, *node.RPCError) {
+			var hash string
+			json.Unmarshal(params[0], &hash)
+			if hash == "0xreplaced" || hash == "0xlost" || hash == "0xdropped" {
+				return nil, nil
+			}
+			return map[string]interface{}{"hash": hash, "from": "0xabc"}, nil
+		},
+	})
+
+	report, err := DetectStuckTransactions("key", client, newTracker(), "0xABC", DefaultStuckThreshold)
+	if err != nil {
+		t.Fatalf("DetectStuckTransactions() returned an error: %v", err)
+	}
+
+	if len(report.NonceGaps) != 1 || report.NonceGaps[0] != 6 {
+		t.Errorf("Expected a nonce gap at 6, got %v", report.NonceGaps)
+	}
+	kinds := make(map[string]ReplacedTransaction)
+	for _, replaced := range report.Replaced {
+		kinds[replaced.Hash] = replaced
+	}
+	if len(kinds) != 2 || kinds["0xreplaced"].ReplacedBy != "0xspeedup" || kinds["0xreplaced"].Kind != "speed_up" ||
+		kinds["0xlost"].ReplacedBy != "" || kinds["0xlost"].Kind != "unknown" {
+		t.Errorf("Unexpected replaced transactions: %+v", report.Replaced)
+	}
+	if len(report.Dropped) != 1 || report.Dropped[0].Hash != "0xdropped" {
+		t.Errorf("Unexpected dropped transactions: %+v", report.Dropped)
+	}
+	if len(report.Stuck) != 2 || report.Stuck[0].Hash != "0xold" || report.Stuck[0].Reason != "pending_too_long" ||
+		report.Stuck[1].Hash != "0xblocked" || report.Stuck[1].Reason != "nonce_gap" {
+		t.Fatalf("Unexpected stuck transactions: %+v", report.Stuck)
+	}
+
+	// 2 x 20 gwei base fee + 1.1 gwei tip
+	if fee := report.Stuck[0].SuggestedFee; fee.MaxPriorityFeePerGas != "1100000000" || fee.MaxFeePerGas != "41100000000" {
+		t.Errorf("Unexpected suggested fee: %+v", fee)
+	}
+
+	t.Run("Test with untracked pending transactions", func(t *testing.T) {
+		// The node holds transactions for nonces 5 to 7
+		pendingNonce = "0x8"
+		defer func() { pendingNonce = "0x6" }()
+		report, err := DetectStuckTransactions("key", client, newTracker(), "0xabc", DefaultStuckThreshold)
+		if err != nil {
+			t.Fatalf("DetectStuckTransactions() returned an error: %v", err)
+		}
+		if len(report.NonceGaps) != 0 || len(report.Stuck) != 1 || report.Stuck[0].Hash != "0xold" {
+			t.Errorf("Expected no nonce gap, got %v and %+v", report.NonceGaps, report.Stuck)
+		}
+	})
+
+	t.Run("Test with an Etherscan error", func(t *testing.T) {
+		useFailingEtherscan(t)
+		if _, err := DetectStuckTransactions("key", client, newTracker(), "0xabc", DefaultStuckThreshold); err == nil {
+			t.Errorf("Expected an error when the mined transactions cannot be fetched")
+		}
+	})
+}
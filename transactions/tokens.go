@@ -0,0 +1,111 @@
+package transactions
+
+import (
+	. "ethereye/utils"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/******************
+Token Transfers
+******************/
+
+// All ERC-20 transfers to or from the address, oldest first
+func FetchTokenTransfers(apiKey, address string) ([]TokenTransfer, error) {
+	return FetchTokenTransfersFrom(apiKey, address, 0)
+}
+
+// ERC-20 transfers to or from the address from the start block on, oldest first
+func FetchTokenTransfersFrom(apiKey, address string, startBlock uint64) ([]TokenTransfer, error) {
+	records, err := fetchAccountRecords(apiKey, "tokentx", address, startBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers := make([]TokenTransfer, 0, len(records))
+	for _, record := range records {
+		blockNumber, _ := strconv.ParseInt(record["blockNumber"], 10, 64)
+		timestamp, _ := strconv.ParseInt(record["timeStamp"], 10, 64)
+		decimals, _ := strconv.Atoi(record["tokenDecimal"])
+		transfers = append(transfers, TokenTransfer{
+			BlockNumber:  blockNumber,
+			Timestamp:    timestamp,
+			Hash:         record["hash"],
+			From:         record["from"],
+			To:           record["to"],
+			Value:        record["value"],
+			ContractAddr: strings.ToLower(record["contractAddress"]),
+			TokenName:    record["tokenName"],
+			TokenSymbol:  record["tokenSymbol"],
+			TokenDecimal: decimals,
+		})
+	}
+	return transfers, nil
+}
+
+// Every record of an Etherscan account list action such as tokentx or txlistinternal from the start
+// block on, oldest first. String fields are kept as they are; other fields are dropped.
+func fetchAccountRecords(apiKey, action, address string, startBlock uint64) ([]map[string]string, error) {
+	var result []map[string]string
+	endBlock := uint64(math.MaxInt64)
+	for {
+		page, err := fetchAccountRecordRange(apiKey, action, address, startBlock, endBlock)
+		if err != nil {
+			return nil, err
+		}
+		if len(page) < etherscanPageSize {
+			return append(result, page...), nil
+		}
+
+		// The last block of a full page may be cut off, so it is fetched again with the next page
+		lastBlock, _ := strconv.ParseUint(page[len(page)-1]["blockNumber"], 10, 64)
+		if lastBlock == startBlock {
+			return nil, fmt.Errorf("more than %d %s records in block %d", etherscanPageSize, action, lastBlock)
+		}
+		for _, record := range page {
+			if block, _ := strconv.ParseUint(record["blockNumber"], 10, 64); block < lastBlock {
+				result = append(result, record)
+			}
+		}
+		startBlock = lastBlock
+	}
+}
+
+func fetchAccountRecordRange(apiKey, action, address string, startBlock, endBlock uint64) ([]map[string]string, error) {
+	data, err := FetchEtherscan(map[string]string{
+		"module":     "account",
+		"action":     action,
+		"address":    address,
+		"startblock": strconv.FormatUint(startBlock, 10),
+		"endblock":   strconv.FormatUint(endBlock, 10),
+		"sort":       "asc",
+	}, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	if data["status"] != "1" {
+		if data["message"] == "No transactions found" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error fetching %s: %v", action, data["result"])
+	}
+
+	rows, _ := data["result"].([]interface{})
+	records := make([]map[string]string, 0, len(rows))
+	for _, row := range rows {
+		fields, ok := row.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		record := make(map[string]string, len(fields))
+		for name, value := range fields {
+			if text, ok := value.(string); ok {
+				record[name] = text
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -3,11 +3,16 @@ package transactions
 import (
 	"encoding/json"
 	"errors"
+	"ethereye/gas"
+	"ethereye/labels"
+	"ethereye/node"
 	. "ethereye/utils"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,44 +23,94 @@ type Transaction struct {
 	ToAddress   string    `json:"to"`
 	Value       string    `json:"value"`
 	GasPrice    string    `json:"gasPrice"`
+	GasUsed     string    `json:"gasUsed"`
+	Nonce       uint64    `json:"nonce"`
+	MethodID    string    `json:"methodId"`
+	Method      string    `json:"functionName"`
 	TokenType   string    `json:"tokenType"`
 	BlockHeight uint64    `json:"blockHeight"`
+	BlockHash   string    `json:"blockHash"`
 	Status      string    `json:"status"`
 	Timestamp   time.Time `json:"timeStamp"`
+	// Known entities behind the addresses, set in responses
+	FromLabel *labels.Label `json:"fromLabel,omitempty"`
+	ToLabel   *labels.Label `json:"toLabel,omitempty"`
+	// Warnings of the scam heuristics, set in responses
+	Flags []RiskFlag `json:"flags,omitempty"`
 }
 
 type TransactionDetails struct {
-	From      string `json:"from"`
-	To        string `json:"to"`
-	Value     string `json:"value"`
-	Gas       string `json:"gas"`
-	GasPrice  string `json:"gasPrice"`
-	InputData string `json:"inputData"`
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	Value     string            `json:"value"`
+	Gas       string            `json:"gas"`
+	GasPrice  string            `json:"gasPrice"`
+	InputData string            `json:"inputData"`
+	Diagnosis *FailureDiagnosis `json:"diagnosis,omitempty"`
+	FromLabel *labels.Label     `json:"fromLabel,omitempty"`
+	ToLabel   *labels.Label     `json:"toLabel,omitempty"`
+	Flags     []RiskFlag        `json:"flags,omitempty"`
 }
 
 type TransactionStatus struct {
-	TxID   string `json:"txid"`
-	Status string `json:"status"`
+	TxID          string `json:"txid"`
+	Status        string `json:"status"`
+	State         string `json:"state,omitempty"`
+	BlockNumber   uint64 `json:"blockNumber,omitempty"`
+	Confirmations uint64 `json:"confirmations,omitempty"`
+	RevertReason  string `json:"revertReason,omitempty"`
+	ReplacedBy    string `json:"replacedBy,omitempty"`
+	// Expected wait of a pending transaction
+	ETA *gas.WaitEstimate `json:"eta,omitempty"`
 }
 
+// ERC-20 transfer. Value is the raw integer amount, to be scaled by TokenDecimal.
 type TokenTransfer struct {
-	BlockNumber  int64   `json:"blockNumber"`
-	Timestamp    int64   `json:"timeStamp"`
-	Hash         string  `json:"hash"`
-	From         string  `json:"from"`
-	To           string  `json:"to"`
-	Value        float64 `json:"value"`
-	ContractAddr string  `json:"contractAddress"`
+	BlockNumber  int64  `json:"blockNumber"`
+	Timestamp    int64  `json:"timeStamp"`
+	Hash         string `json:"hash"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	Value        string `json:"value"`
+	ContractAddr string `json:"contractAddress"`
+	TokenName    string `json:"tokenName"`
+	TokenSymbol  string `json:"tokenSymbol"`
+	TokenDecimal int    `json:"tokenDecimal"`
+
+	FromLabel     *labels.Label `json:"fromLabel,omitempty"`
+	ToLabel       *labels.Label `json:"toLabel,omitempty"`
+	ContractLabel *labels.Label `json:"contractLabel,omitempty"`
+	Flags         []RiskFlag    `json:"flags,omitempty"`
 }
 
 /******************
 Transactions
 ******************/
 
+// Etherscan's answer for an address without any transaction in the requested range
+var ErrNoTransactions = errors.New("error fetching transactions: No transactions found")
+
 func FetchTransactions(apiKey, walletAddress string) ([]Transaction, error) {
+	// Serve from the local index when it has caught up with the chain
+	if transactions, ok := activeIndexer.cachedTransactions(walletAddress); ok {
+		return transactions, nil
+	}
+
+	return fetchTransactionRange(apiKey, walletAddress, 0, 99999999)
+}
+
+// Transactions of the address from the start block on, oldest first
+func FetchTransactionsFrom(apiKey, walletAddress string, startBlock uint64) ([]Transaction, error) {
+	if startBlock == 0 {
+		return FetchTransactions(apiKey, walletAddress)
+	}
+	return fetchTransactionRange(apiKey, walletAddress, startBlock, 99999999)
+}
+
+func fetchTransactionRange(apiKey, walletAddress string, startBlock, endBlock uint64) ([]Transaction, error) {
 	var result []Transaction
 
-	url := fmt.Sprintf("https://api.etherscan.io/api?module=account&action=txlist&address=%s&startblock=0&endblock=99999999&sort=asc&apikey=%s", walletAddress, apiKey)
+	url := fmt.Sprintf("%s?module=account&action=txlist&address=%s&startblock=%d&endblock=%d&sort=asc&apikey=%s", EtherscanAPIURL, walletAddress, startBlock, endBlock, apiKey)
 
 	// Send the HTTP request to the Etherscan API
 	response, err := http.Get(url)
@@ -76,6 +131,9 @@ func FetchTransactions(apiKey, walletAddress string) ([]Transaction, error) {
 	}
 
 	if jsonData["status"].(string) != "1" {
+		if jsonData["message"] == "No transactions found" {
+			return nil, ErrNoTransactions
+		}
 		return nil, fmt.Errorf("error fetching transactions: %s", jsonData)
 	}
 
@@ -85,6 +143,11 @@ func FetchTransactions(apiKey, walletAddress string) ([]Transaction, error) {
 		txData := tx.(map[string]interface{})
 		blockHeight, _ := strconv.Atoi(txData["blockNumber"].(string))
 		timestamp, _ := strconv.Atoi(txData["timeStamp"].(string))
+		blockHash, _ := txData["blockHash"].(string)
+		nonce, _ := strconv.ParseUint(fmt.Sprint(txData["nonce"]), 10, 64)
+		gasUsed, _ := txData["gasUsed"].(string)
+		methodID, _ := txData["methodId"].(string)
+		method, _ := txData["functionName"].(string)
 
 		transaction := Transaction{
 			ID:          txData["hash"].(string),
@@ -92,8 +155,13 @@ func FetchTransactions(apiKey, walletAddress string) ([]Transaction, error) {
 			ToAddress:   txData["to"].(string),
 			Value:       txData["value"].(string),
 			GasPrice:    txData["gasPrice"].(string),
+			GasUsed:     gasUsed,
+			Nonce:       nonce,
+			MethodID:    methodID,
+			Method:      method,
 			TokenType:   "ETH",
 			BlockHeight: uint64(blockHeight),
+			BlockHash:   blockHash,
 			Status:      txData["txreceipt_status"].(string),
 			Timestamp:   time.Unix(int64(timestamp), 0),
 		}
@@ -106,26 +174,61 @@ func FetchTransactions(apiKey, walletAddress string) ([]Transaction, error) {
 // Transactions API handler
 func TransactionsHandler(apiKey string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Parse the query parameters
-		walletAddress := r.URL.Query().Get("address")
-		if walletAddress == "" {
-			http.Error(w, "Missing 'address' query parameter", http.StatusBadRequest)
+		apiKey := GetApiKey()
+
+		format, columns, err := ExportOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		apiKey := GetApiKey()
+		var transactions []Transaction
+		var wallets []string
+		if group := r.URL.Query().Get("group"); group != "" {
+			// Transactions of every member when a wallet group is given
+			wallets, err = GroupAddresses(group)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			transactions, err = FetchGroupTransactions(apiKey, wallets)
+		} else {
+			// Parse the query parameters
+			walletAddress := r.URL.Query().Get("address")
+			if walletAddress == "" {
+				http.Error(w, "Missing 'address' query parameter", http.StatusBadRequest)
+				return
+			}
 
-		// Fetch the transactions
-		transactions, err := FetchTransactions(apiKey, walletAddress)
+			// Fetch the transactions
+			wallets = []string{strings.ToLower(walletAddress)}
+			transactions, err = FetchTransactions(apiKey, walletAddress)
+		}
 
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Error fetching transactions: %s", err.Error()), http.StatusInternalServerError)
 			return
 		}
 
-		// Write the JSON response
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(transactions)
+		// Poisoning look-alikes are matched against every address the wallets paid in ETH or tokens. The
+		// flags are left out when the transfers cannot be fetched, unless flagged transactions are excluded.
+		excludeFlagged := r.URL.Query().Get("exclude_flagged") == "true"
+		transfers, err := FetchGroupTokenTransfers(apiKey, wallets)
+		if err != nil && excludeFlagged {
+			http.Error(w, fmt.Sprintf("Error fetching token transfers: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to fetch token transfers to flag transactions: %v", err)
+		} else {
+			transactions = FlagTransactions(transactions, wallets, RealCounterparties(transactions, transfers, wallets))
+		}
+		if excludeFlagged {
+			transactions = withoutFlaggedTransactions(transactions)
+		}
+
+		// Write the response in the requested format
+		WriteTransactions(w, LabelTransactions(transactions), format, columns)
 	}
 }
 
@@ -134,7 +237,7 @@ Transaction Details
 ******************/
 
 func FetchTransactionDetails(transactionID string, apiKey string) (TransactionDetails, error) {
-	apiUrl := fmt.Sprintf("https://api.etherscan.io/api?module=proxy&action=eth_getTransactionByHash&txhash=%s&apikey=%s", transactionID, apiKey)
+	apiUrl := fmt.Sprintf("%s?module=proxy&action=eth_getTransactionByHash&txhash=%s&apikey=%s", EtherscanAPIURL, transactionID, apiKey)
 
 	// Send the HTTP request to the Etherscan API
 	resp, err := http.Get(apiUrl)
@@ -165,7 +268,8 @@ func FetchTransactionDetails(transactionID string, apiKey string) (TransactionDe
 	}, nil
 }
 
-func TransactionDetailsHandler(apiKey string) http.HandlerFunc {
+// With a node backend, failed transactions come with a diagnosis of the failure
+func TransactionDetailsHandler(apiKey string, client *node.Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		transactionID := r.URL.Query().Get("txid")
 		if transactionID == "" {
@@ -179,6 +283,19 @@ func TransactionDetailsHandler(apiKey string) http.HandlerFunc {
 			return
 		}
 
+		transactionDetails.FromLabel = lookupLabel(transactionDetails.From)
+		transactionDetails.ToLabel = lookupLabel(transactionDetails.To)
+		transactionDetails.Flags = blocklistFlags(transactionDetails.From, transactionDetails.To)
+
+		if client != nil {
+			// The details are still useful without a diagnosis, e.g. when the node lacks the historical state
+			diagnosis, err := DiagnoseFailure(client, transactionID)
+			if err != nil {
+				log.Printf("Failed to diagnose transaction %s: %v", transactionID, err)
+			}
+			transactionDetails.Diagnosis = diagnosis
+		}
+
 		jsonResponse, err := json.Marshal(transactionDetails)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -199,7 +316,7 @@ func FetchTransactionStatus(txID, apiKey string) (TransactionStatus, error) {
 		return TransactionStatus{}, errors.New("empty transaction ID")
 	}
 
-	apiUrl := fmt.Sprintf("https://api.etherscan.io/api?module=transaction&action=gettxreceiptstatus&txhash=%s&apikey=%s", txID, apiKey)
+	apiUrl := fmt.Sprintf("%s?module=transaction&action=gettxreceiptstatus&txhash=%s&apikey=%s", EtherscanAPIURL, txID, apiKey)
 
 	resp, err := http.Get(apiUrl)
 	if err != nil {
@@ -227,14 +344,23 @@ func FetchTransactionStatus(txID, apiKey string) (TransactionStatus, error) {
 		return TransactionStatus{}, errors.New("Error:" + data["result"].(string))
 	}
 
+	status := data["result"].(map[string]interface{})["status"].(string)
+
+	// A receipt from an orphaned block is no longer valid
+	if activeIndexer.isReorged(txID) {
+		status = StatusReorged
+	}
+
 	return TransactionStatus{
 		TxID:   txID,
-		Status: data["result"].(map[string]interface{})["status"].(string),
+		Status: status,
 	}, nil
 }
 
-// HTTP handler for fetching transaction status
-func TransactionStatusHandler(apiKey string) http.HandlerFunc {
+// HTTP handler for fetching transaction status.
+// With a node backend the response distinguishes pending, dropped and replaced transactions,
+// and pending transactions are annotated with an ETA when an inclusion model is given.
+func TransactionStatusHandler(apiKey string, client *node.Client, model *gas.InclusionModel) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		txID := r.URL.Query().Get("txid")
 		if txID == "" {
@@ -242,7 +368,16 @@ func TransactionStatusHandler(apiKey string) http.HandlerFunc {
 			return
 		}
 
-		txStatus, err := FetchTransactionStatus(txID, apiKey)
+		var txStatus TransactionStatus
+		var err error
+		if client != nil {
+			txStatus, err = LookupTransactionState(client, PendingTransactions, txID)
+			if err == nil && txStatus.State == StatePending && model != nil {
+				txStatus.ETA = estimatePendingWait(model, PendingTransactions, txID)
+			}
+		} else {
+			txStatus, err = FetchTransactionStatus(txID, apiKey)
+		}
 		if err != nil {
 			http.Error(w, "could not fetch transaction status", http.StatusInternalServerError)
 			return
@@ -263,16 +398,21 @@ func FetchFilteredTransactions(walletAddress string, apiKey string, startDate *t
 		return nil, err
 	}
 
-	// If date range is specified, filter transactions by date range
-	if startDate != nil && endDate != nil {
-		startTimestamp := startDate.Unix()
-		endTimestamp := endDate.Unix()
+	return filterTransactions(transactions, startDate, endDate, tokenType), nil
+}
 
+func filterTransactions(transactions []Transaction, startDate *time.Time, endDate *time.Time, tokenType string) []Transaction {
+	// If a start or end date is specified, filter transactions by date range
+	if startDate != nil || endDate != nil {
 		filteredTransactions := make([]Transaction, 0)
 		for _, tx := range transactions {
-			if tx.Timestamp.Unix() >= startTimestamp && tx.Timestamp.Unix() <= endTimestamp {
-				filteredTransactions = append(filteredTransactions, tx)
+			if startDate != nil && tx.Timestamp.Unix() < startDate.Unix() {
+				continue
 			}
+			if endDate != nil && tx.Timestamp.Unix() > endDate.Unix() {
+				continue
+			}
+			filteredTransactions = append(filteredTransactions, tx)
 		}
 		transactions = filteredTransactions
 	}
@@ -288,14 +428,24 @@ func FetchFilteredTransactions(walletAddress string, apiKey string, startDate *t
 		transactions = filteredByTokenType
 	}
 
-	return transactions, nil
+	return transactions
 }
 
 type FilteredTransactionsRequest struct {
 	WalletAddress string `json:"wallet_address"`
+	Group         string `json:"group"`
 	StartDate     string `json:"start_date"`
 	EndDate       string `json:"end_date"`
 	TokenType     string `json:"token_type"`
+	// Filter tree and compact query, combined with AND when both are given
+	Filter *Filter `json:"filter"`
+	Query  string  `json:"query"`
+	// Aggregate the filtered transactions by day, week, month, counterparty, token or method
+	GroupBy string `json:"group_by"`
+	// Sort field of the transactions or groups, descending with a leading "-"
+	Sort string `json:"sort"`
+	// Leave out transactions with risk flags
+	ExcludeFlagged bool `json:"exclude_flagged"`
 }
 
 func FilteredTransactionsHandler(apiKey string) http.HandlerFunc {
@@ -303,10 +453,44 @@ func FilteredTransactionsHandler(apiKey string) http.HandlerFunc {
 		var request FilteredTransactionsRequest
 		err := json.NewDecoder(r.Body).Decode(&request)
 		if err != nil {
-			http.Error(w, "Failed to parse request", http.StatusBadRequest)
+			http.Error(w, fmt.Sprintf("Failed to parse request: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		match, err := compileFilters(request.Filter, request.Query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
+		format, columns, err := ExportOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if request.GroupBy != "" {
+			if !validGroupBy(request.GroupBy) {
+				http.Error(w, errUnknownGroupBy.Error(), http.StatusBadRequest)
+				return
+			}
+			if format != ExportJSON {
+				http.Error(w, "Aggregations are only available as JSON", http.StatusBadRequest)
+				return
+			}
+		}
+		sortFields := transactionSortFields
+		if request.GroupBy != "" {
+			sortFields = groupSortFields
+		}
+		sortField, descending := "", false
+		if request.Sort != "" {
+			if sortField, descending, err = parseSort(request.Sort, sortFields); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
 		var startDate, endDate *time.Time
 
 		// Convert date strings to time.Time pointers
@@ -328,11 +512,69 @@ func FilteredTransactionsHandler(apiKey string) http.HandlerFunc {
 			endDate = &parsedEndDate
 		}
 
-		transactions, err := FetchFilteredTransactions(request.WalletAddress, apiKey, startDate, endDate, request.TokenType)
+		var history []Transaction
+		wallets := []string{strings.ToLower(request.WalletAddress)}
+		if request.Group != "" {
+			wallets, err = GroupAddresses(request.Group)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			history, err = FetchGroupTransactions(apiKey, wallets)
+		} else {
+			history, err = FetchTransactions(apiKey, request.WalletAddress)
+		}
 		if err != nil {
 			http.Error(w, "Failed to fetch filtered transactions", http.StatusInternalServerError)
 			return
 		}
+		transfers, err := FetchGroupTokenTransfers(apiKey, wallets)
+		if err != nil {
+			http.Error(w, "Failed to fetch token transfers", http.StatusInternalServerError)
+			return
+		}
+
+		// Look-alikes are matched against the whole history, not only the listed range
+		transactions := filterTransactions(history, startDate, endDate, request.TokenType)
+		listed := transactions
+		counterparties := RealCounterparties(history, transfers, wallets)
+		transactions = FlagTransactions(transactions, wallets, counterparties)
+		if request.ExcludeFlagged {
+			transactions = withoutFlaggedTransactions(transactions)
+		}
+		transactions = applyFilter(transactions, wallets, match)
+
+		if request.GroupBy != "" {
+			var grouped []TokenTransfer
+			if request.GroupBy == AggregateByToken {
+				grouped = FlagTokenTransfers(transfers, wallets, counterparties)
+				if request.ExcludeFlagged {
+					grouped = withoutFlaggedTransfers(grouped)
+				}
+				grouped = selectTransfers(grouped, startDate, endDate, listed, transactions, wallets, match)
+			}
+			aggregation := AggregateTransactions(transactions, grouped, wallets, request.GroupBy)
+			if sortField == "" {
+				sortField = "key"
+			}
+			sortGroups(aggregation.Groups, sortField, descending)
+			aggregation.Sort = request.Sort
+			if aggregation.Sort == "" {
+				aggregation.Sort = sortField
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(aggregation)
+			return
+		}
+		if sortField != "" {
+			sortTransactions(transactions, sortField, descending)
+		}
+		transactions = LabelTransactions(transactions)
+
+		if format != ExportJSON {
+			WriteTransactions(w, transactions, format, columns)
+			return
+		}
 
 		response, err := json.Marshal(transactions)
 		if err != nil {
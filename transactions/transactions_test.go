@@ -121,7 +121,7 @@ func TestFetchTransactionDetails(t *testing.T) {
 func TestTransactionDetailsHandler(t *testing.T) {
 	loadTestEnv()
 
-	handler := TransactionDetailsHandler(apiKey)
+	handler := TransactionDetailsHandler(apiKey, nil)
 
 	// Test case 1: Valid transaction ID
 	req := httptest.NewRequest(http.MethodGet, "/transaction_details?txid="+transactionID, nil)
@@ -0,0 +1,57 @@
+package transactions
+
+import (
+	"math/big"
+	"strconv"
+)
+
+/******************
+Beacon Withdrawals
+******************/
+
+// Validator balance withdrawn to the address by the beacon chain. Amount is in wei.
+type BeaconWithdrawal struct {
+	BlockNumber    int64  `json:"blockNumber"`
+	Timestamp      int64  `json:"timestamp"`
+	Index          int64  `json:"withdrawalIndex"`
+	ValidatorIndex int64  `json:"validatorIndex"`
+	Address        string `json:"address"`
+	Amount         string `json:"amount"`
+}
+
+var weiPerGwei = big.NewInt(1e9)
+
+// All beacon chain withdrawals to the address, oldest first
+func FetchBeaconWithdrawals(apiKey, address string) ([]BeaconWithdrawal, error) {
+	return FetchBeaconWithdrawalsFrom(apiKey, address, 0)
+}
+
+// Beacon chain withdrawals to the address from the start block on, oldest first
+func FetchBeaconWithdrawalsFrom(apiKey, address string, startBlock uint64) ([]BeaconWithdrawal, error) {
+	records, err := fetchAccountRecords(apiKey, "txsBeaconWithdrawal", address, startBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	withdrawals := make([]BeaconWithdrawal, 0, len(records))
+	for _, record := range records {
+		blockNumber, _ := strconv.ParseInt(record["blockNumber"], 10, 64)
+		timestamp, _ := strconv.ParseInt(record["timestamp"], 10, 64)
+		index, _ := strconv.ParseInt(record["withdrawalIndex"], 10, 64)
+		validator, _ := strconv.ParseInt(record["validatorIndex"], 10, 64)
+		// Etherscan reports amounts in gwei
+		amount, ok := new(big.Int).SetString(record["amount"], 10)
+		if !ok {
+			amount = new(big.Int)
+		}
+		withdrawals = append(withdrawals, BeaconWithdrawal{
+			BlockNumber:    blockNumber,
+			Timestamp:      timestamp,
+			Index:          index,
+			ValidatorIndex: validator,
+			Address:        record["address"],
+			Amount:         amount.Mul(amount, weiPerGwei).String(),
+		})
+	}
+	return withdrawals, nil
+}
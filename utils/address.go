@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// Whether the string is a 0x-prefixed 20-byte hex address
+func IsAddress(value string) bool {
+	if len(value) != 42 || !strings.HasPrefix(value, "0x") && !strings.HasPrefix(value, "0X") {
+		return false
+	}
+	_, err := hex.DecodeString(value[2:])
+	return err == nil
+}
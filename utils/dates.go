@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// Parse a YYYY-MM-DD date or an RFC3339 time
+func ParseDate(value string) (time.Time, error) {
+	if date, err := time.Parse(dateLayout, value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Parse the optional from and to query parameters. 'to' defaults to now and a plain 'to' date
+// covers the whole day; 'from' defaults to span before 'to'.
+func ParsePeriod(query url.Values, span time.Duration) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		parsed, err := ParseDate(value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("Invalid 'to' date")
+		}
+		to = parsed
+		if len(value) == len(dateLayout) {
+			to = to.Add(24*time.Hour - time.Nanosecond)
+		}
+	}
+	from := to.Add(-span)
+	if value := query.Get("from"); value != "" {
+		parsed, err := ParseDate(value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("Invalid 'from' date")
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("'from' must be before 'to'")
+	}
+	return from, to, nil
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// Etherscan API endpoint. Tests point it at a local server.
+var EtherscanAPIURL = "https://api.etherscan.io/api"
+
+// Call the Etherscan API with the given query parameters and decode the JSON body
+func FetchEtherscan(params map[string]string, apiKey string) (map[string]interface{}, error) {
+	query := url.Values{}
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	query.Set("apikey", apiKey)
+
+	response, err := http.Get(EtherscanAPIURL + "?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var jsonData map[string]interface{}
+	if err := json.Unmarshal(data, &jsonData); err != nil {
+		return nil, err
+	}
+
+	return jsonData, nil
+}
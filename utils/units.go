@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Decimals of ether amounts given in wei
+const EtherDecimals = 18
+
+// Convert an integer amount with the given decimals to a float
+func ToFloat(value *big.Int, decimals int) float64 {
+	scale := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	result, _ := new(big.Float).Quo(new(big.Float).SetInt(value), scale).Float64()
+	return result
+}
+
+func WeiToEther(wei *big.Int) float64 {
+	return ToFloat(wei, EtherDecimals)
+}
+
+// Format an integer amount with the given decimals exactly, e.g. 1500000000000000000 with 18 decimals as "1.5"
+func FormatUnits(value *big.Int, decimals int) string {
+	negative := value.Sign() < 0
+	digits := new(big.Int).Abs(value).String()
+	if decimals > 0 {
+		if len(digits) <= decimals {
+			digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+		}
+		point := len(digits) - decimals
+		digits = strings.TrimRight(digits[:point]+"."+digits[point:], "0")
+		digits = strings.TrimSuffix(digits, ".")
+	}
+	if negative {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Parse a decimal integer string, treating invalid input as zero
+func ParseBigInt(value string) *big.Int {
+	result, ok := new(big.Int).SetString(strings.TrimSpace(value), 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return result
+}
+
+// Parse a non-negative decimal amount into an integer with the given decimals, e.g. "1.5" with 18 decimals
+// as 1500000000000000000
+func ParseUnits(value string, decimals int) (*big.Int, error) {
+	value = strings.TrimSpace(value)
+	whole, fraction := value, ""
+	if point := strings.IndexByte(value, '.'); point >= 0 {
+		whole, fraction = value[:point], value[point+1:]
+	}
+	if whole == "" && fraction == "" {
+		return nil, fmt.Errorf("invalid amount %q", value)
+	}
+	if len(fraction) > decimals {
+		return nil, fmt.Errorf("amount %q has more than %d decimals", value, decimals)
+	}
+	digits := whole + fraction + strings.Repeat("0", decimals-len(fraction))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return nil, fmt.Errorf("invalid amount %q", value)
+		}
+	}
+	result, _ := new(big.Int).SetString(digits, 10)
+	return result, nil
+}